@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/caezarr-oss/refap/internal/bundle"
+)
+
+// runBundle exports the configured repositories into a signed air-gap bundle
+func runBundle(args []string) int {
+	flags := flag.NewFlagSet("bundle", flag.ExitOnError)
+	configPath := flags.String("config", "refap.toml", "Path to configuration file")
+	keyPath := flags.String("key", "", "Path to the ed25519 private key (PEM) used to sign the manifest")
+	flags.Parse(args)
+
+	if *keyPath == "" {
+		fmt.Fprintln(os.Stderr, "Error: -key is required")
+		return 2
+	}
+
+	// Load the key first so a bad key does not waste a whole export
+	privateKey, err := bundle.LoadPrivateKey(*keyPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading signing key: %v\n", err)
+		return 1
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// A bundle is always an archive export
+	cfg.Archive.Enabled = true
+
+	archiveWriter, ok := runExport(cfg, crawlRepositories)
+	if archiveWriter == nil {
+		return 1
+	}
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Warning: some sources failed, the bundle only holds the files exported successfully")
+	}
+
+	manifestPath, err := bundle.Create(archiveWriter, privateKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating bundle manifest: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Bundle manifest: %s\n", manifestPath)
+	if !ok {
+		return 1
+	}
+	fmt.Println("Bundle created successfully")
+	return 0
+}
+
+// runImport verifies a bundle and unpacks it into a target repository tree
+func runImport(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	manifestPath := flags.String("manifest", "", "Path to the bundle manifest (<name>"+bundle.ManifestSuffix+")")
+	publicKeyPath := flags.String("pubkey", "", "Path to the ed25519 public key (PEM) of the bundle signer")
+	targetDir := flags.String("target", "", "Target repository directory")
+	stripComponents := flags.Int("strip-components", 0, "Number of leading path components removed from each file")
+	flags.Parse(args)
+
+	if *manifestPath == "" || *publicKeyPath == "" || *targetDir == "" {
+		fmt.Fprintln(os.Stderr, "Error: -manifest, -pubkey and -target are required")
+		return 2
+	}
+
+	publicKey, err := bundle.LoadPublicKey(*publicKeyPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading public key: %v\n", err)
+		return 1
+	}
+
+	result, err := bundle.Import(bundle.ImportOptions{
+		ManifestPath:    *manifestPath,
+		PublicKey:       publicKey,
+		TargetDir:       *targetDir,
+		StripComponents: *stripComponents,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error importing bundle: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Imported %d files (%d bytes) into %s\n", result.Files, result.Bytes, *targetDir)
+	return 0
+}
+
+// runKeygen generates an ed25519 key pair to sign bundles
+func runKeygen(args []string) int {
+	flags := flag.NewFlagSet("keygen", flag.ExitOnError)
+	name := flags.String("out", "refap-bundle", "Base name of the key files (<out>.key and <out>.pub)")
+	flags.Parse(args)
+
+	if err := bundle.GenerateKey(*name+".key", *name+".pub"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating key pair: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Private key: %s.key\n", *name)
+	fmt.Printf("Public key: %s.pub\n", *name)
+	return 0
+}
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/caezarr-oss/refap/config"
+	"github.com/caezarr-oss/refap/internal/archive"
+	"github.com/caezarr-oss/refap/internal/cache"
+	"github.com/caezarr-oss/refap/internal/cas"
 	"github.com/caezarr-oss/refap/internal/crawler"
+	"github.com/caezarr-oss/refap/internal/httpclient"
+	"github.com/caezarr-oss/refap/internal/metrics"
 	"github.com/caezarr-oss/refap/internal/pathutil"
 )
 
@@ -19,6 +27,24 @@ var (
 )
 
 func main() {
+	// Dispatch subcommands, the default command exports the configured repositories
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "bundle":
+			os.Exit(runBundle(os.Args[2:]))
+		case "import":
+			os.Exit(runImport(os.Args[2:]))
+		case "keygen":
+			os.Exit(runKeygen(os.Args[2:]))
+		case "push":
+			os.Exit(runPush(os.Args[2:]))
+		case "migrate":
+			os.Exit(runMigrate(os.Args[2:]))
+		case "resolve":
+			os.Exit(runResolve(os.Args[2:]))
+		}
+	}
+
 	// Parse command line flags
 	configPath := flag.String("config", "refap.toml", "Path to configuration file")
 	showVersion := flag.Bool("version", false, "Show version information")
@@ -33,17 +59,100 @@ func main() {
 	}
 
 	// Load configuration
-	cfg, err := config.LoadConfig(*configPath)
+	cfg, err := loadConfig(*configPath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
+	if cfg.General.IntervalMinutes > 0 {
+		os.Exit(runScheduled(cfg))
+	}
+
+	if _, ok := runExport(cfg, crawlRepositories); !ok {
+		os.Exit(1)
+	}
+
+	fmt.Println("Refap completed successfully")
+}
+
+// runScheduled exports the sources every IntervalMinutes until the process is interrupted.
+// The metrics are served across the runs, a failed run being reported by them.
+func runScheduled(cfg *config.Config) int {
+	exportMetrics, stopMetrics, err := startMetrics(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error starting metrics listener: %v\n", err)
+		return 1
+	}
+	defer stopMetrics()
+
+	// The first interrupt stops the schedule once the current export ends, the
+	// default handling being restored so that a second one aborts the export
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	stop := make(chan struct{})
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		fmt.Printf("Received %s, stopping after the current export, interrupt again to abort it\n", sig)
+		close(stop)
+	}()
+
+	interval := time.Duration(cfg.General.IntervalMinutes) * time.Minute
+	ok := schedule(interval, stop, func() bool {
+		_, ok := exportSources(cfg, exportMetrics, crawlRepositories)
+		return ok
+	})
+	if !ok {
+		return 1
+	}
+	return 0
+}
+
+// schedule runs export every interval, counted from the start of the previous run,
+// until stop is closed. A failed run is reported and the next one still starts.
+// A run in progress is not interrupted: schedule returns once it ends, reporting
+// whether that last run succeeded.
+func schedule(interval time.Duration, stop <-chan struct{}, export func() bool) bool {
+	for {
+		start := time.Now()
+		ok := export()
+		if ok {
+			fmt.Println("Refap completed successfully")
+		} else {
+			fmt.Fprintln(os.Stderr, "Export failed, it is run again at the next interval")
+		}
+
+		// An interrupt received during the run stops the schedule even if the next run is due
+		select {
+		case <-stop:
+			fmt.Println("Scheduled exports stopped")
+			return ok
+		default:
+		}
+
+		next := start.Add(interval)
+		fmt.Printf("Next export at %s\n", next.Format(time.RFC3339))
+		select {
+		case <-stop:
+			fmt.Println("Scheduled exports stopped")
+			return ok
+		case <-time.After(time.Until(next)):
+		}
+	}
+}
+
+// loadConfig loads the configuration and prepares the output and log directories
+func loadConfig(configPath string) (*config.Config, error) {
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+
 	// Sanitize and ensure output directory exists
 	safeOutputDir := pathutil.SanitizePath(cfg.General.OutputDir)
 	if err := pathutil.EnsureDirectoryExists(safeOutputDir); err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating output directory: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("error creating output directory: %w", err)
 	}
 
 	// Update the configuration with the sanitized path
@@ -52,49 +161,57 @@ func main() {
 	// Sanitize and ensure log directory exists
 	safeLogPath := pathutil.SanitizePath(cfg.General.LogPath)
 	if err := pathutil.EnsureDirectoryExists(safeLogPath); err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating log directory: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("error creating log directory: %w", err)
 	}
 
 	// Update the configuration with the sanitized path
 	cfg.General.LogPath = safeLogPath
 
-	// Create crawler instance with configuration
-	c := crawler.New(crawler.Config{
-		ArtiURL:            cfg.Artifactory.URL,
-		BaseDir:            safeOutputDir,
-		FileTypes:          cfg.GetFileTypesList(),
-		ForceReplace:       cfg.Artifactory.ForceReplace,
-		RetryAttempts:      cfg.Download.RetryAttempts,
-		Timeout:            cfg.Download.Timeout,
-		UseWget:            cfg.Download.UseWget,
-		Delay:              cfg.Download.Delay,
-		ProxyEnabled:       cfg.Proxy.Enabled,
-		ProxyHost:          cfg.Proxy.Host,
-		ProxyPort:          cfg.Proxy.Port,
-		ProxyUsername:      cfg.Proxy.Username,
-		ProxyPassword:      cfg.Proxy.Password,
-		AuthType:           cfg.Auth.Type,
-		AuthUsername:       cfg.Auth.Username,
-		AuthPassword:       cfg.Auth.Password,
-		AuthAccessToken:    cfg.Auth.AccessToken,
-		FilterMode:         cfg.GetFilterMode(),
-		Extensions:         cfg.GetFileTypesList(),
-	})
+	return cfg, nil
+}
 
-	// Process repository list with safe path handling
-	repoListPath := cfg.Artifactory.RepoList
-	if !filepath.IsAbs(repoListPath) {
-		repoListPath = pathutil.SafeJoin(safeOutputDir, repoListPath)
-	} else {
-		repoListPath = pathutil.SanitizePath(repoListPath)
+// crawlFunc exports the repositories of a source with its crawler
+type crawlFunc func(c *crawler.Crawler, src config.SourceConfig, repos []string) error
+
+// crawlRepositories exports the content of the repositories according to their format
+func crawlRepositories(c *crawler.Crawler, src config.SourceConfig, repos []string) error {
+	switch config.RepositoryFormat(src.Format) {
+	case config.FormatNpm:
+		return c.ExportNpm(repos)
+	case config.FormatPyPI:
+		return c.ExportPyPI(repos)
+	case config.FormatDocker:
+		return c.ExportDocker(repos)
+	case config.FormatHelm:
+		return c.ExportHelm(repos)
+	case config.FormatGo:
+		return c.ExportGo(repos)
+	default:
+		return c.ProcessRepositories(repos)
 	}
+}
+
+// runExport exports every source of the configuration with crawl and prints the summary,
+// serving the metrics while it runs. In archive mode it returns the closed archive writer.
+// The boolean is false when the export could not start or a source failed.
+func runExport(cfg *config.Config, crawl crawlFunc) (*archive.Writer, bool) {
+	exportMetrics, stopMetrics, err := startMetrics(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error starting metrics listener: %v\n", err)
+		return nil, false
+	}
+	defer stopMetrics()
+
+	return exportSources(cfg, exportMetrics, crawl)
+}
+
+// exportSources runs an export for runExport, publishing to exportMetrics when set
+func exportSources(cfg *config.Config, exportMetrics *crawler.Metrics, crawl crawlFunc) (*archive.Writer, bool) {
+	safeOutputDir := cfg.General.OutputDir
 
 	fmt.Printf("Refap starting...\n")
-	fmt.Printf("Artifactory URL: %s\n", cfg.Artifactory.URL)
-	fmt.Printf("Repository list: %s\n", repoListPath)
 	fmt.Printf("Output directory: %s\n", safeOutputDir)
-	
+
 	// Print platform-specific information
 	if pathutil.IsWindowsOS() {
 		fmt.Println("Running on Windows - Using Windows-compatible path handling")
@@ -102,10 +219,215 @@ func main() {
 		fmt.Println("Running on Unix/Linux - Using Unix path handling")
 	}
 
-	if err := c.ParseRepoList(repoListPath); err != nil {
-		fmt.Fprintf(os.Stderr, "Error processing repository list: %v\n", err)
-		os.Exit(1)
+	// In archive mode the files are streamed into the archive volumes
+	var archiveWriter *archive.Writer
+	if cfg.Archive.Enabled {
+		var err error
+		archiveWriter, err = archive.NewWriter(cfg.GetArchivePath(), archive.Format(cfg.Archive.Format), cfg.Archive.MaxVolumeSizeMB*1024*1024)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating archive: %v\n", err)
+			return nil, false
+		}
+
+		fmt.Printf("Archive: %s (%s)\n", cfg.GetArchivePath(), cfg.Archive.Format)
 	}
 
-	fmt.Println("Refap completed successfully")
+	// With a content store, the exported files are links to the stored contents
+	var store *cas.Store
+	if cfg.Store.Enabled {
+		var err error
+		store, err = cas.Open(cfg.GetStorePath(), cas.LinkMode(cfg.Store.Link))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening content store: %v\n", err)
+			return nil, false
+		}
+
+		fmt.Printf("Content store: %s (%s)\n", store.Dir(), cfg.Store.Link)
+	}
+
+	// The download cache is shared with the runs of other configurations
+	var downloadCache *cache.Cache
+	if cfg.Cache.Enabled {
+		var err error
+		downloadCache, err = cache.Open(cfg.GetCachePath(), cfg.Cache.MaxSizeMB*1024*1024)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening download cache: %v\n", err)
+			return nil, false
+		}
+
+		fmt.Printf("Download cache: %s\n", downloadCache.Dir())
+	}
+
+	// Process every source and aggregate the statistics
+	var total crawler.Summary
+	failedSources := 0
+	for _, src := range cfg.GetSources() {
+		summary, err := processSource(cfg, src, safeOutputDir, archiveWriter, store, downloadCache, exportMetrics, crawl)
+		total.Add(summary)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error processing source %s: %v\n", sourceLabel(src), err)
+			failedSources++
+		}
+		if errors.Is(err, crawler.ErrLowSpace) {
+			// The other sources would not fit either
+			break
+		}
+	}
+
+	if archiveWriter != nil {
+		if err := archiveWriter.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error closing archive: %v\n", err)
+			failedSources++
+		}
+		for _, volume := range archiveWriter.Volumes() {
+			fmt.Printf("Archive volume: %s\n", volume)
+		}
+		fmt.Printf("Archive index: %s\n", archiveWriter.IndexPath())
+	}
+
+	fmt.Println("Summary:")
+	total.Print(os.Stdout)
+	if exportMetrics != nil {
+		exportMetrics.RunFinished(failedSources == 0)
+	}
+
+	if failedSources > 0 {
+		fmt.Fprintf(os.Stderr, "%d source(s) failed\n", failedSources)
+		return archiveWriter, false
+	}
+
+	return archiveWriter, true
+}
+
+// startMetrics serves the metrics at the listen address of the configuration when they
+// are enabled, and returns them with the function stopping the listener
+func startMetrics(cfg *config.Config) (*crawler.Metrics, func(), error) {
+	if !cfg.Metrics.Enabled {
+		return nil, func() {}, nil
+	}
+	registry := metrics.NewRegistry()
+	server, addr, err := metrics.Serve(cfg.Metrics.Listen, registry)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fmt.Printf("Metrics: http://%s/metrics\n", addr)
+	return crawler.NewMetrics(registry), func() { server.Close() }, nil
+}
+
+// processSource crawls the repositories of a source into its output subtree,
+// or into the archive when archiveWriter is set
+func processSource(cfg *config.Config, src config.SourceConfig, outputDir string, archiveWriter *archive.Writer, store *cas.Store, downloadCache *cache.Cache, exportMetrics *crawler.Metrics, crawl crawlFunc) (crawler.Summary, error) {
+	baseDir := outputDir
+	if src.OutputSubdir != "" {
+		baseDir = pathutil.SafeJoin(outputDir, src.OutputSubdir)
+	}
+
+	repos, err := src.GetRepositoryList(cfg.General.OutputDir)
+	if err != nil {
+		return crawler.Summary{}, err
+	}
+
+	crawlerConfig, err := newCrawlerConfig(cfg, src, baseDir)
+	if err != nil {
+		return crawler.Summary{}, err
+	}
+	crawlerConfig.Archive = archiveWriter
+	crawlerConfig.ArchivePrefix = src.OutputSubdir
+	crawlerConfig.Store = store
+	crawlerConfig.Cache = downloadCache
+	crawlerConfig.Metrics = exportMetrics
+
+	fmt.Printf("Source: %s\n", sourceLabel(src))
+	fmt.Printf("Artifactory URL: %s\n", src.URL)
+	fmt.Printf("Format: %s\n", src.Format)
+	fmt.Printf("Repositories: %d\n", len(repos))
+	fmt.Printf("Source output directory: %s\n", baseDir)
+
+	c := crawler.New(crawlerConfig)
+	err = crawl(c, src, repos)
+	c.Flush()
+	if err == nil {
+		// The export may have been aborted for a lack of free disk space
+		err = c.Err()
+	}
+	return c.Summary(), err
+}
+
+// newCrawlerConfig creates the crawler configuration for a source
+func newCrawlerConfig(cfg *config.Config, src config.SourceConfig, baseDir string) (crawler.Config, error) {
+	tlsConfig, err := httpclient.LoadTLSConfig(src.TLS.CAFile, src.TLS.CertFile, src.TLS.KeyFile, src.TLS.InsecureSkipVerify)
+	if err != nil {
+		return crawler.Config{}, err
+	}
+
+	return crawler.Config{
+		ArtiURL:                 src.URL,
+		MetricsSource:           sourceLabel(src),
+		ListingFormat:           src.Listing,
+		SourceType:              config.SourceType(src.Type),
+		BaseDir:                 baseDir,
+		FileTypes:               cfg.GetFileTypesList(),
+		ForceReplace:            cfg.Artifactory.ForceReplace,
+		RetryAttempts:           cfg.Download.RetryAttempts,
+		Timeout:                 cfg.Download.Timeout,
+		UseWget:                 cfg.Download.UseWget,
+		Delay:                   cfg.Download.Delay,
+		MaxIdleConns:            cfg.Download.MaxIdleConns,
+		MaxIdleConnsPerHost:     cfg.Download.MaxIdleConnsPerHost,
+		MaxConnsPerHost:         cfg.Download.MaxConnsPerHost,
+		IdleConnTimeout:         cfg.Download.IdleConnTimeout,
+		HTTP2:                   cfg.Download.HTTP2,
+		MaxDepth:                cfg.Download.MaxDepth,
+		MaxRedirects:            cfg.Download.MaxRedirects,
+		MinFreeSpace:            cfg.Download.MinFreeSpaceMB * 1024 * 1024,
+		LowSpaceAction:          config.LowSpaceAction(cfg.Download.LowSpaceAction),
+		TLSConfig:               tlsConfig,
+		ProxyEnabled:            src.Proxy.Enabled,
+		ProxyHost:               src.Proxy.Host,
+		ProxyPort:               src.Proxy.Port,
+		ProxyUsername:           src.Proxy.Username,
+		ProxyPassword:           src.Proxy.Password,
+		AuthType:                src.Auth.Type,
+		AuthUsername:            src.Auth.Username,
+		AuthPassword:            src.Auth.Password,
+		AuthAccessToken:         src.Auth.AccessToken,
+		FilterMode:              cfg.GetFilterMode(),
+		Extensions:              cfg.GetFileTypesList(),
+		IncludeMavenMetadata:    cfg.Files.IncludeMavenMetadata,
+		RegenerateMavenMetadata: cfg.Files.RegenerateMavenMetadata,
+		IncludeGradleMetadata:   cfg.Files.IncludeGradleMetadata,
+		IncludeClassifiers:      cfg.Files.IncludeClassifiers,
+		ExcludeClassifiers:      cfg.Files.ExcludeClassifiers,
+		NpmPackages:             cfg.Npm.Packages,
+		NpmLatestOnly:           config.NpmVersions(cfg.Npm.Versions) == config.NpmVersionsLatest,
+		NpmIncludePrerelease:    cfg.Npm.IncludePrerelease,
+		NpmRegistryURL:          cfg.Npm.RegistryURL,
+		PyPIProjects:            cfg.PyPI.Projects,
+		PyPIPackageTypes:        cfg.PyPI.PackageTypes,
+		PyPIPythonTags:          cfg.PyPI.PythonTags,
+		PyPIPlatforms:           cfg.PyPI.Platforms,
+		DockerImages:            cfg.Docker.Images,
+		DockerTags:              cfg.Docker.Tags,
+		DockerPlatforms:         cfg.Docker.Platforms,
+		HelmCharts:              cfg.Helm.Charts,
+		HelmVersions:            cfg.Helm.Versions,
+		HelmIncludePrerelease:   cfg.Helm.IncludePrerelease,
+		GoModules:               cfg.Go.Modules,
+		GoSumFiles:              cfg.Go.GoSum,
+		GoChecksumDB:            cfg.Go.ChecksumDB,
+		GoLatestOnly:            cfg.Go.LatestOnly,
+		GoIncludePrerelease:     cfg.Go.IncludePrerelease,
+		Layout:                  config.LayoutMode(cfg.Layout.Mode),
+		ConflictPolicy:          config.ConflictPolicy(cfg.Layout.Conflict),
+		RepositoryIDs:           cfg.GetLayoutRepositoryIDs(),
+	}, nil
+}
+
+// sourceLabel returns a printable name for a source
+func sourceLabel(src config.SourceConfig) string {
+	if src.Name != "" {
+		return src.Name
+	}
+	return src.URL
 }
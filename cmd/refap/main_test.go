@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleRunsEveryIntervalUntilStopped(t *testing.T) {
+	interval := 50 * time.Millisecond
+	stop := make(chan struct{})
+	var starts []time.Time
+	ok := schedule(interval, stop, func() bool {
+		starts = append(starts, time.Now())
+		if len(starts) == 3 {
+			// Stopped during the third run, which is not interrupted
+			close(stop)
+		}
+		// The first run fails, which does not stop the schedule
+		return len(starts) > 1
+	})
+
+	if len(starts) != 3 {
+		t.Fatalf("%d runs, want 3", len(starts))
+	}
+	if !ok {
+		t.Error("schedule reported a failure, want the success of the last run")
+	}
+	for i := 1; i < len(starts); i++ {
+		if gap := starts[i].Sub(starts[i-1]); gap < interval {
+			t.Errorf("run %d started %s after the previous one, want at least %s", i+1, gap, interval)
+		}
+	}
+}
+
+func TestScheduleCountsIntervalFromRunStart(t *testing.T) {
+	// A run longer than the interval is followed by the next one right away
+	interval := 200 * time.Millisecond
+	stop := make(chan struct{})
+	var starts []time.Time
+	schedule(interval, stop, func() bool {
+		starts = append(starts, time.Now())
+		if len(starts) == 1 {
+			time.Sleep(interval + interval/2)
+		} else {
+			close(stop)
+		}
+		return true
+	})
+
+	if len(starts) != 2 {
+		t.Fatalf("%d runs, want 2", len(starts))
+	}
+	if gap := starts[1].Sub(starts[0]); gap >= 2*interval+interval/4 {
+		t.Errorf("second run started %s after the first one, want no wait after a long run", gap)
+	}
+}
+
+func TestScheduleStopsWhileWaiting(t *testing.T) {
+	stop := make(chan struct{})
+	runs := 0
+	done := make(chan bool)
+	go func() {
+		done <- schedule(time.Hour, stop, func() bool {
+			runs++
+			return false
+		})
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	select {
+	case ok := <-done:
+		if ok {
+			t.Error("schedule reported a success, want the failure of the last run")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("schedule did not stop while waiting for the next run")
+	}
+	if runs != 1 {
+		t.Errorf("%d runs, want 1", runs)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/caezarr-oss/refap/config"
+	"github.com/caezarr-oss/refap/internal/crawler"
+	"github.com/caezarr-oss/refap/internal/httpclient"
+	"github.com/caezarr-oss/refap/internal/push"
+)
+
+// runMigrate streams the repositories of every source into the target Artifactory of the [migrate] section
+func runMigrate(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	configPath := flags.String("config", "refap.toml", "Path to configuration file")
+	stateFile := flags.String("state", "", "State file recording the migrated files (overrides migrate.state_file)")
+	flags.Parse(args)
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if cfg.Migrate.URL == "" {
+		fmt.Fprintln(os.Stderr, "Error: migrate.url must be set in the configuration")
+		return 1
+	}
+	if *stateFile != "" {
+		cfg.Migrate.StateFile = *stateFile
+	}
+
+	client, err := newHTTPClient(cfg, cfg.Migrate.Proxy, cfg.Migrate.TLS)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// The metrics are served while the sources are migrated
+	migrateMetrics, stopMetrics, err := startMetrics(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error starting metrics listener: %v\n", err)
+		return 1
+	}
+	defer stopMetrics()
+
+	migrator, err := push.NewMigrator(push.MigrateConfig{
+		URL:           cfg.Migrate.URL,
+		RepositoryMap: cfg.GetMigrateRepositoryMap(),
+		StateFile:     cfg.GetMigrateStateFile(),
+		Concurrency:   cfg.Migrate.ConcurrentUploads,
+		RetryAttempts: cfg.Download.RetryAttempts,
+		Delay:         cfg.Download.Delay,
+		Auth: httpclient.Auth{
+			Type:        cfg.Migrate.Auth.Type,
+			Username:    cfg.Migrate.Auth.Username,
+			Password:    cfg.Migrate.Auth.Password,
+			AccessToken: cfg.Migrate.Auth.AccessToken,
+		},
+		Client:  client,
+		Metrics: migrateMetrics,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer migrator.Close()
+
+	fmt.Printf("Migrating to %s\n", cfg.Migrate.URL)
+	fmt.Printf("State file: %s\n", cfg.GetMigrateStateFile())
+
+	failedSources := 0
+	for _, src := range cfg.GetSources() {
+		if err := migrateSource(cfg, src, migrator, migrateMetrics); err != nil {
+			fmt.Fprintf(os.Stderr, "Error migrating source %s: %v\n", sourceLabel(src), err)
+			failedSources++
+		}
+	}
+
+	summary := migrator.Summary()
+	fmt.Println("Summary:")
+	summary.Print(os.Stdout)
+
+	if failedSources > 0 || summary.Failed > 0 {
+		return 1
+	}
+	fmt.Println("Migration completed successfully")
+	return 0
+}
+
+// migrateSource streams all the repositories of a source to the migration target
+func migrateSource(cfg *config.Config, src config.SourceConfig, migrator *push.Migrator, migrateMetrics *crawler.Metrics) error {
+	repos, err := src.GetRepositoryList(cfg.General.OutputDir)
+	if err != nil {
+		return err
+	}
+
+	// Files are never written to the output directory, it is only used to resolve the repository list
+	crawlerConfig, err := newCrawlerConfig(cfg, src, cfg.General.OutputDir)
+	if err != nil {
+		return err
+	}
+	crawlerConfig.Metrics = migrateMetrics
+
+	fmt.Printf("Source: %s\n", sourceLabel(src))
+	fmt.Printf("Artifactory URL: %s\n", src.URL)
+	fmt.Printf("Repositories: %d\n", len(repos))
+
+	return migrator.Migrate(sourceLabel(src), func() *crawler.Crawler { return crawler.New(crawlerConfig) }, repos)
+}
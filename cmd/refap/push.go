@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/caezarr-oss/refap/config"
+	"github.com/caezarr-oss/refap/internal/httpclient"
+	"github.com/caezarr-oss/refap/internal/push"
+)
+
+// runPush uploads the exported tree into the target repository of the [push] section
+func runPush(args []string) int {
+	flags := flag.NewFlagSet("push", flag.ExitOnError)
+	configPath := flags.String("config", "refap.toml", "Path to configuration file")
+	sourceDir := flags.String("source", "", "Local tree to push (overrides push.source_dir)")
+	manifestPath := flags.String("manifest", "", "Export index or bundle manifest listing the files to push (overrides push.manifest)")
+	flags.Parse(args)
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if cfg.Push.URL == "" {
+		fmt.Fprintln(os.Stderr, "Error: push.url must be set in the configuration")
+		return 1
+	}
+	if *sourceDir != "" {
+		cfg.Push.SourceDir = *sourceDir
+	}
+	if *manifestPath != "" {
+		cfg.Push.Manifest = *manifestPath
+	}
+
+	client, err := newHTTPClient(cfg, cfg.Push.Proxy, cfg.Push.TLS)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Pushing %s to %s%s\n", cfg.GetPushSourceDir(), cfg.Push.URL, cfg.Push.Repository)
+
+	pusher := push.New(push.Config{
+		URL:             cfg.Push.URL,
+		Repository:      cfg.Push.Repository,
+		SourceDir:       cfg.GetPushSourceDir(),
+		ManifestPath:    cfg.Push.Manifest,
+		StripComponents: cfg.Push.StripComponents,
+		Concurrency:     cfg.Push.ConcurrentUploads,
+		RetryAttempts:   cfg.Download.RetryAttempts,
+		Delay:           cfg.Download.Delay,
+		Auth: httpclient.Auth{
+			Type:        cfg.Push.Auth.Type,
+			Username:    cfg.Push.Auth.Username,
+			Password:    cfg.Push.Auth.Password,
+			AccessToken: cfg.Push.Auth.AccessToken,
+		},
+		Client: client,
+	})
+
+	summary, err := pusher.Run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error pushing files: %v\n", err)
+		return 1
+	}
+
+	fmt.Println("Summary:")
+	summary.Print(os.Stdout)
+
+	if summary.Failed > 0 {
+		return 1
+	}
+	fmt.Println("Push completed successfully")
+	return 0
+}
+
+// newHTTPClient creates an HTTP client with the download settings and the given proxy and TLS settings
+func newHTTPClient(cfg *config.Config, proxy config.ProxyConfig, tlsSettings config.TLSConfig) (*http.Client, error) {
+	tlsConfig, err := httpclient.LoadTLSConfig(tlsSettings.CAFile, tlsSettings.CertFile, tlsSettings.KeyFile, tlsSettings.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	return httpclient.New(httpclient.Options{
+		Timeout:             cfg.Download.Timeout,
+		MaxIdleConns:        cfg.Download.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.Download.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.Download.MaxConnsPerHost,
+		IdleConnTimeout:     cfg.Download.IdleConnTimeout,
+		HTTP2:               cfg.Download.HTTP2,
+		TLSConfig:           tlsConfig,
+		ProxyEnabled:        proxy.Enabled,
+		ProxyHost:           proxy.Host,
+		ProxyPort:           proxy.Port,
+		ProxyUsername:       proxy.Username,
+		ProxyPassword:       proxy.Password,
+	}), nil
+}
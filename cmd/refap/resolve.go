@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/caezarr-oss/refap/config"
+	"github.com/caezarr-oss/refap/internal/crawler"
+	"github.com/caezarr-oss/refap/internal/maven"
+)
+
+// runResolve exports Maven artifacts with their transitive dependencies instead of whole repositories.
+// The coordinates are given as arguments, or in the [resolve] section of the configuration.
+func runResolve(args []string) int {
+	flags := flag.NewFlagSet("resolve", flag.ExitOnError)
+	configPath := flags.String("config", "refap.toml", "Path to configuration file")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: refap resolve [-config refap.toml] [groupId:artifactId[:type[:classifier]]:version ...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	specs := flags.Args()
+	if len(specs) == 0 {
+		if specs, err = cfg.GetResolveCoordinates(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+	if len(specs) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no coordinates to resolve, give them as arguments or in the [resolve] section")
+		return 1
+	}
+
+	var roots []maven.Coordinates
+	for _, spec := range specs {
+		coordinates, err := maven.ParseCoordinates(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		roots = append(roots, coordinates)
+	}
+
+	// The repositories of each source are searched in order for every artifact
+	resolve := func(c *crawler.Crawler, src config.SourceConfig, repos []string) error {
+		if config.RepositoryFormat(src.Format) != config.FormatMaven {
+			return fmt.Errorf("resolve only supports maven sources, not %s", src.Format)
+		}
+		resolution, err := c.Resolve(roots, repos, cfg.Resolve.Scopes)
+		fmt.Printf("Resolved artifacts: %d\n", len(resolution.Artifacts))
+		for _, unresolved := range resolution.Unresolved {
+			fmt.Printf("Unresolved %s: %s\n", unresolved.Coordinates, unresolved.Reason)
+		}
+		if err != nil {
+			return err
+		}
+		if len(resolution.Unresolved) > 0 {
+			return fmt.Errorf("%d coordinate(s) could not be resolved", len(resolution.Unresolved))
+		}
+		return nil
+	}
+
+	if _, ok := runExport(cfg, resolve); !ok {
+		return 1
+	}
+
+	fmt.Println("Resolution completed successfully")
+	return 0
+}
@@ -5,10 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/spf13/viper"
+
+	"github.com/caezarr-oss/refap/internal/archive"
+	"github.com/caezarr-oss/refap/internal/cas"
+	"github.com/caezarr-oss/refap/internal/helm"
+	"github.com/caezarr-oss/refap/internal/npm"
 )
 
 // Default values
@@ -17,8 +23,27 @@ const (
 	DefaultRetryAttempts       = 3
 	DefaultTimeout             = 10
 	DefaultDelay               = 1
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 16
+	DefaultIdleConnTimeout     = 90
+	DefaultMaxDepth            = 50
+	DefaultMaxRedirects        = 10
+	DefaultCacheMaxSizeMB      = 10240
+	DefaultMinFreeSpaceMB      = 1024
 )
 
+// DefaultArchiveName is the base name of the archive volumes in the output directory
+const DefaultArchiveName = "refap-export"
+
+// DefaultMetricsListen is the address the metrics are served at by default
+const DefaultMetricsListen = "127.0.0.1:9464"
+
+// DefaultStoreName is the name of the content-addressable store in the output directory
+const DefaultStoreName = ".refap-store"
+
+// DefaultMigrateStateFile is the name of the migration state file in the output directory
+const DefaultMigrateStateFile = "refap-migrate.state"
+
 // FileTypesDefault is the default set of file extensions to download
 const FileTypesDefault = ".pom,.jar,.war,.xml,.zip,.tar,.tar.gz"
 
@@ -34,6 +59,121 @@ const (
 	FilterModeBlacklist FilterMode = "blacklist"
 )
 
+// LayoutMode defines how downloaded files are organized in the output directory
+type LayoutMode string
+
+const (
+	// LayoutMirror mirrors the remote directory structure, one subtree per repository
+	LayoutMirror LayoutMode = "mirror"
+	// LayoutMavenLocal merges the repositories into a Maven local repository (~/.m2/repository)
+	LayoutMavenLocal LayoutMode = "maven-local"
+)
+
+// RepositoryFormat defines the package format of the repositories of a source
+type RepositoryFormat string
+
+const (
+	// FormatMaven crawls the repository listings, for Maven and generic repositories
+	FormatMaven RepositoryFormat = "maven"
+	// FormatNpm reads the package metadata of npm repositories
+	FormatNpm RepositoryFormat = "npm"
+	// FormatPyPI reads the PEP 503 simple API of PyPI repositories
+	FormatPyPI RepositoryFormat = "pypi"
+	// FormatDocker reads the OCI distribution API of Docker repositories
+	FormatDocker RepositoryFormat = "docker"
+	// FormatHelm reads the index.yaml of Helm repositories
+	FormatHelm RepositoryFormat = "helm"
+	// FormatGo reads the GOPROXY API of Go repositories
+	FormatGo RepositoryFormat = "go"
+)
+
+// SourceType defines the kind of server of a source
+type SourceType string
+
+const (
+	// SourceArtifactory crawls the listing pages of the source
+	SourceArtifactory SourceType = "artifactory"
+	// SourceNexus lists the repositories of a Nexus 3 server through its REST API
+	SourceNexus SourceType = "nexus"
+)
+
+// ListingFormat defines the server dialect of the listing pages crawled by the maven format
+type ListingFormat string
+
+const (
+	// ListingAuto detects the dialect of each listing from its headers and markup
+	ListingAuto ListingFormat = "auto"
+	// ListingArtifactory reads the pages of the Artifactory list/ API
+	ListingArtifactory ListingFormat = "artifactory"
+	// ListingNexus reads the browse pages of Nexus 3 and the content pages of Nexus 2
+	ListingNexus ListingFormat = "nexus"
+	// ListingApache reads the pages of Apache httpd mod_autoindex
+	ListingApache ListingFormat = "apache"
+	// ListingNginx reads the pages of nginx autoindex, in the html or json format
+	ListingNginx ListingFormat = "nginx"
+)
+
+// GetValidListingFormats returns the list of supported listing formats
+func GetValidListingFormats() []string {
+	return []string{string(ListingAuto), string(ListingArtifactory), string(ListingNexus), string(ListingApache), string(ListingNginx)}
+}
+
+// IsValidListingFormat checks if the listing format is valid
+func IsValidListingFormat(format string) bool {
+	for _, validFormat := range GetValidListingFormats() {
+		if format == validFormat {
+			return true
+		}
+	}
+	return false
+}
+
+// GetValidFormats returns the list of supported repository formats
+func GetValidFormats() []string {
+	return []string{string(FormatMaven), string(FormatNpm), string(FormatPyPI), string(FormatDocker), string(FormatHelm), string(FormatGo)}
+}
+
+// IsValidFormat checks if the repository format is valid
+func IsValidFormat(format string) bool {
+	for _, validFormat := range GetValidFormats() {
+		if format == validFormat {
+			return true
+		}
+	}
+	return false
+}
+
+// NpmVersions defines which versions of the npm packages are exported
+type NpmVersions string
+
+const (
+	// NpmVersionsAll exports every version matching the range of the package
+	NpmVersionsAll NpmVersions = "all"
+	// NpmVersionsLatest exports the highest version matching the range, or the latest dist tag
+	NpmVersionsLatest NpmVersions = "latest"
+)
+
+// ConflictPolicy defines what happens when a file of the merged layout is
+// provided with a different content by several repositories
+type ConflictPolicy string
+
+const (
+	// ConflictFirst keeps the file of the first repository in the list
+	ConflictFirst ConflictPolicy = "first"
+	// ConflictFail keeps the first file and counts the others as failed downloads
+	ConflictFail ConflictPolicy = "fail"
+)
+
+// LowSpaceAction defines what an export does when the free disk space drops below min_free_space_mb
+type LowSpaceAction string
+
+const (
+	// LowSpaceAbort stops the export, the files already exported being kept
+	LowSpaceAbort LowSpaceAction = "abort"
+	// LowSpacePause waits until space is freed, then resumes the export
+	LowSpacePause LowSpaceAction = "pause"
+)
+
 // Config represents the application's configuration
 type Config struct {
 	General struct {
@@ -41,12 +181,16 @@ type Config struct {
 		LogPath             string `mapstructure:"log_path"`
 		LogLevel            string `mapstructure:"log_level"`
 		ConcurrentDownloads int    `mapstructure:"concurrent_downloads"`
+		IntervalMinutes     int    `mapstructure:"interval_minutes"`
 	} `mapstructure:"general"`
 
 	Artifactory struct {
 		URL          string   `mapstructure:"url"`
 		RepoList     string   `mapstructure:"repo_list"`
 		Repositories []string `mapstructure:"repositories"`
+		Type         string   `mapstructure:"type"`
+		Format       string   `mapstructure:"format"`
+		Listing      string   `mapstructure:"listing"`
 		FileTypes    string   `mapstructure:"file_types"`
 		ForceReplace bool     `mapstructure:"force_replace"`
 	} `mapstructure:"artifactory"`
@@ -55,12 +199,49 @@ type Config struct {
 		FilterMode         string   `mapstructure:"filter_mode"`
 		Extensions         []string `mapstructure:"extensions"`
 		IncludeMavenMetadata bool   `mapstructure:"include_maven_metadata"`
-		CleanHTMLFiles     bool     `mapstructure:"clean_html_files"`
+		RegenerateMavenMetadata bool `mapstructure:"regenerate_maven_metadata"`
+		IncludeGradleMetadata bool  `mapstructure:"include_gradle_metadata"`
+		IncludeClassifiers []string `mapstructure:"include_classifiers"`
+		ExcludeClassifiers []string `mapstructure:"exclude_classifiers"`
 	} `mapstructure:"files"`
 
 	Download DownloadConfig `mapstructure:"download"`
 	Proxy    ProxyConfig    `mapstructure:"proxy"`
 	Auth     AuthConfig     `mapstructure:"auth"`
+	TLS      TLSConfig      `mapstructure:"tls"`
+	Archive  ArchiveConfig  `mapstructure:"archive"`
+	Store    StoreConfig    `mapstructure:"store"`
+	Cache    CacheConfig    `mapstructure:"cache"`
+	Metrics  MetricsConfig  `mapstructure:"metrics"`
+	Layout   LayoutConfig   `mapstructure:"layout"`
+	Push     PushConfig     `mapstructure:"push"`
+	Migrate  MigrateConfig  `mapstructure:"migrate"`
+	Resolve  ResolveConfig  `mapstructure:"resolve"`
+	Npm      NpmConfig      `mapstructure:"npm"`
+	PyPI     PyPIConfig     `mapstructure:"pypi"`
+	Docker   DockerConfig   `mapstructure:"docker"`
+	Helm     HelmConfig     `mapstructure:"helm"`
+	Go       GoConfig       `mapstructure:"go"`
+
+	// Sources lists the Artifactory instances to export from.
+	// When empty, a single source is built from the [artifactory], [proxy], [auth] and [tls] sections.
+	Sources []SourceConfig `mapstructure:"sources"`
+}
+
+// SourceConfig defines one Artifactory instance to export from
+type SourceConfig struct {
+	Name         string   `mapstructure:"name"`
+	URL          string   `mapstructure:"url"`
+	RepoList     string   `mapstructure:"repo_list"`
+	Repositories []string `mapstructure:"repositories"`
+	Type         string   `mapstructure:"type"`
+	Format       string   `mapstructure:"format"`
+	Listing      string   `mapstructure:"listing"`
+	OutputSubdir string   `mapstructure:"output_subdir"`
+
+	Proxy ProxyConfig `mapstructure:"proxy"`
+	Auth  AuthConfig  `mapstructure:"auth"`
+	TLS   TLSConfig   `mapstructure:"tls"`
 }
 
 // DownloadConfig defines download behavior
@@ -69,6 +250,23 @@ type DownloadConfig struct {
 	Timeout       int  `mapstructure:"timeout"`
 	UseWget       bool `mapstructure:"use_wget"`
 	Delay         int  `mapstructure:"delay"`
+
+	// HTTP connection pool settings
+	MaxIdleConns        int  `mapstructure:"max_idle_conns"`
+	MaxIdleConnsPerHost int  `mapstructure:"max_idle_conns_per_host"`
+	MaxConnsPerHost     int  `mapstructure:"max_conns_per_host"`
+	IdleConnTimeout     int  `mapstructure:"idle_conn_timeout"`
+	HTTP2               bool `mapstructure:"http2"`
+
+	// MaxDepth is the deepest directory crawled below a repository, 0 for no limit
+	MaxDepth int `mapstructure:"max_depth"`
+	// MaxRedirects is the number of redirects followed by a request, 0 for the default
+	MaxRedirects int `mapstructure:"max_redirects"`
+
+	// MinFreeSpaceMB is the free space kept on the output filesystem, 0 to disable the checks
+	MinFreeSpaceMB int64 `mapstructure:"min_free_space_mb"`
+	// LowSpaceAction is abort or pause, when the free space drops below MinFreeSpaceMB
+	LowSpaceAction string `mapstructure:"low_space_action"`
 }
 
 // ProxyConfig defines proxy configuration
@@ -88,6 +286,243 @@ type AuthConfig struct {
 	AccessToken string `mapstructure:"access_token"`
 }
 
+// ArchiveConfig defines the archive output mode, where downloaded files are
+// streamed into archive volumes instead of being written to the output directory
+type ArchiveConfig struct {
+	Enabled         bool   `mapstructure:"enabled"`
+	Format          string `mapstructure:"format"`
+	Path            string `mapstructure:"path"`
+	MaxVolumeSizeMB int64  `mapstructure:"max_volume_size_mb"`
+}
+
+// GetArchivePath returns the base path of the archive volumes, without extension
+func (c *Config) GetArchivePath() string {
+	if c.Archive.Path == "" {
+		return filepath.Join(c.General.OutputDir, DefaultArchiveName)
+	}
+	return c.Archive.Path
+}
+
+// StoreConfig defines the content-addressable store deduplicating the exported files:
+// each content is stored once, keyed by its sha256, and linked into the export tree
+type StoreConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Path    string `mapstructure:"path"`
+	Link    string `mapstructure:"link"`
+}
+
+// GetStorePath returns the directory of the content-addressable store
+func (c *Config) GetStorePath() string {
+	if c.Store.Path == "" {
+		return filepath.Join(c.General.OutputDir, DefaultStoreName)
+	}
+	return c.Store.Path
+}
+
+// CacheConfig defines the download cache shared by the runs of every configuration
+// and output directory, its least recently used files being evicted above MaxSizeMB
+type CacheConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`
+	Path      string `mapstructure:"path"`
+	MaxSizeMB int64  `mapstructure:"max_size_mb"`
+}
+
+// GetCachePath returns the directory of the download cache, refap in the user
+// cache directory by default
+func (c *Config) GetCachePath() string {
+	if c.Cache.Path != "" {
+		return c.Cache.Path
+	}
+	if userCacheDir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(userCacheDir, "refap")
+	}
+	return filepath.Join(c.General.OutputDir, ".refap-cache")
+}
+
+// MetricsConfig defines the HTTP listener exposing the Prometheus metrics of the
+// exports at /metrics while they run
+type MetricsConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Listen  string `mapstructure:"listen"`
+}
+
+// LayoutConfig defines the organization of the output directory
+type LayoutConfig struct {
+	Mode     string `mapstructure:"mode"`
+	Conflict string `mapstructure:"conflict"`
+	// RepositoryIDs gives the Maven repository id recorded for a repository in
+	// the maven-local layout, as "repository=id" entries. Repositories not listed
+	// use their own name.
+	RepositoryIDs []string `mapstructure:"repository_ids"`
+}
+
+// GetLayoutRepositoryIDs returns the Maven repository id of each renamed repository
+func (c *Config) GetLayoutRepositoryIDs() map[string]string {
+	return parseMappings(c.Layout.RepositoryIDs)
+}
+
+// PushConfig defines the target Artifactory repository of the push command
+type PushConfig struct {
+	URL               string `mapstructure:"url"`
+	Repository        string `mapstructure:"repository"`
+	SourceDir         string `mapstructure:"source_dir"`
+	Manifest          string `mapstructure:"manifest"`
+	StripComponents   int    `mapstructure:"strip_components"`
+	ConcurrentUploads int    `mapstructure:"concurrent_uploads"`
+
+	Proxy ProxyConfig `mapstructure:"proxy"`
+	Auth  AuthConfig  `mapstructure:"auth"`
+	TLS   TLSConfig   `mapstructure:"tls"`
+}
+
+// GetPushSourceDir returns the local tree to push, the output directory by default
+func (c *Config) GetPushSourceDir() string {
+	if c.Push.SourceDir == "" {
+		return c.General.OutputDir
+	}
+	return c.Push.SourceDir
+}
+
+// MigrateConfig defines the target Artifactory of the migrate command
+type MigrateConfig struct {
+	URL string `mapstructure:"url"`
+	// RepositoryMap renames repositories on the target, as "source=target" entries.
+	// Repositories not listed keep their name.
+	RepositoryMap     []string `mapstructure:"repository_map"`
+	StateFile         string   `mapstructure:"state_file"`
+	ConcurrentUploads int      `mapstructure:"concurrent_uploads"`
+
+	Proxy ProxyConfig `mapstructure:"proxy"`
+	Auth  AuthConfig  `mapstructure:"auth"`
+	TLS   TLSConfig   `mapstructure:"tls"`
+}
+
+// GetMigrateStateFile returns the path of the migration state file
+func (c *Config) GetMigrateStateFile() string {
+	if c.Migrate.StateFile == "" {
+		return filepath.Join(c.General.OutputDir, DefaultMigrateStateFile)
+	}
+	return c.Migrate.StateFile
+}
+
+// GetMigrateRepositoryMap returns the target repository of each renamed source repository
+func (c *Config) GetMigrateRepositoryMap() map[string]string {
+	return parseMappings(c.Migrate.RepositoryMap)
+}
+
+// ResolveConfig defines the Maven coordinates fetched with their dependencies by the resolve command
+type ResolveConfig struct {
+	// Coordinates are groupId:artifactId[:type[:classifier]]:version entries
+	Coordinates     []string `mapstructure:"coordinates"`
+	CoordinatesFile string   `mapstructure:"coordinates_file"`
+	// Scopes are the scopes of the direct dependencies to follow
+	Scopes []string `mapstructure:"scopes"`
+}
+
+// GetResolveCoordinates returns the configured coordinates followed by the ones of the coordinates file.
+// Relative coordinates_file paths are resolved against the output directory.
+func (c *Config) GetResolveCoordinates() ([]string, error) {
+	coordinates := append([]string(nil), c.Resolve.Coordinates...)
+	if c.Resolve.CoordinatesFile == "" {
+		return coordinates, nil
+	}
+
+	filePath := c.Resolve.CoordinatesFile
+	if !filepath.IsAbs(filePath) {
+		filePath = filepath.Join(c.General.OutputDir, filePath)
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening coordinates file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			coordinates = append(coordinates, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading coordinates file: %w", err)
+	}
+	return coordinates, nil
+}
+
+// NpmConfig defines the packages exported from npm repositories
+type NpmConfig struct {
+	// Packages are name[@range] entries, e.g. "react@^18.0.0" or "@types/node".
+	// All the packages of the repositories are exported when empty.
+	Packages          []string `mapstructure:"packages"`
+	Versions          string   `mapstructure:"versions"`
+	IncludePrerelease bool     `mapstructure:"include_prerelease"`
+	// RegistryURL is the URL the exported repositories are served at
+	RegistryURL string `mapstructure:"registry_url"`
+}
+
+// PyPIConfig defines the projects and distribution files exported from PyPI repositories
+type PyPIConfig struct {
+	// Projects to export, all the projects of the repositories when empty
+	Projects []string `mapstructure:"projects"`
+	// PackageTypes are wheel and/or sdist, both when empty
+	PackageTypes []string `mapstructure:"package_types"`
+	// PythonTags and Platforms filter the wheels by their tags, e.g. "cp311", "py3", "manylinux*_x86_64"
+	PythonTags []string `mapstructure:"python_tags"`
+	Platforms  []string `mapstructure:"platforms"`
+}
+
+// DockerConfig defines the images exported from Docker repositories
+type DockerConfig struct {
+	// Images are name[:tag pattern] entries, e.g. "library/alpine:3.*".
+	// All the images of the repositories are exported when empty.
+	Images []string `mapstructure:"images"`
+	// Tags are the tag patterns of the images without their own pattern, all tags when empty
+	Tags []string `mapstructure:"tags"`
+	// Platforms keep only some manifests of multi-arch images, e.g. "linux/amd64", "linux/arm/v7"
+	Platforms []string `mapstructure:"platforms"`
+}
+
+// HelmConfig defines the charts exported from Helm repositories
+type HelmConfig struct {
+	// Charts are chart name patterns, e.g. "ingress-*". All the charts of the repositories are exported when empty.
+	Charts []string `mapstructure:"charts"`
+	// Versions is a semver range, e.g. ">=1.2.0, <2.0.0", all versions when empty
+	Versions          string `mapstructure:"versions"`
+	IncludePrerelease bool   `mapstructure:"include_prerelease"`
+}
+
+// GoConfig defines the modules exported from Go repositories
+type GoConfig struct {
+	// Modules are path[@range] entries, e.g. "golang.org/x/text@>=0.14.0". A path pattern
+	// such as "golang.org/x/*" matches the modules of the go.sum files.
+	Modules []string `mapstructure:"modules"`
+	// GoSum are go.sum files whose module versions are exported, and used to verify the files
+	GoSum []string `mapstructure:"go_sum"`
+	// ChecksumDB is a file or a directory of checksum database lookups in the go.sum format
+	ChecksumDB        string `mapstructure:"checksum_db"`
+	LatestOnly        bool   `mapstructure:"latest_only"`
+	IncludePrerelease bool   `mapstructure:"include_prerelease"`
+}
+
+// parseMappings parses "repository=value" entries, keyed by repository name without slashes
+func parseMappings(mappings []string) map[string]string {
+	parsed := make(map[string]string, len(mappings))
+	for _, mapping := range mappings {
+		key, value, _ := strings.Cut(mapping, "=")
+		parsed[strings.Trim(strings.TrimSpace(key), "/")] = strings.Trim(strings.TrimSpace(value), "/")
+	}
+	return parsed
+}
+
+// TLSConfig defines the TLS settings used to connect to a server
+type TLSConfig struct {
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+	CAFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+}
+
 // GetValidAuthTypes returns the list of supported authentication types
 func GetValidAuthTypes() []string {
 	return []string{"none", "basic", "token"}
@@ -130,20 +565,78 @@ func (c *Config) GetFileTypesList() []string {
 // GetRepositoryList returns the list of repositories to download
 // It prioritizes the repositories defined in the TOML config over the repo_list file
 func (c *Config) GetRepositoryList() ([]string, error) {
+	return loadRepositoryList(c.Artifactory.Repositories, c.Artifactory.RepoList, c.General.OutputDir)
+}
+
+// GetSources returns the sources to export from.
+// Without any [[sources]] entry, the legacy [artifactory] section is used as the
+// only source and its files are written directly in the output directory.
+// Sources without their own auth, proxy or TLS settings inherit the global ones.
+func (c *Config) GetSources() []SourceConfig {
+	if len(c.Sources) == 0 {
+		return []SourceConfig{{
+			URL:          c.Artifactory.URL,
+			RepoList:     c.Artifactory.RepoList,
+			Repositories: c.Artifactory.Repositories,
+			Type:         c.Artifactory.Type,
+			Format:       c.Artifactory.Format,
+			Listing:      c.Artifactory.Listing,
+			Proxy:        c.Proxy,
+			Auth:         c.Auth,
+			TLS:          c.TLS,
+		}}
+	}
+
+	sources := make([]SourceConfig, len(c.Sources))
+	for i, src := range c.Sources {
+		if src.OutputSubdir == "" {
+			src.OutputSubdir = src.Name
+		}
+		if src.Type == "" {
+			src.Type = string(SourceArtifactory)
+		}
+		if src.Format == "" {
+			src.Format = string(FormatMaven)
+		}
+		if src.Listing == "" {
+			src.Listing = c.Artifactory.Listing
+		}
+		if src.Auth.Type == "" {
+			src.Auth = c.Auth
+		}
+		if !src.Proxy.Enabled && src.Proxy.Host == "" {
+			src.Proxy = c.Proxy
+		}
+		if src.TLS == (TLSConfig{}) {
+			src.TLS = c.TLS
+		}
+		sources[i] = src
+	}
+	return sources
+}
+
+// GetRepositoryList returns the list of repositories to download from the source
+// Relative repo_list paths are resolved against the output directory
+func (s *SourceConfig) GetRepositoryList(outputDir string) ([]string, error) {
+	return loadRepositoryList(s.Repositories, s.RepoList, outputDir)
+}
+
+// loadRepositoryList returns the configured repositories, or reads them from the repo list file
+func loadRepositoryList(repositories []string, repoList, outputDir string) ([]string, error) {
 	// If repositories are specified in the TOML file, use them
-	if len(c.Artifactory.Repositories) > 0 {
-		return c.Artifactory.Repositories, nil
+	if len(repositories) > 0 {
+		return repositories, nil
 	}
 
 	// Otherwise try to load from repo_list file
-	if c.Artifactory.RepoList == "" {
+	if repoList == "" {
 		return nil, errors.New("no repositories configured: neither 'repositories' nor 'repo_list' is set")
 	}
 
 	// Load from file
-	repoListPath := c.Artifactory.RepoList
+	repoListPath := repoList
 	if !filepath.IsAbs(repoListPath) {
-		repoListPath = filepath.Join(c.General.OutputDir, repoListPath)
+		repoListPath = filepath.Join(outputDir, repoListPath)
 	}
 
 	file, err := os.Open(repoListPath)
@@ -249,11 +742,20 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read configuration file: %w", err)
 	}
 
+	// Listing pages are no longer written to disk, so there is nothing to clean up
+	if viper.InConfig("files.clean_html_files") {
+		fmt.Fprintln(os.Stderr, "Warning: files.clean_html_files is deprecated and ignored, it can be removed from the configuration")
+	}
+
 	var cfg Config
 	if err := viper.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse configuration: %w", err)
 	}
 
+	if err := resolveSecrets(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to resolve secrets: %w", err)
+	}
+
 	if err := validateConfig(&cfg); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
@@ -267,36 +769,93 @@ func setDefaults() {
 	viper.SetDefault("general.log_path", "./logs")
 	viper.SetDefault("general.log_level", "info")
 	viper.SetDefault("general.concurrent_downloads", DefaultConcurrentDownloads)
+	viper.SetDefault("general.interval_minutes", 0)
 
 	viper.SetDefault("artifactory.url", "http://10.29.204.181:8082/artifactory/list/")
 	viper.SetDefault("artifactory.repo_list", "liste_arti.csv")
 	viper.SetDefault("artifactory.file_types", FileTypesDefault)
 	viper.SetDefault("artifactory.force_replace", false)
+	viper.SetDefault("artifactory.type", string(SourceArtifactory))
+	viper.SetDefault("artifactory.format", string(FormatMaven))
+	viper.SetDefault("artifactory.listing", string(ListingAuto))
 
 	viper.SetDefault("files.filter_mode", "none")
 	viper.SetDefault("files.include_maven_metadata", true)
-	viper.SetDefault("files.clean_html_files", true)
+	viper.SetDefault("files.regenerate_maven_metadata", false)
+	viper.SetDefault("files.include_gradle_metadata", false)
 
 	viper.SetDefault("download.retry_attempts", DefaultRetryAttempts)
 	viper.SetDefault("download.timeout", DefaultTimeout)
 	viper.SetDefault("download.use_wget", true)
 	viper.SetDefault("download.delay", DefaultDelay)
+	viper.SetDefault("download.max_idle_conns", DefaultMaxIdleConns)
+	viper.SetDefault("download.max_idle_conns_per_host", DefaultMaxIdleConnsPerHost)
+	viper.SetDefault("download.max_conns_per_host", 0)
+	viper.SetDefault("download.idle_conn_timeout", DefaultIdleConnTimeout)
+	viper.SetDefault("download.http2", true)
+	viper.SetDefault("download.max_depth", DefaultMaxDepth)
+	viper.SetDefault("download.max_redirects", DefaultMaxRedirects)
+	viper.SetDefault("download.min_free_space_mb", DefaultMinFreeSpaceMB)
+	viper.SetDefault("download.low_space_action", string(LowSpaceAbort))
 
 	viper.SetDefault("proxy.enabled", false)
 
+	viper.SetDefault("push.concurrent_uploads", DefaultConcurrentDownloads)
+	viper.SetDefault("push.auth.type", "none")
+
+	viper.SetDefault("migrate.concurrent_uploads", DefaultConcurrentDownloads)
+	viper.SetDefault("migrate.auth.type", "none")
+
+	viper.SetDefault("resolve.scopes", []string{"compile", "runtime"})
+
+	viper.SetDefault("npm.versions", string(NpmVersionsAll))
+	viper.SetDefault("npm.registry_url", "http://localhost:8080/")
+
+	viper.SetDefault("layout.mode", string(LayoutMirror))
+	viper.SetDefault("layout.conflict", string(ConflictFirst))
+
+	viper.SetDefault("archive.enabled", false)
+	viper.SetDefault("archive.format", string(archive.FormatTarGz))
+	viper.SetDefault("archive.max_volume_size_mb", 0)
+
+	viper.SetDefault("store.enabled", false)
+	viper.SetDefault("store.link", string(cas.LinkHardlink))
+
+	viper.SetDefault("cache.enabled", false)
+	viper.SetDefault("cache.max_size_mb", DefaultCacheMaxSizeMB)
+
+	viper.SetDefault("metrics.enabled", false)
+	viper.SetDefault("metrics.listen", DefaultMetricsListen)
+
 	viper.SetDefault("auth.type", "none")
 }
 
 // validateConfig validates the configuration for coherence
 func validateConfig(cfg *Config) error {
-	// Validate artifactory URL
-	if cfg.Artifactory.URL == "" {
-		return errors.New("artifactory URL cannot be empty")
+	// Validate sources
+	if len(cfg.Sources) == 0 {
+		// Validate artifactory URL
+		if cfg.Artifactory.URL == "" {
+			return errors.New("artifactory URL cannot be empty")
+		}
+
+		// Check either repositories in TOML or repo_list is provided
+		if len(cfg.Artifactory.Repositories) == 0 && cfg.Artifactory.RepoList == "" {
+			return errors.New("either 'repositories' or 'repo_list' must be specified in the configuration")
+		}
+
+		if !IsValidFormat(cfg.Artifactory.Format) {
+			return fmt.Errorf("invalid repository format '%s', must be one of: %s", cfg.Artifactory.Format, strings.Join(GetValidFormats(), ", "))
+		}
+		if err := validateSourceType(cfg.Artifactory.Type, cfg.Artifactory.Format); err != nil {
+			return err
+		}
+	} else if err := validateSources(cfg.Sources); err != nil {
+		return err
 	}
 
-	// Check either repositories in TOML or repo_list is provided
-	if len(cfg.Artifactory.Repositories) == 0 && cfg.Artifactory.RepoList == "" {
-		return errors.New("either 'repositories' or 'repo_list' must be specified in the configuration")
+	if !IsValidListingFormat(cfg.Artifactory.Listing) {
+		return fmt.Errorf("invalid listing format '%s', must be one of: %s", cfg.Artifactory.Listing, strings.Join(GetValidListingFormats(), ", "))
 	}
 
 	// Validate filter mode
@@ -304,6 +863,17 @@ func validateConfig(cfg *Config) error {
 		return fmt.Errorf("invalid filter mode '%s', must be one of: none, whitelist, blacklist", cfg.Files.FilterMode)
 	}
 
+	// Validate classifier patterns
+	for _, pattern := range append(append([]string(nil), cfg.Files.IncludeClassifiers...), cfg.Files.ExcludeClassifiers...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid classifier pattern '%s'", pattern)
+		}
+	}
+
+	if cfg.General.IntervalMinutes < 0 {
+		return errors.New("interval cannot be negative")
+	}
+
 	// Validate download configuration
 	if cfg.Download.RetryAttempts < 0 {
 		return errors.New("retry attempts cannot be negative")
@@ -317,18 +887,285 @@ func validateConfig(cfg *Config) error {
 		return errors.New("delay cannot be negative")
 	}
 
+	if cfg.Download.MaxIdleConns < 0 || cfg.Download.MaxIdleConnsPerHost < 0 || cfg.Download.MaxConnsPerHost < 0 {
+		return errors.New("connection pool sizes cannot be negative")
+	}
+
+	if cfg.Download.IdleConnTimeout < 0 {
+		return errors.New("idle connection timeout cannot be negative")
+	}
+
+	if cfg.Download.MaxDepth < 0 || cfg.Download.MaxRedirects < 0 {
+		return errors.New("max depth and max redirects cannot be negative")
+	}
+
+	if cfg.Download.MinFreeSpaceMB < 0 {
+		return errors.New("min free space cannot be negative")
+	}
+
+	if cfg.Download.LowSpaceAction != string(LowSpaceAbort) && cfg.Download.LowSpaceAction != string(LowSpacePause) {
+		return fmt.Errorf("invalid low space action '%s', must be one of: abort, pause", cfg.Download.LowSpaceAction)
+	}
+
+	// Validate archive configuration
+	if cfg.Archive.Enabled && !archive.IsValidFormat(cfg.Archive.Format) {
+		return fmt.Errorf("invalid archive format '%s', must be one of: tar.gz, tar.zst, zip", cfg.Archive.Format)
+	}
+
+	if cfg.Cache.MaxSizeMB < 0 {
+		return errors.New("cache max size cannot be negative")
+	}
+
+	if cfg.Metrics.Enabled && cfg.Metrics.Listen == "" {
+		return errors.New("metrics listen address cannot be empty")
+	}
+
+	// Validate content store configuration
+	if cfg.Store.Enabled {
+		if !cas.IsValidLinkMode(cfg.Store.Link) {
+			return fmt.Errorf("invalid store link mode '%s', must be one of: %s", cfg.Store.Link, strings.Join(cas.GetValidLinkModes(), ", "))
+		}
+		if cfg.Archive.Enabled {
+			return errors.New("the content store links the files of the output directory, it cannot be used with the archive output")
+		}
+	}
+
+	if cfg.Archive.MaxVolumeSizeMB < 0 {
+		return errors.New("archive max volume size cannot be negative")
+	}
+
+	// Validate layout configuration
+	if cfg.Layout.Mode != string(LayoutMirror) && cfg.Layout.Mode != string(LayoutMavenLocal) {
+		return fmt.Errorf("invalid layout mode '%s', must be one of: mirror, maven-local", cfg.Layout.Mode)
+	}
+
+	if cfg.Layout.Conflict != string(ConflictFirst) && cfg.Layout.Conflict != string(ConflictFail) {
+		return fmt.Errorf("invalid layout conflict policy '%s', must be one of: first, fail", cfg.Layout.Conflict)
+	}
+
+	if err := validateMappings(cfg.Layout.RepositoryIDs, "repository=id"); err != nil {
+		return fmt.Errorf("layout: %w", err)
+	}
+
+	// Validate push configuration, only used by the push command
+	if cfg.Push.URL != "" {
+		if err := validatePushConfig(&cfg.Push); err != nil {
+			return fmt.Errorf("push: %w", err)
+		}
+	}
+
+	// Validate migrate configuration, only used by the migrate command
+	if cfg.Migrate.URL != "" {
+		if err := validateMigrateConfig(&cfg.Migrate); err != nil {
+			return fmt.Errorf("migrate: %w", err)
+		}
+	}
+
+	// Validate resolve configuration
+	for _, scope := range cfg.Resolve.Scopes {
+		if scope != "compile" && scope != "runtime" && scope != "provided" && scope != "test" {
+			return fmt.Errorf("resolve: invalid scope '%s', must be one of: compile, runtime, provided, test", scope)
+		}
+	}
+
+	// Validate npm configuration
+	if cfg.Npm.Versions != string(NpmVersionsAll) && cfg.Npm.Versions != string(NpmVersionsLatest) {
+		return fmt.Errorf("npm: invalid versions '%s', must be one of: all, latest", cfg.Npm.Versions)
+	}
+	for _, spec := range cfg.Npm.Packages {
+		if _, versionRange := npm.ParseSpec(spec); versionRange != "" {
+			if _, err := npm.ParseRange(versionRange); err != nil {
+				return fmt.Errorf("npm: package %s: %w", spec, err)
+			}
+		}
+	}
+
+	// Validate PyPI configuration
+	for _, packageType := range cfg.PyPI.PackageTypes {
+		if packageType != "wheel" && packageType != "sdist" {
+			return fmt.Errorf("pypi: invalid package type '%s', must be one of: wheel, sdist", packageType)
+		}
+	}
+	for _, pattern := range append(append([]string(nil), cfg.PyPI.PythonTags...), cfg.PyPI.Platforms...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("pypi: invalid tag pattern '%s'", pattern)
+		}
+	}
+
+	// Validate Docker configuration
+	for _, pattern := range append(append([]string(nil), cfg.Docker.Tags...), cfg.Docker.Platforms...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("docker: invalid pattern '%s'", pattern)
+		}
+	}
+
+	// Validate Helm configuration
+	for _, pattern := range cfg.Helm.Charts {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("helm: invalid chart pattern '%s'", pattern)
+		}
+	}
+	if strings.TrimSpace(cfg.Helm.Versions) != "" {
+		if _, err := helm.ParseRange(cfg.Helm.Versions); err != nil {
+			return fmt.Errorf("helm: versions: %w", err)
+		}
+	}
+
+	// Validate Go configuration
+	for _, spec := range cfg.Go.Modules {
+		pattern, versionRange, _ := strings.Cut(spec, "@")
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("go: invalid module pattern '%s'", pattern)
+		}
+		if _, err := npm.ParseRange(versionRange); err != nil {
+			return fmt.Errorf("go: module %s: %w", spec, err)
+		}
+	}
+
 	// Validate proxy configuration
-	if cfg.Proxy.Enabled {
-		if cfg.Proxy.Host == "" {
+	if err := validateProxyConfig(&cfg.Proxy); err != nil {
+		return err
+	}
+
+	// Validate TLS configuration
+	if err := validateTLSConfig(&cfg.TLS); err != nil {
+		return err
+	}
+
+	// Validate authentication
+	return validateAuthConfig(&cfg.Auth)
+}
+
+// validateSourceType checks the type of a source, Nexus sources only supporting the maven format
+func validateSourceType(sourceType, format string) error {
+	switch SourceType(sourceType) {
+	case "", SourceArtifactory:
+		return nil
+	case SourceNexus:
+		if format != "" && format != string(FormatMaven) {
+			return fmt.Errorf("the %s format is not supported by nexus sources", format)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid source type '%s', must be one of: artifactory, nexus", sourceType)
+	}
+}
+
+// validateSources validates the [[sources]] entries
+func validateSources(sources []SourceConfig) error {
+	names := make(map[string]bool)
+	for i := range sources {
+		src := &sources[i]
+		if src.Name == "" {
+			return fmt.Errorf("source #%d: name cannot be empty", i+1)
+		}
+		if names[src.Name] {
+			return fmt.Errorf("source %s: duplicate source name", src.Name)
+		}
+		names[src.Name] = true
+
+		if src.URL == "" {
+			return fmt.Errorf("source %s: URL cannot be empty", src.Name)
+		}
+		if len(src.Repositories) == 0 && src.RepoList == "" {
+			return fmt.Errorf("source %s: either 'repositories' or 'repo_list' must be specified", src.Name)
+		}
+		if src.Format != "" && !IsValidFormat(src.Format) {
+			return fmt.Errorf("source %s: invalid repository format '%s', must be one of: %s", src.Name, src.Format, strings.Join(GetValidFormats(), ", "))
+		}
+		if err := validateSourceType(src.Type, src.Format); err != nil {
+			return fmt.Errorf("source %s: %w", src.Name, err)
+		}
+		if src.Listing != "" && !IsValidListingFormat(src.Listing) {
+			return fmt.Errorf("source %s: invalid listing format '%s', must be one of: %s", src.Name, src.Listing, strings.Join(GetValidListingFormats(), ", "))
+		}
+		if src.OutputSubdir != "" && (filepath.IsAbs(src.OutputSubdir) || strings.Contains(src.OutputSubdir, "..")) {
+			return fmt.Errorf("source %s: output_subdir must be a relative path inside the output directory", src.Name)
+		}
+
+		if err := validateProxyConfig(&src.Proxy); err != nil {
+			return fmt.Errorf("source %s: %w", src.Name, err)
+		}
+		if err := validateTLSConfig(&src.TLS); err != nil {
+			return fmt.Errorf("source %s: %w", src.Name, err)
+		}
+		// An empty auth type means the source inherits the global [auth] section
+		if src.Auth.Type != "" {
+			if err := validateAuthConfig(&src.Auth); err != nil {
+				return fmt.Errorf("source %s: %w", src.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validatePushConfig validates the push target configuration
+func validatePushConfig(push *PushConfig) error {
+	if push.Repository == "" {
+		return errors.New("target repository cannot be empty")
+	}
+	if push.ConcurrentUploads <= 0 {
+		return errors.New("concurrent uploads must be greater than 0")
+	}
+	if push.StripComponents < 0 {
+		return errors.New("strip components cannot be negative")
+	}
+	if err := validateProxyConfig(&push.Proxy); err != nil {
+		return err
+	}
+	if err := validateTLSConfig(&push.TLS); err != nil {
+		return err
+	}
+	return validateAuthConfig(&push.Auth)
+}
+
+// validateMigrateConfig validates the migration target configuration
+func validateMigrateConfig(migrate *MigrateConfig) error {
+	if err := validateMappings(migrate.RepositoryMap, "source=target"); err != nil {
+		return err
+	}
+	if migrate.ConcurrentUploads <= 0 {
+		return errors.New("concurrent uploads must be greater than 0")
+	}
+	if err := validateProxyConfig(&migrate.Proxy); err != nil {
+		return err
+	}
+	if err := validateTLSConfig(&migrate.TLS); err != nil {
+		return err
+	}
+	return validateAuthConfig(&migrate.Auth)
+}
+
+// validateMappings checks that every entry has the "key=value" form described by format
+func validateMappings(mappings []string, format string) error {
+	for _, mapping := range mappings {
+		key, value, ok := strings.Cut(mapping, "=")
+		if !ok || strings.Trim(strings.TrimSpace(key), "/") == "" || strings.Trim(strings.TrimSpace(value), "/") == "" {
+			return fmt.Errorf("invalid mapping '%s', must be %s", mapping, format)
+		}
+	}
+	return nil
+}
+
+// validateProxyConfig validates the proxy configuration
+func validateProxyConfig(proxy *ProxyConfig) error {
+	if proxy.Enabled {
+		if proxy.Host == "" {
 			return errors.New("proxy host cannot be empty when proxy is enabled")
 		}
-		if cfg.Proxy.Port <= 0 || cfg.Proxy.Port > 65535 {
+		if proxy.Port <= 0 || proxy.Port > 65535 {
 			return errors.New("proxy port must be between 1 and 65535")
 		}
 	}
+	return nil
+}
 
-	// Validate authentication
-	return validateAuthConfig(&cfg.Auth)
+// validateTLSConfig validates the TLS configuration
+func validateTLSConfig(tls *TLSConfig) error {
+	if (tls.CertFile == "") != (tls.KeyFile == "") {
+		return errors.New("tls cert_file and key_file must be set together")
+	}
+	return nil
 }
 
 // validateAuthConfig validates the authentication configuration
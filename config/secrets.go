@@ -0,0 +1,95 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// SecretFilePrefix marks a secret value that must be read from a file
+const SecretFilePrefix = "file:"
+
+// envRefPattern matches ${VAR} references inside a secret value
+var envRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// resolveSecret resolves a secret value from the configuration file.
+// ${VAR} references are replaced with the value of the environment variable,
+// then a value starting with "file:" is replaced with the content of the
+// referenced file (trailing newlines removed). Any other value is returned as is.
+// Errors only mention the field and the reference, never the secret itself.
+func resolveSecret(field, value string) (string, error) {
+	var missing string
+	resolved := envRefPattern.ReplaceAllStringFunc(value, func(ref string) string {
+		name := envRefPattern.FindStringSubmatch(ref)[1]
+		envValue, ok := os.LookupEnv(name)
+		if !ok && missing == "" {
+			missing = name
+		}
+		return envValue
+	})
+	if missing != "" {
+		return "", fmt.Errorf("%s: environment variable %s is not set", field, missing)
+	}
+
+	if !strings.HasPrefix(resolved, SecretFilePrefix) {
+		return resolved, nil
+	}
+
+	secretPath := strings.TrimSpace(strings.TrimPrefix(resolved, SecretFilePrefix))
+	if secretPath == "" {
+		return "", fmt.Errorf("%s: empty secret file path", field)
+	}
+
+	content, err := os.ReadFile(secretPath)
+	if err != nil {
+		// The path may come from an environment variable, only the configured reference is printed
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		return "", fmt.Errorf("%s: failed to read secret file %s: %w", field, value, err)
+	}
+
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// secretField is a configuration field that may hold a secret reference
+type secretField struct {
+	name  string
+	value *string
+}
+
+// credentialFields returns the secret fields of an auth and proxy section
+func credentialFields(prefix string, auth *AuthConfig, proxy *ProxyConfig) []secretField {
+	return []secretField{
+		{prefix + "auth.username", &auth.Username},
+		{prefix + "auth.password", &auth.Password},
+		{prefix + "auth.access_token", &auth.AccessToken},
+		{prefix + "proxy.username", &proxy.Username},
+		{prefix + "proxy.password", &proxy.Password},
+	}
+}
+
+// resolveSecrets resolves every secret field of the configuration in place
+func resolveSecrets(cfg *Config) error {
+	fields := credentialFields("", &cfg.Auth, &cfg.Proxy)
+	fields = append(fields, credentialFields("push.", &cfg.Push.Auth, &cfg.Push.Proxy)...)
+	fields = append(fields, credentialFields("migrate.", &cfg.Migrate.Auth, &cfg.Migrate.Proxy)...)
+	for i := range cfg.Sources {
+		src := &cfg.Sources[i]
+		fields = append(fields, credentialFields(fmt.Sprintf("sources[%d].", i), &src.Auth, &src.Proxy)...)
+	}
+
+	for _, field := range fields {
+		resolved, err := resolveSecret(field.name, *field.value)
+		if err != nil {
+			return err
+		}
+		*field.value = resolved
+	}
+
+	return nil
+}
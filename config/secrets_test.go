@@ -0,0 +1,66 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(secretFile, []byte("file-secret\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("REFAP_TEST_TOKEN", "env-secret")
+	t.Setenv("REFAP_TEST_USER", "alice")
+	t.Setenv("REFAP_TEST_TOKEN_FILE", secretFile)
+
+	for value, want := range map[string]string{
+		"plain":                                  "plain",
+		"":                                       "",
+		"${REFAP_TEST_TOKEN}":                    "env-secret",
+		"${REFAP_TEST_USER}:${REFAP_TEST_TOKEN}": "alice:env-secret",
+		"$REFAP_TEST_TOKEN":                      "$REFAP_TEST_TOKEN",
+		"file:" + secretFile:                     "file-secret",
+		"file: " + secretFile:                    "file-secret",
+		"file:${REFAP_TEST_TOKEN_FILE}":          "file-secret",
+	} {
+		got, err := resolveSecret("auth.password", value)
+		if err != nil || got != want {
+			t.Errorf("resolveSecret(%q) = %q, %v, want %q", value, got, err, want)
+		}
+	}
+}
+
+func TestResolveSecretErrorsDoNotLeakSecrets(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("REFAP_TEST_TOKEN", "env-secret")
+	// A path built from a secret must not be printed once resolved
+	t.Setenv("REFAP_TEST_SECRET_PATH", filepath.Join(dir, "env-secret"))
+	unreadable := filepath.Join(dir, "unreadable")
+	if err := os.Mkdir(unreadable, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for value, wantErr := range map[string]string{
+		"${REFAP_TEST_TOKEN}${REFAP_TEST_MISSING}": "environment variable REFAP_TEST_MISSING is not set",
+		"file:":                                 "empty secret file path",
+		"file:" + filepath.Join(dir, "missing"): "failed to read secret file",
+		"file:" + unreadable:                    "failed to read secret file",
+		"file:${REFAP_TEST_SECRET_PATH}":        "failed to read secret file file:${REFAP_TEST_SECRET_PATH}",
+	} {
+		_, err := resolveSecret("auth.password", value)
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("resolveSecret(%q) error = %v, want %q", value, err, wantErr)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), "auth.password: ") {
+			t.Errorf("resolveSecret(%q) error = %v, want the field name", value, err)
+		}
+		if strings.Contains(err.Error(), "env-secret") {
+			t.Errorf("resolveSecret(%q) error leaks the secret: %v", value, err)
+		}
+	}
+}
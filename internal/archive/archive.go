@@ -0,0 +1,374 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/caezarr-oss/refap/internal/pathutil"
+)
+
+// Format is the archive format of the export
+type Format string
+
+const (
+	// FormatTarGz is a gzip compressed tar archive
+	FormatTarGz Format = "tar.gz"
+	// FormatTarZst is a zstandard compressed tar archive
+	FormatTarZst Format = "tar.zst"
+	// FormatZip is a zip archive
+	FormatZip Format = "zip"
+)
+
+// IndexSuffix is appended to the archive base path to name the index file
+const IndexSuffix = ".index.json"
+
+// entryOverhead is the space reserved for the headers of an entry when
+// deciding whether it still fits in the current volume
+const entryOverhead = 1024
+
+// IsValidFormat checks if the archive format is supported
+func IsValidFormat(format string) bool {
+	return format == string(FormatTarGz) ||
+		format == string(FormatTarZst) ||
+		format == string(FormatZip)
+}
+
+// Entry describes an artifact stored in the archive
+type Entry struct {
+	Path   string `json:"path"`
+	Volume string `json:"volume"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Index lists the volumes of an archive and which volume holds which artifact
+type Index struct {
+	Format  Format   `json:"format"`
+	Volumes []string `json:"volumes"`
+	Entries []Entry  `json:"entries"`
+}
+
+// Writer streams artifacts into one or more archive volumes
+type Writer struct {
+	basePath      string
+	format        Format
+	maxVolumeSize int64
+
+	mu      sync.Mutex
+	volume  *volume
+	volumes []string
+	entries []Entry
+	names   map[string]bool
+	err     error // Failed write leaving the current volume incomplete
+}
+
+// volume is an archive file being written
+type volume struct {
+	name string
+	file *os.File
+	size int64 // Uncompressed bytes written, an upper bound of the volume size
+	tw   *tar.Writer
+	zw   *zip.Writer
+	comp io.WriteCloser
+}
+
+// NewWriter creates an archive writer.
+// Volumes are named after basePath with the format extension. When maxVolumeSize
+// is greater than 0, the archive is split in numbered volumes of at most that
+// many bytes, except for single artifacts bigger than the limit.
+func NewWriter(basePath string, format Format, maxVolumeSize int64) (*Writer, error) {
+	if !IsValidFormat(string(format)) {
+		return nil, fmt.Errorf("unsupported archive format: %s", format)
+	}
+	if err := pathutil.EnsureDirectoryExists(filepath.Dir(basePath)); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	return &Writer{
+		basePath:      basePath,
+		format:        format,
+		maxVolumeSize: maxVolumeSize,
+		names:         make(map[string]bool),
+	}, nil
+}
+
+// Has reports whether an artifact was already added to the archive
+func (w *Writer) Has(name string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.names[name]
+}
+
+// Lookup returns the index entry of an artifact already added to the archive
+func (w *Writer) Lookup(name string) (Entry, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, entry := range w.entries {
+		if entry.Path == name {
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Add writes an artifact into the archive under the given slash separated name.
+// When size is unknown (negative), the content is spooled to a temporary file
+// first since tar headers need the size before the content. Otherwise r must
+// hold the whole content, such as a downloaded file: an entry cannot be removed
+// from a volume, so a failed write leaves the volume incomplete and every
+// following call, Close included, returns the error.
+func (w *Writer) Add(name string, size int64, modTime time.Time, r io.Reader) (Entry, error) {
+	name = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+	if name == "" {
+		return Entry{}, errors.New("empty archive entry name")
+	}
+
+	if size < 0 {
+		spool, spooledSize, err := spoolToTempFile(r)
+		if err != nil {
+			return Entry{}, err
+		}
+		defer func() {
+			spool.Close()
+			os.Remove(spool.Name())
+		}()
+		r, size = spool, spooledSize
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return Entry{}, w.err
+	}
+	if w.names[name] {
+		return Entry{}, fmt.Errorf("duplicate archive entry: %s", name)
+	}
+
+	if err := w.ensureVolume(size); err != nil {
+		return Entry{}, err
+	}
+
+	hash := sha256.New()
+	written, err := w.volume.writeEntry(name, size, modTime, io.TeeReader(r, hash))
+	w.volume.size += written + entryOverhead
+	if err != nil {
+		w.err = fmt.Errorf("archive volume %s is incomplete, failed to write %s: %w", w.volume.name, name, err)
+		return Entry{}, w.err
+	}
+
+	entry := Entry{
+		Path:   name,
+		Volume: w.volume.name,
+		Size:   written,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}
+	w.entries = append(w.entries, entry)
+	w.names[name] = true
+	return entry, nil
+}
+
+// Entries returns the artifacts added so far
+func (w *Writer) Entries() []Entry {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]Entry(nil), w.entries...)
+}
+
+// Volumes returns the paths of the volumes created so far
+func (w *Writer) Volumes() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	volumes := make([]string, len(w.volumes))
+	for i, name := range w.volumes {
+		volumes[i] = filepath.Join(filepath.Dir(w.basePath), name)
+	}
+	return volumes
+}
+
+// Format returns the archive format of the volumes
+func (w *Writer) Format() Format {
+	return w.format
+}
+
+// BasePath returns the base path of the volumes, without extension
+func (w *Writer) BasePath() string {
+	return w.basePath
+}
+
+// IndexPath returns the path of the index file written by Close
+func (w *Writer) IndexPath() string {
+	return w.basePath + IndexSuffix
+}
+
+// Close finishes the current volume and writes the index file, which only lists
+// the complete entries. It returns the error of a failed Add.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.volume != nil {
+		if err := w.volume.close(); err != nil && w.err == nil {
+			return err
+		}
+		w.volume = nil
+	}
+
+	index := Index{
+		Format:  w.format,
+		Volumes: w.volumes,
+		Entries: w.entries,
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(w.IndexPath(), data, 0644); err != nil {
+		return err
+	}
+	return w.err
+}
+
+// ensureVolume opens a volume able to hold an entry of the given size
+func (w *Writer) ensureVolume(size int64) error {
+	if w.volume != nil {
+		if w.maxVolumeSize <= 0 || w.volume.size == 0 || w.volume.size+size+entryOverhead <= w.maxVolumeSize {
+			return nil
+		}
+		if err := w.volume.close(); err != nil {
+			return err
+		}
+		w.volume = nil
+	}
+
+	name := filepath.Base(w.basePath) + "." + string(w.format)
+	if w.maxVolumeSize > 0 {
+		name = fmt.Sprintf("%s.%03d.%s", filepath.Base(w.basePath), len(w.volumes)+1, w.format)
+	}
+
+	vol, err := openVolume(filepath.Join(filepath.Dir(w.basePath), name), w.format)
+	if err != nil {
+		return err
+	}
+	vol.name = name
+	w.volume = vol
+	w.volumes = append(w.volumes, name)
+	return nil
+}
+
+// openVolume creates a new archive file
+func openVolume(filePath string, format Format) (*volume, error) {
+	file, err := pathutil.SafeCreateFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive volume: %w", err)
+	}
+
+	vol := &volume{file: file}
+	switch format {
+	case FormatTarGz:
+		vol.comp = gzip.NewWriter(file)
+		vol.tw = tar.NewWriter(vol.comp)
+	case FormatTarZst:
+		enc, err := zstd.NewWriter(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		vol.comp = enc
+		vol.tw = tar.NewWriter(vol.comp)
+	case FormatZip:
+		vol.zw = zip.NewWriter(file)
+	}
+	return vol, nil
+}
+
+// writeEntry writes one artifact of the given size to the volume and returns its size
+func (v *volume) writeEntry(name string, size int64, modTime time.Time, r io.Reader) (int64, error) {
+	if v.zw != nil {
+		header := &zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: modTime,
+		}
+		fw, err := v.zw.CreateHeader(header)
+		if err != nil {
+			return 0, err
+		}
+		written, err := io.Copy(fw, r)
+		if err == nil && written != size {
+			err = fmt.Errorf("expected %d bytes, got %d", size, written)
+		}
+		return written, err
+	}
+
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  modTime,
+		Format:   tar.FormatPAX,
+	}
+	if err := v.tw.WriteHeader(header); err != nil {
+		return 0, err
+	}
+	written, err := io.CopyN(v.tw, r, size)
+	if err != nil {
+		return written, fmt.Errorf("expected %d bytes, got %d: %w", size, written, err)
+	}
+	return written, nil
+}
+
+// close flushes and closes the volume
+func (v *volume) close() error {
+	var err error
+	if v.zw != nil {
+		err = v.zw.Close()
+	} else {
+		err = v.tw.Close()
+		if cerr := v.comp.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := v.file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to close archive volume %s: %w", v.name, err)
+	}
+	return nil
+}
+
+// spoolToTempFile copies a reader of unknown size to a temporary file
+func spoolToTempFile(r io.Reader) (*os.File, int64, error) {
+	spool, err := os.CreateTemp("", "refap-spool-*")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create spool file: %w", err)
+	}
+
+	size, err := io.Copy(spool, r)
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		spool.Close()
+		os.Remove(spool.Name())
+		return nil, 0, fmt.Errorf("failed to spool archive entry: %w", err)
+	}
+	return spool, size, nil
+}
@@ -0,0 +1,216 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readIndex reads the index written by Close
+func readIndex(t *testing.T, w *Writer) Index {
+	t.Helper()
+	data, err := os.ReadFile(w.IndexPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+// readVolume returns the content of each file of a volume
+func readVolume(t *testing.T, volumePath string, format Format) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := Walk(volumePath, format, func(name string, size int64, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if int64(len(data)) != size {
+			t.Errorf("%s: read %d bytes, header says %d", name, len(data), size)
+		}
+		files[name] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	files := map[string]string{
+		"libs/org/acme/lib/1.0/lib-1.0.jar": strings.Repeat("jar content ", 100),
+		"libs/org/acme/lib/1.0/lib-1.0.pom": "<project/>",
+		"libs/empty.txt":                    "",
+	}
+	for _, format := range []Format{FormatTarGz, FormatTarZst, FormatZip} {
+		t.Run(string(format), func(t *testing.T) {
+			w, err := NewWriter(filepath.Join(t.TempDir(), "export"), format, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, content := range files {
+				size := int64(len(content))
+				var r io.Reader = strings.NewReader(content)
+				if strings.HasSuffix(name, ".pom") {
+					// A content of unknown size is spooled first
+					size, r = -1, io.MultiReader(r)
+				}
+				if _, err := w.Add(name, size, time.Now(), r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := w.Add("/libs/empty.txt", 0, time.Now(), strings.NewReader("")); err == nil {
+				t.Error("duplicate entry added")
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			index := readIndex(t, w)
+			wantVolume := "export." + string(format)
+			if index.Format != format || len(index.Volumes) != 1 || index.Volumes[0] != wantVolume {
+				t.Fatalf("index = %+v, want a single %s volume", index, wantVolume)
+			}
+			if len(index.Entries) != len(files) {
+				t.Errorf("index lists %d entries, want %d", len(index.Entries), len(files))
+			}
+			for _, entry := range index.Entries {
+				content := files[entry.Path]
+				if entry.Volume != wantVolume || entry.Size != int64(len(content)) || entry.SHA256 != sha256Hex(content) {
+					t.Errorf("index entry %+v does not match the content of %s", entry, entry.Path)
+				}
+			}
+
+			got := readVolume(t, w.Volumes()[0], format)
+			if len(got) != len(files) {
+				t.Errorf("volume holds %d files, want %d", len(got), len(files))
+			}
+			for name, content := range files {
+				if got[name] != content {
+					t.Errorf("%s read back as %q, want %q", name, got[name], content)
+				}
+			}
+		})
+	}
+}
+
+func TestWriterSplitsVolumes(t *testing.T) {
+	for _, format := range []Format{FormatTarGz, FormatZip} {
+		t.Run(string(format), func(t *testing.T) {
+			w, err := NewWriter(filepath.Join(t.TempDir(), "export"), format, 4000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Each file and its header overhead fill more than half a volume, the
+			// last one being bigger than a volume on its own
+			names := []string{"a.jar", "b.jar", "c.jar", "big.jar"}
+			contents := map[string]string{
+				"a.jar":   strings.Repeat("a", 1500),
+				"b.jar":   strings.Repeat("b", 1500),
+				"c.jar":   strings.Repeat("c", 100),
+				"big.jar": strings.Repeat("d", 5000),
+			}
+			for _, name := range names {
+				content := contents[name]
+				if _, err := w.Add(name, int64(len(content)), time.Now(), strings.NewReader(content)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			index := readIndex(t, w)
+			ext := "." + string(format)
+			wantVolumes := []string{"export.001" + ext, "export.002" + ext, "export.003" + ext}
+			if strings.Join(index.Volumes, ",") != strings.Join(wantVolumes, ",") {
+				t.Fatalf("volumes = %v, want %v", index.Volumes, wantVolumes)
+			}
+			wantEntryVolume := map[string]string{
+				"a.jar":   wantVolumes[0],
+				"b.jar":   wantVolumes[1],
+				"c.jar":   wantVolumes[1],
+				"big.jar": wantVolumes[2],
+			}
+			for _, entry := range index.Entries {
+				if entry.Volume != wantEntryVolume[entry.Path] {
+					t.Errorf("%s in %s, want %s", entry.Path, entry.Volume, wantEntryVolume[entry.Path])
+				}
+			}
+
+			// Each volume holds the entries the index assigns to it
+			for i, volumePath := range w.Volumes() {
+				for name, content := range readVolume(t, volumePath, format) {
+					if wantEntryVolume[name] != wantVolumes[i] || content != contents[name] {
+						t.Errorf("%s read from %s, want it in %s", name, wantVolumes[i], wantEntryVolume[name])
+					}
+				}
+			}
+		})
+	}
+}
+
+// failingReader returns its content, then an error
+type failingReader struct {
+	r io.Reader
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestWriterFailsOnIncompleteEntry(t *testing.T) {
+	for _, format := range []Format{FormatTarGz, FormatTarZst, FormatZip} {
+		for reason, r := range map[string]func() io.Reader{
+			"read error": func() io.Reader { return &failingReader{strings.NewReader("partial")} },
+			"short read": func() io.Reader { return bytes.NewReader([]byte("partial")) },
+		} {
+			t.Run(string(format)+" "+reason, func(t *testing.T) {
+				w, err := NewWriter(filepath.Join(t.TempDir(), "export"), format, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := w.Add("complete.jar", 8, time.Now(), strings.NewReader("complete")); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := w.Add("partial.jar", 100, time.Now(), r()); err == nil {
+					t.Fatal("incomplete entry added")
+				}
+				// The incomplete volume is not written to any more
+				if _, err := w.Add("other.jar", 5, time.Now(), strings.NewReader("other")); err == nil {
+					t.Error("entry added after a failed write")
+				}
+				if err := w.Close(); err == nil {
+					t.Error("archive closed without the error of the failed write")
+				}
+
+				index := readIndex(t, w)
+				if len(index.Entries) != 1 || index.Entries[0].Path != "complete.jar" {
+					t.Errorf("index entries = %+v, want complete.jar only", index.Entries)
+				}
+			})
+		}
+	}
+}
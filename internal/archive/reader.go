@@ -0,0 +1,91 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// WalkFunc is called for each regular file of an archive volume
+type WalkFunc func(name string, size int64, r io.Reader) error
+
+// Walk calls fn for each regular file of an archive volume, in archive order.
+// Walking stops at the first error returned by fn.
+func Walk(volumePath string, format Format, fn WalkFunc) error {
+	if format == FormatZip {
+		return walkZip(volumePath, fn)
+	}
+
+	file, err := os.Open(volumePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive volume: %w", err)
+	}
+	defer file.Close()
+
+	var decompressed io.Reader
+	switch format {
+	case FormatTarGz:
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to read archive volume %s: %w", volumePath, err)
+		}
+		defer gz.Close()
+		decompressed = gz
+	case FormatTarZst:
+		dec, err := zstd.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to read archive volume %s: %w", volumePath, err)
+		}
+		defer dec.Close()
+		decompressed = dec
+	default:
+		return fmt.Errorf("unsupported archive format: %s", format)
+	}
+
+	tr := tar.NewReader(decompressed)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive volume %s: %w", volumePath, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(header.Name, header.Size, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// walkZip calls fn for each regular file of a zip volume
+func walkZip(volumePath string, fn WalkFunc) error {
+	zr, err := zip.OpenReader(volumePath)
+	if err != nil {
+		return fmt.Errorf("failed to read archive volume %s: %w", volumePath, err)
+	}
+	defer zr.Close()
+
+	for _, file := range zr.File {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("failed to read %s from archive volume %s: %w", file.Name, volumePath, err)
+		}
+		err = fn(file.Name, int64(file.UncompressedSize64), rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package bundle
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/caezarr-oss/refap/internal/archive"
+	"github.com/caezarr-oss/refap/internal/pathutil"
+)
+
+// ImportOptions defines how a bundle is imported
+type ImportOptions struct {
+	ManifestPath    string
+	PublicKey       ed25519.PublicKey
+	TargetDir       string
+	StripComponents int // Leading path components removed from each entry, like tar
+}
+
+// ImportResult holds the statistics of an import
+type ImportResult struct {
+	Files int
+	Bytes int64
+}
+
+// Import verifies a bundle and unpacks it into the target directory.
+// The manifest signature and the hash of every volume are checked first, then
+// each artifact is extracted to a staging directory and checked against its
+// hash. Files are only moved into the target directory once the whole bundle
+// has been verified, so a tampered bundle leaves the target untouched.
+func Import(opts ImportOptions) (ImportResult, error) {
+	manifest, err := ReadManifest(opts.ManifestPath, opts.PublicKey)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	bundleDir := filepath.Dir(opts.ManifestPath)
+	if err := verifyVolumes(bundleDir, manifest.Volumes); err != nil {
+		return ImportResult{}, err
+	}
+
+	// Map each manifest entry to its destination path
+	expected := make(map[string]archive.Entry, len(manifest.Entries))
+	targets := make(map[string]string, len(manifest.Entries))
+	seenTargets := make(map[string]string, len(manifest.Entries))
+	for _, entry := range manifest.Entries {
+		target, err := entryTarget(entry.Path, opts.StripComponents)
+		if err != nil {
+			return ImportResult{}, err
+		}
+		if _, ok := expected[entry.Path]; ok {
+			return ImportResult{}, fmt.Errorf("duplicate manifest entry %s", entry.Path)
+		}
+		if other, ok := seenTargets[target]; ok {
+			return ImportResult{}, fmt.Errorf("entries %s and %s have the same destination %s", other, entry.Path, target)
+		}
+		expected[entry.Path] = entry
+		targets[entry.Path] = target
+		seenTargets[target] = entry.Path
+	}
+
+	if err := pathutil.EnsureDirectoryExists(opts.TargetDir); err != nil {
+		return ImportResult{}, fmt.Errorf("failed to create target directory: %w", err)
+	}
+	stagingDir, err := os.MkdirTemp(opts.TargetDir, ".refap-import-")
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	// Extract and verify every artifact
+	verified := make(map[string]bool, len(expected))
+	for _, volume := range manifest.Volumes {
+		volumePath := filepath.Join(bundleDir, volume.Name)
+		err := archive.Walk(volumePath, manifest.Format, func(name string, size int64, r io.Reader) error {
+			entry, ok := expected[name]
+			// Entries missing from the manifest, or already verified, are never extracted
+			if !ok || verified[name] || entry.Volume != volume.Name {
+				return nil
+			}
+			match, err := stageEntry(filepath.Join(stagingDir, filepath.FromSlash(targets[name])), entry, r)
+			if err != nil {
+				return err
+			}
+			verified[name] = match
+			return nil
+		})
+		if err != nil {
+			return ImportResult{}, err
+		}
+	}
+
+	for name := range expected {
+		if !verified[name] {
+			return ImportResult{}, fmt.Errorf("bundle rejected: %s is missing or does not match its hash", name)
+		}
+	}
+
+	// Move the verified files into the target directory
+	var result ImportResult
+	for name, entry := range expected {
+		staged := filepath.Join(stagingDir, filepath.FromSlash(targets[name]))
+		target, err := pathutil.JoinWithin(opts.TargetDir, targets[name])
+		if err != nil {
+			return result, fmt.Errorf("failed to move %s into the target directory: %w", name, err)
+		}
+		if err := pathutil.EnsureDirectoryExists(filepath.Dir(target)); err != nil {
+			return result, err
+		}
+		if err := os.Rename(staged, target); err != nil {
+			return result, fmt.Errorf("failed to move %s into the target directory: %w", name, err)
+		}
+		result.Files++
+		result.Bytes += entry.Size
+	}
+
+	return result, nil
+}
+
+// verifyVolumes checks the size and hash of every volume of the bundle
+func verifyVolumes(bundleDir string, volumes []Volume) error {
+	for _, volume := range volumes {
+		if volume.Name != filepath.Base(volume.Name) || volume.Name == ".." {
+			return fmt.Errorf("bundle rejected: invalid volume name %s", volume.Name)
+		}
+		size, hash, err := hashFile(filepath.Join(bundleDir, volume.Name))
+		if err != nil {
+			return fmt.Errorf("bundle rejected: %w", err)
+		}
+		if size != volume.Size || hash != volume.SHA256 {
+			return fmt.Errorf("bundle rejected: volume %s does not match its hash", volume.Name)
+		}
+	}
+	return nil
+}
+
+// entryTarget returns the relative destination path of an entry after
+// removing the leading components. Entries escaping the target are refused.
+func entryTarget(name string, stripComponents int) (string, error) {
+	if name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, "\\") {
+		return "", fmt.Errorf("bundle rejected: unsafe entry path %q", name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." || part == "." || part == "" {
+			return "", fmt.Errorf("bundle rejected: unsafe entry path %q", name)
+		}
+	}
+
+	parts := strings.Split(name, "/")
+	if stripComponents >= len(parts) {
+		return "", fmt.Errorf("cannot strip %d components from %s", stripComponents, name)
+	}
+	return path.Join(parts[stripComponents:]...), nil
+}
+
+// stageEntry extracts an entry to the staging path and reports whether it
+// matches the size and hash of the manifest
+func stageEntry(stagingPath string, entry archive.Entry, r io.Reader) (bool, error) {
+	if err := pathutil.EnsureDirectoryExists(filepath.Dir(stagingPath)); err != nil {
+		return false, err
+	}
+
+	partPath := stagingPath + ".part"
+	file, err := os.Create(partPath)
+	if err != nil {
+		return false, err
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), r)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(partPath)
+		return false, fmt.Errorf("failed to extract %s: %w", entry.Path, err)
+	}
+
+	if size != entry.Size || hex.EncodeToString(hash.Sum(nil)) != entry.SHA256 {
+		os.Remove(partPath)
+		return false, nil
+	}
+	if err := os.Rename(partPath, stagingPath); err != nil {
+		return false, fmt.Errorf("failed to stage %s: %w", entry.Path, err)
+	}
+	return true, nil
+}
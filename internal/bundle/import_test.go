@@ -0,0 +1,265 @@
+package bundle
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caezarr-oss/refap/internal/archive"
+)
+
+// bundleFiles are the artifacts of the test bundles
+var bundleFiles = map[string]string{
+	"libs-release/org/acme/lib/1.0/lib-1.0.jar": "jar content",
+	"libs-release/org/acme/lib/1.0/lib-1.0.pom": "<project/>",
+}
+
+// newBundle writes a signed bundle of bundleFiles and returns its manifest path and key
+func newBundle(t *testing.T) (string, ed25519.PrivateKey) {
+	t.Helper()
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := archive.NewWriter(filepath.Join(t.TempDir(), "bundle"), archive.FormatTarGz, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range bundleFiles {
+		if _, err := w.Add(name, int64(len(content)), time.Now(), strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	manifestPath, err := Create(w, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manifestPath, privateKey
+}
+
+// editManifest changes the manifest of a bundle, signing it again when privateKey is set
+func editManifest(t *testing.T, manifestPath string, privateKey ed25519.PrivateKey, edit func(*Manifest)) {
+	t.Helper()
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	edit(&manifest)
+	if data, err = json.MarshalIndent(manifest, "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if privateKey != nil {
+		signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, data))
+		if err := os.WriteFile(signaturePath(manifestPath), []byte(signature+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newTarget returns a target directory holding a file of a previous import
+func newTarget(t *testing.T) string {
+	t.Helper()
+	targetDir := t.TempDir()
+	previous := filepath.Join(targetDir, "libs-release", "previous.jar")
+	if err := os.MkdirAll(filepath.Dir(previous), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(previous, []byte("previous"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return targetDir
+}
+
+// checkUntouched fails when the target directory holds anything but the file of newTarget
+func checkUntouched(t *testing.T, targetDir string) {
+	t.Helper()
+	err := filepath.WalkDir(targetDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() && (p == targetDir || p == filepath.Join(targetDir, "libs-release")) {
+			return err
+		}
+		rel, _ := filepath.Rel(targetDir, p)
+		if rel != filepath.Join("libs-release", "previous.jar") {
+			t.Errorf("%s written to the target directory", rel)
+			return nil
+		}
+		if data, _ := os.ReadFile(p); string(data) != "previous" {
+			t.Errorf("%s changed to %q", rel, data)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The escaping entries would have been written next to the target directory
+	if _, err := os.Stat(filepath.Join(filepath.Dir(targetDir), "escaped.jar")); err == nil {
+		t.Error("a file was written out of the target directory")
+	}
+}
+
+func TestImport(t *testing.T) {
+	manifestPath, privateKey := newBundle(t)
+	targetDir := newTarget(t)
+
+	result, err := Import(ImportOptions{
+		ManifestPath: manifestPath,
+		PublicKey:    privateKey.Public().(ed25519.PublicKey),
+		TargetDir:    targetDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Files != len(bundleFiles) {
+		t.Errorf("%d files imported, want %d", result.Files, len(bundleFiles))
+	}
+	for name, content := range bundleFiles {
+		data, err := os.ReadFile(filepath.Join(targetDir, filepath.FromSlash(name)))
+		if err != nil || string(data) != content {
+			t.Errorf("%s imported as %q (%v), want %q", name, data, err, content)
+		}
+	}
+}
+
+func TestImportRejectsTamperedBundles(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		tamper func(t *testing.T, manifestPath string, privateKey ed25519.PrivateKey) ed25519.PublicKey
+		want   string
+	}{
+		{
+			name: "bad signature",
+			tamper: func(t *testing.T, manifestPath string, privateKey ed25519.PrivateKey) ed25519.PublicKey {
+				otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return otherKey
+			},
+			want: "signature verification failed",
+		},
+		{
+			name: "tampered manifest",
+			tamper: func(t *testing.T, manifestPath string, privateKey ed25519.PrivateKey) ed25519.PublicKey {
+				editManifest(t, manifestPath, nil, func(m *Manifest) {
+					m.Entries[0].Path = "libs-release/org/acme/lib/1.0/other.jar"
+				})
+				return privateKey.Public().(ed25519.PublicKey)
+			},
+			want: "signature verification failed",
+		},
+		{
+			name: "changed volume",
+			tamper: func(t *testing.T, manifestPath string, privateKey ed25519.PrivateKey) ed25519.PublicKey {
+				volumePath := strings.TrimSuffix(manifestPath, ManifestSuffix) + ".tar.gz"
+				data, err := os.ReadFile(volumePath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				data[len(data)/2] ^= 0xff
+				if err := os.WriteFile(volumePath, data, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return privateKey.Public().(ed25519.PublicKey)
+			},
+			want: "does not match its hash",
+		},
+		{
+			name: "changed artifact hash",
+			tamper: func(t *testing.T, manifestPath string, privateKey ed25519.PrivateKey) ed25519.PublicKey {
+				editManifest(t, manifestPath, privateKey, func(m *Manifest) {
+					m.Entries[1].SHA256 = strings.Repeat("0", 64)
+				})
+				return privateKey.Public().(ed25519.PublicKey)
+			},
+			want: "does not match its hash",
+		},
+		{
+			name: "entry escaping the target",
+			tamper: func(t *testing.T, manifestPath string, privateKey ed25519.PrivateKey) ed25519.PublicKey {
+				editManifest(t, manifestPath, privateKey, func(m *Manifest) {
+					m.Entries = append(m.Entries, archive.Entry{Path: "../escaped.jar", Volume: m.Volumes[0].Name})
+				})
+				return privateKey.Public().(ed25519.PublicKey)
+			},
+			want: "unsafe entry path",
+		},
+		{
+			name: "absolute entry",
+			tamper: func(t *testing.T, manifestPath string, privateKey ed25519.PrivateKey) ed25519.PublicKey {
+				editManifest(t, manifestPath, privateKey, func(m *Manifest) {
+					m.Entries[0].Path = "/" + m.Entries[0].Path
+				})
+				return privateKey.Public().(ed25519.PublicKey)
+			},
+			want: "unsafe entry path",
+		},
+		{
+			name: "volume escaping the bundle",
+			tamper: func(t *testing.T, manifestPath string, privateKey ed25519.PrivateKey) ed25519.PublicKey {
+				editManifest(t, manifestPath, privateKey, func(m *Manifest) {
+					m.Volumes[0].Name = "../" + m.Volumes[0].Name
+				})
+				return privateKey.Public().(ed25519.PublicKey)
+			},
+			want: "invalid volume name",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			manifestPath, privateKey := newBundle(t)
+			publicKey := tc.tamper(t, manifestPath, privateKey)
+			targetDir := newTarget(t)
+
+			_, err := Import(ImportOptions{ManifestPath: manifestPath, PublicKey: publicKey, TargetDir: targetDir})
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("err = %v, want %q", err, tc.want)
+			}
+			checkUntouched(t, targetDir)
+		})
+	}
+}
+
+func TestEntryTarget(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		strip int
+		want  string
+	}{
+		{"libs-release/org/acme/lib.jar", 0, "libs-release/org/acme/lib.jar"},
+		{"libs-release/org/acme/lib.jar", 1, "org/acme/lib.jar"},
+		{"libs-release/lib.jar", 2, ""},
+		{"../lib.jar", 0, ""},
+		{"libs-release/../../lib.jar", 1, ""},
+		{"libs-release/./lib.jar", 0, ""},
+		{"libs-release//lib.jar", 0, ""},
+		{"/etc/passwd", 0, ""},
+		{"libs-release\\..\\lib.jar", 0, ""},
+		{"", 0, ""},
+	} {
+		got, err := entryTarget(tc.name, tc.strip)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("entryTarget(%q, %d) = %q, want an error", tc.name, tc.strip, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("entryTarget(%q, %d) = %q, %v, want %q", tc.name, tc.strip, got, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package bundle
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/caezarr-oss/refap/internal/archive"
+)
+
+// ManifestVersion is the version of the manifest format
+const ManifestVersion = 1
+
+const (
+	// ManifestSuffix is appended to the archive base path to name the manifest
+	ManifestSuffix = ".manifest.json"
+	// SignatureSuffix is appended to the archive base path to name the manifest signature
+	SignatureSuffix = ".manifest.sig"
+)
+
+// Volume describes an archive volume of the bundle
+type Volume struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest lists the volumes and artifacts of a bundle with their sha256 hashes
+type Manifest struct {
+	Version int             `json:"version"`
+	Created time.Time       `json:"created"`
+	Format  archive.Format  `json:"format"`
+	Volumes []Volume        `json:"volumes"`
+	Entries []archive.Entry `json:"entries"`
+}
+
+// Create writes the signed manifest of a closed archive.
+// The manifest is written next to the volumes and signed with the ed25519
+// private key, the base64 signature being stored in a separate file.
+// It returns the path of the manifest.
+func Create(w *archive.Writer, privateKey ed25519.PrivateKey) (string, error) {
+	manifest := Manifest{
+		Version: ManifestVersion,
+		Created: time.Now().UTC(),
+		Format:  w.Format(),
+		Entries: w.Entries(),
+	}
+
+	for _, volumePath := range w.Volumes() {
+		size, hash, err := hashFile(volumePath)
+		if err != nil {
+			return "", err
+		}
+		manifest.Volumes = append(manifest.Volumes, Volume{
+			Name:   filepath.Base(volumePath),
+			Size:   size,
+			SHA256: hash,
+		})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	manifestPath := w.BasePath() + ManifestSuffix
+	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, data))
+	if err := os.WriteFile(signaturePath(manifestPath), []byte(signature+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("failed to write manifest signature: %w", err)
+	}
+
+	return manifestPath, nil
+}
+
+// ReadManifest reads a manifest and checks its signature with the public key.
+// Nothing from the manifest is trusted before the signature is verified.
+func ReadManifest(manifestPath string, publicKey ed25519.PublicKey) (*Manifest, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	encoded, err := os.ReadFile(signaturePath(manifestPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest signature: %w", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest signature encoding: %w", err)
+	}
+
+	if !ed25519.Verify(publicKey, data, signature) {
+		return nil, errors.New("manifest signature verification failed")
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if manifest.Version != ManifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", manifest.Version)
+	}
+	if !archive.IsValidFormat(string(manifest.Format)) {
+		return nil, fmt.Errorf("unsupported archive format %s", manifest.Format)
+	}
+	return &manifest, nil
+}
+
+// signaturePath returns the path of the signature of a manifest
+func signaturePath(manifestPath string) string {
+	return strings.TrimSuffix(manifestPath, ManifestSuffix) + SignatureSuffix
+}
+
+// hashFile returns the size and hex sha256 hash of a file
+func hashFile(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
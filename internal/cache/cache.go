@@ -0,0 +1,312 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caezarr-oss/refap/internal/pathutil"
+)
+
+// Cache is a download cache shared by the runs of every configuration and output
+// directory. File contents are stored once at objects/<ab>/<sha256>, and the URLs
+// they were downloaded from at urls/<ab>/<sha256 of the URL>.json with their ETag.
+// The modification time of the objects records their last use, the least recently
+// used ones being evicted when the cache grows over its maximum size.
+type Cache struct {
+	dir     string
+	maxSize int64
+
+	mu   sync.Mutex
+	size int64
+}
+
+// Entry is a URL of the cache
+type Entry struct {
+	URL          string `json:"url"`
+	SHA256       string `json:"sha256"`
+	Size         int64  `json:"size"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// Open opens the cache at dir, creating it if needed. maxSize is the size in
+// bytes above which objects are evicted, 0 for no limit.
+func Open(dir string, maxSize int64) (*Cache, error) {
+	for _, sub := range []string{"objects", "urls", "tmp"} {
+		if err := pathutil.EnsureDirectoryExists(filepath.Join(dir, sub)); err != nil {
+			return nil, fmt.Errorf("failed to create download cache %s: %w", dir, err)
+		}
+	}
+	c := &Cache{dir: dir, maxSize: maxSize}
+	objects, err := c.objects()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read download cache %s: %w", dir, err)
+	}
+	for _, object := range objects {
+		c.size += object.size
+	}
+	return c, nil
+}
+
+// Dir returns the directory of the cache
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Lookup returns the entry of a URL, if its content is still in the cache
+func (c *Cache) Lookup(url string) (Entry, bool) {
+	data, err := os.ReadFile(c.urlPath(url))
+	if err != nil {
+		return Entry{}, false
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.URL != url {
+		return Entry{}, false
+	}
+	if _, ok := c.Has(entry.SHA256); !ok {
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+// Has returns the size of the content with the given sha256, and whether the cache holds it
+func (c *Cache) Has(sum string) (int64, bool) {
+	objectPath, ok := c.objectPath(sum)
+	if !ok {
+		return 0, false
+	}
+	info, err := os.Stat(objectPath)
+	if err != nil || !info.Mode().IsRegular() {
+		return 0, false
+	}
+	return info.Size(), true
+}
+
+// Open opens the content with the given sha256 and marks it as used
+func (c *Cache) Open(sum string) (*os.File, int64, error) {
+	objectPath, ok := c.objectPath(sum)
+	if !ok {
+		return nil, 0, fmt.Errorf("invalid sha256 %s", sum)
+	}
+	file, err := os.Open(objectPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	now := time.Now()
+	os.Chtimes(objectPath, now, now)
+	return file, info.Size(), nil
+}
+
+// Body returns the body of a download response, whose content is added to the
+// cache for the URL when it has been read entirely
+func (c *Cache) Body(url string, resp *http.Response) io.ReadCloser {
+	temp, err := os.CreateTemp(filepath.Join(c.dir, "tmp"), ".download-*")
+	if err != nil {
+		return resp.Body
+	}
+	return &body{
+		ReadCloser: resp.Body,
+		cache:      c,
+		temp:       temp,
+		hash:       sha256.New(),
+		expected:   resp.ContentLength,
+		entry: Entry{
+			URL:          url,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		},
+	}
+}
+
+// body copies a response body into a temporary file of the cache while it is read
+type body struct {
+	io.ReadCloser
+	cache    *Cache
+	temp     *os.File
+	hash     hash.Hash
+	expected int64
+	entry    Entry
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.temp != nil && n > 0 {
+		if _, writeErr := b.temp.Write(p[:n]); writeErr != nil {
+			b.discard()
+		} else {
+			b.hash.Write(p[:n])
+			b.entry.Size += int64(n)
+		}
+	}
+	if b.temp != nil && err == io.EOF {
+		if b.expected < 0 || b.entry.Size == b.expected {
+			b.entry.SHA256 = hex.EncodeToString(b.hash.Sum(nil))
+			if commitErr := b.cache.commit(b.temp, b.entry); commitErr != nil {
+				fmt.Printf("Failed to add %s to the download cache: %v\n", b.entry.URL, commitErr)
+			}
+		}
+		b.discard()
+	}
+	return n, err
+}
+
+func (b *body) Close() error {
+	b.discard()
+	return b.ReadCloser.Close()
+}
+
+// discard removes the temporary file, which was moved into the cache if it was committed
+func (b *body) discard() {
+	if b.temp == nil {
+		return
+	}
+	b.temp.Close()
+	os.Remove(b.temp.Name())
+	b.temp = nil
+}
+
+// commit moves a downloaded file into the objects and records its URL
+func (c *Cache) commit(temp *os.File, entry Entry) error {
+	objectPath, _ := c.objectPath(entry.SHA256)
+	if err := pathutil.EnsureDirectoryExists(filepath.Dir(objectPath)); err != nil {
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	added := false
+	if _, err := os.Stat(objectPath); err != nil {
+		if err := os.Chmod(temp.Name(), 0644); err != nil {
+			return err
+		}
+		if err := os.Rename(temp.Name(), objectPath); err != nil {
+			return err
+		}
+		added = true
+	} else {
+		now := time.Now()
+		os.Chtimes(objectPath, now, now)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	urlPath := c.urlPath(entry.URL)
+	if err := pathutil.EnsureDirectoryExists(filepath.Dir(urlPath)); err != nil {
+		return err
+	}
+	// The entry is renamed into place, as other runs may read it
+	tempEntry, err := os.CreateTemp(filepath.Join(c.dir, "tmp"), ".url-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempEntry.Name())
+	if _, err := tempEntry.Write(data); err != nil {
+		tempEntry.Close()
+		return err
+	}
+	if err := tempEntry.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tempEntry.Name(), urlPath); err != nil {
+		return err
+	}
+
+	if added {
+		c.mu.Lock()
+		c.size += entry.Size
+		overSize := c.maxSize > 0 && c.size > c.maxSize
+		c.mu.Unlock()
+		if overSize {
+			return c.evict()
+		}
+	}
+	return nil
+}
+
+// object is a content of the cache
+type object struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// objects lists the contents of the cache
+func (c *Cache) objects() ([]object, error) {
+	var objects []object
+	err := filepath.WalkDir(filepath.Join(c.dir, "objects"), func(objectPath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		objects = append(objects, object{path: objectPath, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	return objects, err
+}
+
+// evict removes the least recently used contents until the cache fits in its maximum
+// size. The URLs of the removed contents are dropped when they are looked up.
+func (c *Cache) evict() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	objects, err := c.objects()
+	if err != nil {
+		return err
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].modTime.Before(objects[j].modTime) })
+
+	c.size = 0
+	for _, object := range objects {
+		c.size += object.size
+	}
+	for _, object := range objects {
+		if c.size <= c.maxSize {
+			break
+		}
+		if err := os.Remove(object.path); err == nil {
+			fmt.Printf("Evicting %s from the download cache\n", filepath.Base(object.path))
+			c.size -= object.size
+		}
+	}
+	return nil
+}
+
+// objectPath returns the path of the content with the given sha256
+func (c *Cache) objectPath(sum string) (string, bool) {
+	sum = strings.ToLower(sum)
+	if decoded, err := hex.DecodeString(sum); err != nil || len(decoded) != sha256.Size {
+		return "", false
+	}
+	return filepath.Join(c.dir, "objects", sum[:2], sum), true
+}
+
+// urlPath returns the path of the entry of a URL
+func (c *Cache) urlPath(url string) string {
+	key := sha256.Sum256([]byte(url))
+	name := hex.EncodeToString(key[:])
+	return filepath.Join(c.dir, "urls", name[:2], name+".json")
+}
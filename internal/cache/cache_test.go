@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// response returns a download response of the content, with the given Content-Length
+func response(content string, contentLength int64, header http.Header) *http.Response {
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(content)),
+		ContentLength: contentLength,
+	}
+}
+
+// download reads the body of a response of the content entirely through the cache
+func download(t *testing.T, c *Cache, url, content string) {
+	t.Helper()
+	body := c.Body(url, response(content, int64(len(content)), nil))
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := body.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Fatalf("body = %q, want %q", data, content)
+	}
+}
+
+func sha256Of(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkNoTemporaryFiles checks that the downloads left no file in the tmp directory
+func checkNoTemporaryFiles(t *testing.T, c *Cache) {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(c.Dir(), "tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("%d temporary files left", len(entries))
+	}
+}
+
+func TestBodyCommitsCompleteReads(t *testing.T) {
+	c, err := Open(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := "lib content"
+	header := http.Header{"Etag": {`"v1"`}, "Last-Modified": {"Tue, 12 Mar 2024 10:15:00 GMT"}}
+	body := c.Body("http://repo/lib-1.0.jar", response(content, int64(len(content)), header))
+	if _, err := io.ReadAll(body); err != nil {
+		t.Fatal(err)
+	}
+	body.Close()
+
+	entry, ok := c.Lookup("http://repo/lib-1.0.jar")
+	want := Entry{URL: "http://repo/lib-1.0.jar", SHA256: sha256Of(content), Size: int64(len(content)), ETag: `"v1"`, LastModified: "Tue, 12 Mar 2024 10:15:00 GMT"}
+	if !ok || entry != want {
+		t.Errorf("Lookup = %+v, %v, want %+v", entry, ok, want)
+	}
+	file, size, err := c.Open(entry.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil || string(data) != content || size != int64(len(content)) {
+		t.Errorf("content = %q, %d bytes, %v, want %q", data, size, err, content)
+	}
+	checkNoTemporaryFiles(t, c)
+}
+
+func TestBodyDiscardsIncompleteReads(t *testing.T) {
+	c, err := Open(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := "lib content"
+
+	// Closed before the end of the content
+	body := c.Body("http://repo/closed.jar", response(content, int64(len(content)), nil))
+	if _, err := body.Read(make([]byte, 3)); err != nil {
+		t.Fatal(err)
+	}
+	body.Close()
+
+	// Shorter than its Content-Length, as when the connection is lost
+	body = c.Body("http://repo/truncated.jar", response(content, int64(len(content))+10, nil))
+	if _, err := io.ReadAll(body); err != nil {
+		t.Fatal(err)
+	}
+	body.Close()
+
+	for _, url := range []string{"http://repo/closed.jar", "http://repo/truncated.jar"} {
+		if entry, ok := c.Lookup(url); ok {
+			t.Errorf("Lookup(%s) = %+v, want the incomplete read not cached", url, entry)
+		}
+	}
+	if _, ok := c.Has(sha256Of(content)); ok {
+		t.Error("the content of an incomplete read is cached")
+	}
+	checkNoTemporaryFiles(t, c)
+}
+
+func TestCommitEvictsLeastRecentlyUsedContents(t *testing.T) {
+	dir := t.TempDir()
+	c, err := Open(dir, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	download(t, c, "http://repo/a.jar", "aaaaaaaaaa")
+	download(t, c, "http://repo/b.jar", "bbbbbbbbbb")
+
+	// a was added first, but used after b
+	past := time.Now().Add(-time.Hour)
+	for _, content := range []string{"aaaaaaaaaa", "bbbbbbbbbb"} {
+		objectPath, _ := c.objectPath(sha256Of(content))
+		if err := os.Chtimes(objectPath, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file, _, err := c.Open(sha256Of("aaaaaaaaaa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	// The third content exceeds the maximum size of 25 bytes, b is evicted
+	download(t, c, "http://repo/c.jar", "cccccccccc")
+	for url, want := range map[string]bool{"http://repo/a.jar": true, "http://repo/b.jar": false, "http://repo/c.jar": true} {
+		if _, ok := c.Lookup(url); ok != want {
+			t.Errorf("Lookup(%s) = %v, want %v", url, ok, want)
+		}
+	}
+
+	// The size of the remaining contents is read again when the cache is opened
+	reopened, err := Open(dir, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.size != 20 {
+		t.Errorf("size = %d, want 20", reopened.size)
+	}
+}
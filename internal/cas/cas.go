@@ -0,0 +1,150 @@
+package cas
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/caezarr-oss/refap/internal/pathutil"
+)
+
+// LinkMode is the way the files of the store are linked into the export tree
+type LinkMode string
+
+const (
+	// LinkHardlink links the files with hard links
+	LinkHardlink LinkMode = "hardlink"
+	// LinkReflink clones the files with reflinks, which requires a copy-on-write filesystem
+	LinkReflink LinkMode = "reflink"
+	// LinkAuto clones the files with reflinks when the filesystem supports them, and uses hard links otherwise
+	LinkAuto LinkMode = "auto"
+)
+
+// GetValidLinkModes returns the list of supported link modes
+func GetValidLinkModes() []string {
+	return []string{string(LinkHardlink), string(LinkReflink), string(LinkAuto)}
+}
+
+// IsValidLinkMode checks if the link mode is valid
+func IsValidLinkMode(mode string) bool {
+	for _, valid := range GetValidLinkModes() {
+		if mode == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// Store is a content-addressable store holding one copy of each file, keyed by
+// the hex sha256 of its content at <dir>/sha256/<first 2 characters>/<sha256>.
+// The files of the export are links to the files of the store.
+type Store struct {
+	dir  string
+	mode LinkMode
+}
+
+// Open opens the store at dir, creating the directory if needed
+func Open(dir string, mode LinkMode) (*Store, error) {
+	if !IsValidLinkMode(string(mode)) {
+		return nil, fmt.Errorf("invalid link mode %q", mode)
+	}
+	if err := pathutil.EnsureDirectoryExists(dir); err != nil {
+		return nil, fmt.Errorf("failed to create content store %s: %w", dir, err)
+	}
+	return &Store{dir: dir, mode: mode}, nil
+}
+
+// Dir returns the directory of the store
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Size returns the size of the file with the given sha256, and whether the store holds it
+func (s *Store) Size(sum string) (int64, bool) {
+	filePath, err := s.path(sum)
+	if err != nil {
+		return 0, false
+	}
+	info, err := os.Stat(filePath)
+	if err != nil || !info.Mode().IsRegular() {
+		return 0, false
+	}
+	return info.Size(), true
+}
+
+// Put moves a file whose content has the given sha256 into the store. The file is
+// left in place when the store already holds the content.
+func (s *Store) Put(file, sum string) error {
+	filePath, err := s.path(sum)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.Size(sum); ok {
+		return nil
+	}
+	if err := pathutil.EnsureDirectoryExists(filepath.Dir(filePath)); err != nil {
+		return err
+	}
+	// Stored files are shared by all their links, whatever the file they come from
+	if err := os.Chmod(file, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(file, filePath); err != nil {
+		return fmt.Errorf("failed to add %s to the content store: %w", sum, err)
+	}
+	return nil
+}
+
+// Link makes target a link to the file of the store with the given sha256,
+// replacing the file target already holds
+func (s *Store) Link(sum, target string) error {
+	filePath, err := s.path(sum)
+	if err != nil {
+		return err
+	}
+	if stored, err := os.Stat(filePath); err != nil {
+		return fmt.Errorf("content %s is not in the store: %w", sum, err)
+	} else if existing, err := os.Stat(target); err == nil && os.SameFile(stored, existing) {
+		return nil
+	}
+
+	// The link is created next to the target then renamed over it, so that a
+	// previous file is replaced rather than written through
+	if err := pathutil.EnsureDirectoryExists(filepath.Dir(target)); err != nil {
+		return err
+	}
+	linkPath := target + ".refap-link"
+	os.Remove(linkPath)
+	switch s.mode {
+	case LinkHardlink:
+		err = os.Link(filePath, linkPath)
+	case LinkReflink:
+		err = reflink(filePath, linkPath)
+	default:
+		if err = reflink(filePath, linkPath); err != nil {
+			os.Remove(linkPath)
+			err = os.Link(filePath, linkPath)
+		}
+	}
+	if err != nil {
+		os.Remove(linkPath)
+		return fmt.Errorf("failed to link %s from the content store: %w", target, err)
+	}
+	if err := os.Rename(linkPath, target); err != nil {
+		os.Remove(linkPath)
+		return err
+	}
+	return nil
+}
+
+// path returns the path of the file with the given sha256
+func (s *Store) path(sum string) (string, error) {
+	sum = strings.ToLower(sum)
+	if decoded, err := hex.DecodeString(sum); err != nil || len(decoded) != 32 {
+		return "", errors.New("invalid sha256 " + sum)
+	}
+	return filepath.Join(s.dir, "sha256", sum[:2], sum), nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package cas
+
+import "errors"
+
+// reflink is only supported on Linux
+func reflink(src, dst string) error {
+	return errors.New("reflinks are not supported on this platform")
+}
@@ -0,0 +1,99 @@
+package crawler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/caezarr-oss/refap/internal/cache"
+)
+
+// fetchFile performs a GET request on the URL of a file like fetch, going through
+// the download cache when there is one. A file whose sha256 is known, or reported by
+// the X-Checksum-Sha256 header of a HEAD request, is read from the cache when it holds
+// the content, and a file cached for the URL is revalidated with its ETag. The files
+// downloaded are added to the cache while they are read. The Gradle module metadata
+// already read by readGradleModule is not downloaded again. The caller must close
+// the response body.
+func (c *Crawler) fetchFile(urlStr, sum string) (*http.Response, error) {
+	c.cacheHit = false
+	if resp, ok := c.gradleModules[urlStr]; ok {
+		delete(c.gradleModules, urlStr)
+		return resp, nil
+	}
+	if c.config.Cache == nil {
+		return c.fetch(urlStr)
+	}
+	if resp, ok := c.cachedResponse(urlStr, cache.Entry{SHA256: sum}); ok {
+		return resp, nil
+	}
+
+	header := make(http.Header)
+	cached, isCached := c.config.Cache.Lookup(urlStr)
+	if isCached && cached.ETag != "" {
+		header.Set("If-None-Match", cached.ETag)
+	} else if sum == "" {
+		// The content may be cached for another URL, its sha256 is asked before downloading it
+		remote := c.head(urlStr)
+		entry := cache.Entry{SHA256: strings.ToLower(remote.Get("X-Checksum-Sha256")), LastModified: remote.Get("Last-Modified")}
+		if resp, ok := c.cachedResponse(urlStr, entry); ok {
+			return resp, nil
+		}
+	}
+	resp, err := c.fetchWithHeaders(urlStr, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		if resp, ok := c.cachedResponse(urlStr, cached); ok {
+			return resp, nil
+		}
+		// The content was evicted since the lookup
+		return c.fetch(urlStr)
+	}
+	resp.Body = c.config.Cache.Body(urlStr, resp)
+	return resp, nil
+}
+
+// countDownload counts a file exported by a download, unless fetchFile read it from
+// the download cache, where it is counted already
+func (c *Crawler) countDownload(written int64) {
+	if c.cacheHit {
+		return
+	}
+	c.summary.FilesDownloaded++
+	c.summary.BytesDownloaded += written
+}
+
+// cachedResponse returns a response reading the content of the cache with the sha256
+// of the entry, and whether the cache holds it
+func (c *Crawler) cachedResponse(urlStr string, entry cache.Entry) (*http.Response, bool) {
+	if entry.SHA256 == "" {
+		return nil, false
+	}
+	file, size, err := c.config.Cache.Open(entry.SHA256)
+	if err != nil {
+		return nil, false
+	}
+	c.summary.FilesFromCache++
+	c.summary.BytesFromCache += size
+	c.cacheHit = true
+
+	req, _ := http.NewRequest(http.MethodGet, urlStr, nil)
+	header := make(http.Header)
+	if entry.LastModified != "" {
+		header.Set("Last-Modified", entry.LastModified)
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          file,
+		ContentLength: size,
+		Request:       req,
+	}, true
+}
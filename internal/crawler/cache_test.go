@@ -0,0 +1,91 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/caezarr-oss/refap/config"
+	"github.com/caezarr-oss/refap/internal/cache"
+)
+
+// exportCached exports a repository with a new crawler using the download cache,
+// checks the file it holds and returns the summary
+func exportCached(t *testing.T, source *httptest.Server, downloads *cache.Cache, repo, relPath, content string) Summary {
+	t.Helper()
+	c := newTestCrawler(t, source, Config{FilterMode: config.FilterModeBlacklist, Cache: downloads})
+	if err := c.ProcessRepositories([]string{repo}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(c.config.BaseDir, repo, filepath.FromSlash(relPath)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Errorf("%s/%s holds %q, want %q", repo, relPath, data, content)
+	}
+	return c.Summary()
+}
+
+func openCache(t *testing.T) *cache.Cache {
+	t.Helper()
+	downloads, err := cache.Open(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return downloads
+}
+
+func TestFetchFileRevalidatesCachedFilesWithTheirETag(t *testing.T) {
+	content := "lib content"
+	stub, source := newListingStub(t, map[string]string{"libs/lib-1.0.jar": content})
+	stub.headers["libs/lib-1.0.jar"] = http.Header{"Etag": {`"v1"`}}
+	downloads := openCache(t)
+
+	first := exportCached(t, source, downloads, "libs", "lib-1.0.jar", content)
+	if first.FilesDownloaded != 1 || first.FilesFromCache != 0 {
+		t.Errorf("first summary = %+v, want the file downloaded", first)
+	}
+
+	// The second export only revalidates the file, which is counted once, as read from the cache
+	second := exportCached(t, source, downloads, "libs", "lib-1.0.jar", content)
+	if second.FilesDownloaded != 0 || second.BytesDownloaded != 0 || second.FilesFromCache != 1 || second.BytesFromCache != int64(len(content)) {
+		t.Errorf("second summary = %+v, want the file read from the cache only", second)
+	}
+	if n := stub.count(http.MethodGet, "libs/lib-1.0.jar"); n != 2 {
+		t.Errorf("file requested %d times, want a download and a revalidation", n)
+	}
+}
+
+func TestFetchFileReadsContentCachedForAnotherURL(t *testing.T) {
+	content := "shared lib content"
+	sum := sha256.Sum256([]byte(content))
+	stub, source := newListingStub(t, map[string]string{
+		"libs-a/lib-1.0.jar": content,
+		"libs-b/lib-1.0.jar": content,
+	})
+	for _, relPath := range []string{"libs-a/lib-1.0.jar", "libs-b/lib-1.0.jar"} {
+		stub.headers[relPath] = http.Header{"X-Checksum-Sha256": {hex.EncodeToString(sum[:])}}
+	}
+	downloads := openCache(t)
+
+	if summary := exportCached(t, source, downloads, "libs-a", "lib-1.0.jar", content); summary.FilesDownloaded != 1 {
+		t.Errorf("libs-a summary = %+v, want the file downloaded", summary)
+	}
+	summary := exportCached(t, source, downloads, "libs-b", "lib-1.0.jar", content)
+	if summary.FilesDownloaded != 0 || summary.FilesFromCache != 1 {
+		t.Errorf("libs-b summary = %+v, want the file read from the cache only", summary)
+	}
+
+	// The checksum is asked with a HEAD request, the content is not downloaded
+	if n := stub.count(http.MethodHead, "libs-b/lib-1.0.jar"); n != 1 {
+		t.Errorf("libs-b file HEAD requested %d times, want once", n)
+	}
+	if n := stub.count(http.MethodGet, "libs-b/lib-1.0.jar"); n != 0 {
+		t.Errorf("libs-b file downloaded %d times, want read from the cache", n)
+	}
+}
@@ -2,16 +2,24 @@ package crawler
 
 import (
 	"bufio"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/caezarr-oss/refap/config"
+	"github.com/caezarr-oss/refap/internal/archive"
+	"github.com/caezarr-oss/refap/internal/cache"
+	"github.com/caezarr-oss/refap/internal/cas"
+	"github.com/caezarr-oss/refap/internal/diskspace"
+	"github.com/caezarr-oss/refap/internal/httpclient"
 	"github.com/caezarr-oss/refap/internal/pathutil"
 )
 
@@ -25,6 +33,12 @@ type Config struct {
 	Timeout         int
 	UseWget         bool
 	Delay           int
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     int
+	HTTP2               bool
+	TLSConfig           *tls.Config
 	ProxyEnabled    bool
 	ProxyHost       string
 	ProxyPort       int
@@ -37,160 +51,261 @@ type Config struct {
 	FilterMode      config.FilterMode
 	Extensions      []string
 	IncludeMavenMetadata bool
-	CleanHTMLFiles  bool
+	// RegenerateMavenMetadata rebuilds the maven-metadata.xml files from the exported
+	// files instead of copying them from the server
+	RegenerateMavenMetadata bool
+	// IncludeGradleMetadata exports the .module files with the variant files they reference
+	IncludeGradleMetadata bool
+	// Classifiers to include or exclude, as path.Match patterns. Files without classifier are always included.
+	IncludeClassifiers []string
+	ExcludeClassifiers []string
+
+	// npm export: packages as name[@range], all the packages of the repositories when empty.
+	// NpmRegistryURL is the URL the exported repository is served at, used for the tarball URLs.
+	NpmPackages          []string
+	NpmLatestOnly        bool
+	NpmIncludePrerelease bool
+	NpmRegistryURL       string
+
+	// PyPI export: projects, all the projects of the repositories when empty, and
+	// filters on the package type (wheel, sdist) and the wheel tags, as path.Match patterns
+	PyPIProjects     []string
+	PyPIPackageTypes []string
+	PyPIPythonTags   []string
+	PyPIPlatforms    []string
+
+	// Docker export: images as name[:tag pattern], all the images of the repositories
+	// when empty, and filters on the tags and the platforms of multi-arch images
+	DockerImages    []string
+	DockerTags      []string
+	DockerPlatforms []string
+
+	// Helm export: chart name patterns, all the charts of the repositories when empty,
+	// and a semver range of the exported versions
+	HelmCharts            []string
+	HelmVersions          string
+	HelmIncludePrerelease bool
+
+	// Go export: modules as path[@range], whose path may be a pattern matching the modules
+	// of the go.sum files, go.sum files whose versions are exported, and a checksum
+	// database dump, all the hashes being used to verify the downloaded files
+	GoModules           []string
+	GoSumFiles          []string
+	GoChecksumDB        string
+	GoLatestOnly        bool
+	GoIncludePrerelease bool
+
+	// ListingFormat selects the ListingParsers entry reading the listing pages,
+	// the parser being detected from each listing when it is not found, e.g. "auto"
+	ListingFormat string
+
+	// MaxDepth is the deepest directory crawled below a repository, 0 for no limit.
+	// MaxRedirects is the number of redirects followed by a request.
+	MaxDepth     int
+	MaxRedirects int
+
+	// MinFreeSpace is the free space in bytes kept on the filesystem of the export, 0 to
+	// disable the checks. LowSpaceAction tells whether the export pauses or aborts below it.
+	MinFreeSpace   int64
+	LowSpaceAction config.LowSpaceAction
+
+	// SourceType is config.SourceNexus for Nexus 3 servers, listed through their REST API,
+	// ArtiURL being the base URL of their repositories, e.g. https://nexus.example.com/repository/
+	SourceType config.SourceType
+
+	// Layout organizes the exported files, one subtree per repository by default.
+	// RepositoryIDs gives the Maven repository id of renamed repositories.
+	Layout         config.LayoutMode
+	ConflictPolicy config.ConflictPolicy
+	RepositoryIDs  map[string]string
+
+	// Archive receives the downloaded files instead of BaseDir when set.
+	// Entries are named ArchivePrefix followed by their path relative to BaseDir.
+	Archive       *archive.Writer
+	ArchivePrefix string
+
+	// Store holds the content of the files written to BaseDir, which are links to it
+	Store *cas.Store
+	// Cache is the download cache shared with other runs, when set
+	Cache *cache.Cache
+
+	// Metrics receive the statistics of the export, when set. MetricsSource labels
+	// them, as several sources may hold repositories of the same name.
+	Metrics       *Metrics
+	MetricsSource string
 }
 
 // New creates a new Crawler with the provided configuration
 func New(config Config) *Crawler {
 	return &Crawler{
 		config: config,
-		htmlFiles: make([]string, 0),
+		client: httpclient.New(httpclient.Options{
+			Timeout:             config.Timeout,
+			MaxIdleConns:        config.MaxIdleConns,
+			MaxIdleConnsPerHost: config.MaxIdleConnsPerHost,
+			MaxConnsPerHost:     config.MaxConnsPerHost,
+			IdleConnTimeout:     config.IdleConnTimeout,
+			HTTP2:               config.HTTP2,
+			TLSConfig:           config.TLSConfig,
+			ProxyEnabled:        config.ProxyEnabled,
+			ProxyHost:           config.ProxyHost,
+			ProxyPort:           config.ProxyPort,
+			ProxyUsername:       config.ProxyUsername,
+			ProxyPassword:       config.ProxyPassword,
+			MaxRedirects:        config.MaxRedirects,
+		}),
+		remoteMetadata: make(map[string][]byte),
+		mavenOrigins:   make(map[string]map[string]map[string]bool),
+		foreignHosts:   make(map[string]bool),
+		gradleModules:  make(map[string]*http.Response),
 	}
 }
 
-// Crawler handles the artifactory crawling operations
+// Crawler handles the artifactory crawling operations.
+// A Crawler keeps the statistics and state of its run and is not safe for concurrent use.
 type Crawler struct {
 	config Config
-	htmlFiles []string // List of all HTML index files created
+	client *http.Client // Shared by all requests to reuse connections
+	summary Summary
+	baseDir string // Absolute base directory of the export
+	spaceErr error // Lack of free disk space which aborted the export
+
+	// Repository being exported, statistics already published to the metrics
+	// and number of files listed and not exported yet
+	repo      string
+	published Summary
+	queue     int
+
+	// Metadata found on the server when it is regenerated, by export path
+	remoteMetadata map[string][]byte
+
+	// Repository ids of the files of the maven-local layout, by directory and file name
+	mavenOrigins map[string]map[string]map[string]bool
+
+	// Hosts other than the source already requested without credentials
+	foreignHosts map[string]bool
+
+	// Gradle module metadata read to find the files it references, by URL, with its
+	// content as body, exported without downloading it again
+	gradleModules map[string]*http.Response
+
+	// Whether the last file of fetchFile was read from the download cache, which
+	// counts it, so that it is not counted as downloaded as well
+	cacheHit bool
 }
 
-// ParseIndex parses an HTML index file and downloads all referenced files
-func (c *Crawler) ParseIndex(file, path, artiURL string) error {
-	// Sanitize file and path for Windows compatibility
-	safeFile := pathutil.SanitizePath(file)
-	safePath := pathutil.SanitizePath(path)
-	
-	// Add the HTML file to the list for potential cleanup later
-	absPath, err := filepath.Abs(safeFile)
-	if err == nil {
-		c.htmlFiles = append(c.htmlFiles, absPath)
+// Summary returns the statistics of the repositories processed so far
+func (c *Crawler) Summary() Summary {
+	return c.summary
+}
+
+// exportEntry downloads a file found by Walk into the archive or the output directory.
+// It reports whether the file is available in the export.
+func (c *Crawler) exportEntry(entry Entry) bool {
+	if c.config.RegenerateMavenMetadata && isMavenMetadata(path.Base(entry.Path)) {
+		c.keepMavenMetadata(entry)
+		return true
 	}
 
-	// Detect encoding and read file
-	f, err := os.Open(safeFile)
-	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+	if c.config.Layout == config.LayoutMavenLocal {
+		return c.exportMavenLocal(entry)
+	}
+
+	// Each repository keeps its own subtree
+	target := c.target(path.Join(strings.Trim(entry.Repo, "/"), entry.Path))
+	if c.exists(target) && (c.config.Archive != nil || !c.config.ForceReplace) {
+		c.summary.FilesSkipped++
+		return true
 	}
-	defer f.Close()
+	return c.saveEntry(entry, target)
+}
 
-	// Change to the specified directory
-	if err := os.Chdir(safePath); err != nil {
-		return fmt.Errorf("failed to change directory to %s: %w", safePath, err)
+// target returns the archive entry name, or the file path below the base
+// directory, of a slash separated path of the export. Paths leading outside of
+// the base directory are refused by checkTarget before writing.
+func (c *Crawler) target(relPath string) string {
+	if c.config.Archive != nil {
+		return path.Join(c.config.ArchivePrefix, relPath)
 	}
+	return pathutil.SafeJoin(c.baseDir, filepath.FromSlash(relPath))
+}
 
-	// Read the file line by line
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := strings.TrimLeft(strings.Replace(scanner.Text(), "\t", "", -1), " ")
-
-		// Check if the line starts with "<a href=" or "<pre><a href="
-		if strings.HasPrefix(line, "<a href=") || strings.HasPrefix(line, "<pre><a href=") {
-			// Extract href value
-			hrefStartIndex := strings.Index(line, "href=") + len("href=")
-			if hrefStartIndex < len("href=") {
-				continue
-			}
-			
-			hrefEndIndex := strings.Index(line[hrefStartIndex:], "\"")
-			if hrefEndIndex < 0 {
-				continue
-			}
-			hrefEndIndex += hrefStartIndex
-			urlValue := line[hrefStartIndex+1:hrefEndIndex]
+// checkTarget returns an error when a file path of the export is outside of the
+// base directory, lexically or through a symbolic link, as a listing or an index
+// may name its entries "../../etc/cron.d/x"
+func (c *Crawler) checkTarget(target string) error {
+	return pathutil.Within(c.baseDir, target)
+}
 
-			// Extract element value (text between <a> tags)
-			elStartIndex := strings.Index(line, ">") + 1
-			if elStartIndex < 1 {
-				continue
-			}
-			
-			elEndIndex := strings.Index(line[elStartIndex:], "</a>")
-			if elEndIndex < 0 {
-				continue
-			}
-			elEndIndex += elStartIndex
-			elValue := line[elStartIndex:elEndIndex]
-
-			// Check if it's a file we want to download
-			isTargetFile := c.shouldDownloadFile(urlValue)
-
-			if isTargetFile {
-				if !strings.HasSuffix(elValue, "/") {
-					// Check if file already exists and if we should skip it
-					if !c.config.ForceReplace {
-						safeElPath := pathutil.SafeJoin(safePath, elValue)
-						if _, err := os.Stat(safeElPath); err == nil {
-							continue
-						}
-					}
-
-					fmt.Printf("Downloading %s in %s\n", elValue, safePath)
-					if err := c.downloadFile(elValue, artiURL+urlValue); err != nil {
-						// Log failed download and continue
-						// Use HOME directory instead of hard-coded USERPROFILE for cross-platform compatibility
-						logDir := os.Getenv("HOME")
-						if pathutil.IsWindowsOS() {
-							logDir = os.Getenv("USERPROFILE")
-						}
-						failLogPath := pathutil.SafeJoin(logDir, "Documents", "EXPORT_ARTI", "failed_download.txt")
-						if err := pathutil.EnsureDirectoryExists(filepath.Dir(failLogPath)); err == nil {
-							failLog, err := os.OpenFile(failLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-							if err == nil {
-								fmt.Fprintf(failLog, "wget --timeout=%d --tries=%d -O %s %s\n", c.config.Timeout, c.config.RetryAttempts, elValue, artiURL+urlValue)
-								failLog.Close()
-							}
-						}
-					}
-					// Wait between downloads as specified in config
-					time.Sleep(time.Duration(c.config.Delay) * time.Second)
-				} else if strings.Contains(elValue, "..") {
-					continue
-				}
-			} else {
-				// This is a directory, crawl recursively
-				if strings.Contains(elValue, "..") {
-					continue
-				}
-
-				// Create directory with safe path handling
-				dirPath := pathutil.SafeJoin(safePath, elValue)
-				if err := pathutil.EnsureDirectoryExists(dirPath); err != nil {
-					fmt.Printf("Failed to create directory %s: %v\n", dirPath, err)
-					continue
-				}
-
-				// Change to new directory
-				if err := os.Chdir(dirPath); err != nil {
-					fmt.Printf("Failed to change to directory %s: %v\n", dirPath, err)
-					continue
-				}
-
-				// Generate index file name - sanitize it for Windows
-				indexName := pathutil.SanitizeFilename(strings.Replace(elValue, "/", "", -1) + "-index.html")
-				
-				// Download index file
-				fmt.Printf("Downloading index for %s\n", elValue)
-				if err := c.downloadFile(indexName, artiURL+urlValue); err != nil {
-					fmt.Printf("Failed to download index %s: %v\n", indexName, err)
-					continue
-				}
-
-				// Parse the new index file
-				fmt.Printf("Parsing: %s / %s in new path: %s\n", indexName, artiURL+urlValue, dirPath)
-				if err := c.ParseIndex(indexName, filepath.Join(dirPath, "/"), artiURL+urlValue); err != nil {
-					fmt.Printf("Failed to parse index %s: %v\n", indexName, err)
-				}
-				
-				fmt.Printf("File %s parsed\n", file)
-			}
-		}
+// exists reports whether a target was already exported
+func (c *Crawler) exists(target string) bool {
+	if c.config.Archive != nil {
+		return c.config.Archive.Has(target)
 	}
+	_, err := os.Stat(target)
+	return err == nil
+}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error scanning file: %w", err)
+// save downloads a file to its target and reports whether it succeeded
+func (c *Crawler) save(entry Entry, target string) bool {
+	if c.spaceErr != nil {
+		// The export was aborted for a lack of free disk space
+		return false
+	}
+	if c.config.Store != nil {
+		// Files go through the content store, which hashes them
+		return c.saveVerified(entry, target, digest{})
 	}
 
-	return nil
+	c.downloading(true)
+	var written int64
+	var err error
+	if c.config.Archive != nil {
+		// The file is added to the archive instead of the output directory once complete
+		fmt.Printf("Archiving %s\n", target)
+		written, err = c.downloadFile(target, entry.URL)
+	} else {
+		fmt.Printf("Downloading %s in %s\n", filepath.Base(target), filepath.Dir(target))
+		written, err = c.downloadFile(target, entry.URL)
+	}
+	c.downloading(false)
+
+	if err == nil {
+		c.countDownload(written)
+	} else {
+		c.summary.FilesFailed++
+		fmt.Printf("Failed to download %s: %v\n", entry.URL, err)
+		c.logFailedDownload(path.Base(entry.Path), entry.URL)
+	}
+	c.publish()
+
+	// Wait between downloads as specified in config
+	time.Sleep(time.Duration(c.config.Delay) * time.Second)
+	return err == nil
+}
+
+// logFailedDownload appends a wget command for a failed download to the failed downloads log
+func (c *Crawler) logFailedDownload(name, urlStr string) {
+	failLogPath := pathutil.SafeJoin(exportLogDir(), "failed_download.txt")
+	if err := pathutil.EnsureDirectoryExists(filepath.Dir(failLogPath)); err != nil {
+		return
+	}
+	failLog, err := os.OpenFile(failLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer failLog.Close()
+	fmt.Fprintf(failLog, "wget --timeout=%d --tries=%d -O %s %s\n", c.config.Timeout, c.config.RetryAttempts, name, urlStr)
+}
+
+// exportLogDir returns the directory holding the failed downloads log
+func exportLogDir() string {
+	// Use HOME directory instead of hard-coded USERPROFILE for cross-platform compatibility
+	logDir := os.Getenv("HOME")
+	if pathutil.IsWindowsOS() {
+		logDir = os.Getenv("USERPROFILE")
+	}
+	return filepath.Join(logDir, "Documents", "EXPORT_ARTI")
 }
 
 // shouldDownloadFile checks if a file should be downloaded based on filter settings
@@ -247,68 +362,64 @@ func (c *Crawler) shouldDownloadFile(filePath string) bool {
 	}
 }
 
-// downloadFile downloads a file from the given URL and saves it to the specified path
-func (c *Crawler) downloadFile(filepath, urlStr string) error {
-	// Sanitize the filepath for Windows compatibility
-	safeFilepath := pathutil.SanitizeFilename(filepath)
-	
-	// Configure client with timeout
-	client := &http.Client{
-		Timeout: time.Duration(c.config.Timeout) * time.Second,
-	}
-
-	// Configure proxy if enabled
-	if c.config.ProxyEnabled && c.config.ProxyHost != "" && c.config.ProxyPort > 0 {
-		proxyURL := &url.URL{
-			Scheme: "http",
-			Host:   fmt.Sprintf("%s:%d", c.config.ProxyHost, c.config.ProxyPort),
-		}
+// downloadFile downloads a file from the given URL and saves it to the specified path,
+// or to the archive entry of that name in archive mode. It returns the number of bytes
+// written. The file is written to a temporary file renamed, or added to the archive,
+// once complete, so that a failed download never leaves a partial file.
+func (c *Crawler) downloadFile(filepath, urlStr string) (int64, error) {
+	return c.downloadVerified(filepath, urlStr, digest{})
+}
 
-		if c.config.ProxyUsername != "" && c.config.ProxyPassword != "" {
-			proxyURL.User = url.UserPassword(c.config.ProxyUsername, c.config.ProxyPassword)
-		}
+// Open performs a GET request on the URL of a file found by Walk.
+// The caller must close the response body.
+func (c *Crawler) Open(urlStr string) (*http.Response, error) {
+	return c.fetch(urlStr)
+}
 
-		client.Transport = &http.Transport{
-			Proxy: http.ProxyURL(proxyURL),
-		}
-	}
+// fetch performs a GET request on the given URL with authentication and retries
+// The caller must close the response body
+func (c *Crawler) fetch(urlStr string) (*http.Response, error) {
+	return c.fetchWithHeaders(urlStr, nil)
+}
 
-	// Create request
-	req, err := http.NewRequest("GET", urlStr, nil)
+// fetchWithHeaders performs a GET request like fetch with additional request headers
+func (c *Crawler) fetchWithHeaders(urlStr string, header http.Header) (*http.Response, error) {
+	req, err := c.newRequest("GET", urlStr, header)
 	if err != nil {
-		return err
-	}
-
-	// Add authentication if configured
-	switch c.config.AuthType {
-	case "basic":
-		if c.config.AuthUsername != "" && c.config.AuthPassword != "" {
-			req.SetBasicAuth(c.config.AuthUsername, c.config.AuthPassword)
-		}
-	case "token":
-		if c.config.AuthAccessToken != "" {
-			req.Header.Add("Authorization", "Bearer "+c.config.AuthAccessToken)
-		}
+		return nil, err
 	}
 
-	// Add a user agent to mimic a browser
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-
 	// Perform request with retry logic
 	var resp *http.Response
 	var lastErr error
 
 	for attempt := 0; attempt < c.config.RetryAttempts; attempt++ {
-		resp, err = client.Do(req)
-		if err == nil && resp.StatusCode == http.StatusOK {
+		if attempt > 0 {
+			c.retried()
+		}
+		resp, err = c.do(req)
+		// Not Modified only answers the conditional requests of the download cache
+		if err == nil && (resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNotModified) {
+			lastErr = nil
 			break
 		}
 
 		if err != nil {
 			lastErr = err
+			// A redirect loop will not be solved by retrying
+			if errors.Is(err, httpclient.ErrRedirectLoop) || errors.Is(err, httpclient.ErrTooManyRedirects) {
+				break
+			}
 		} else {
 			lastErr = fmt.Errorf("failed to download %s: status code %d", urlStr, resp.StatusCode)
+			// Drain the body so the connection can be reused
+			io.Copy(io.Discard, resp.Body)
 			resp.Body.Close()
+
+			// A missing file will not appear by retrying
+			if resp.StatusCode == http.StatusNotFound {
+				break
+			}
 		}
 
 		// Wait before retrying
@@ -318,47 +429,57 @@ func (c *Crawler) downloadFile(filepath, urlStr string) error {
 	}
 
 	if lastErr != nil {
-		return lastErr
+		return nil, lastErr
 	}
 
-	defer resp.Body.Close()
+	return resp, nil
+}
 
-	// Create file with safe path handling
-	outFile, err := pathutil.SafeCreateFile(safeFilepath)
+// newRequest creates a request with the authentication of the crawler and additional headers
+func (c *Crawler) newRequest(method, urlStr string, header http.Header) (*http.Request, error) {
+	req, err := http.NewRequest(method, urlStr, nil)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	// Add authentication if configured. The credentials are only sent to the server
+	// of the source, not to the hosts of absolute links such as npm tarball URLs.
+	if c.isSourceURL(req.URL) {
+		httpclient.Auth{
+			Type:        c.config.AuthType,
+			Username:    c.config.AuthUsername,
+			Password:    c.config.AuthPassword,
+			AccessToken: c.config.AuthAccessToken,
+		}.Apply(req)
+	} else if c.config.AuthType == "basic" || c.config.AuthType == "token" {
+		if !c.foreignHosts[req.URL.Host] {
+			fmt.Printf("Requesting %s without credentials, the host is not the source %s\n", req.URL.Host, c.config.ArtiURL)
+			c.foreignHosts[req.URL.Host] = true
+		}
 	}
-	defer outFile.Close()
 
-	_, err = io.Copy(outFile, resp.Body)
-	return err
+	// Add a user agent to mimic a browser
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
+	return req, nil
 }
 
-// CleanupHTMLFiles removes all HTML index files created during the crawling process
-func (c *Crawler) CleanupHTMLFiles() error {
-	var lastErr error
-	for _, file := range c.htmlFiles {
-		safeFile := pathutil.SanitizePath(file)
-		if err := os.Remove(safeFile); err != nil {
-			lastErr = err
-			fmt.Printf("Failed to remove HTML file %s: %v\n", safeFile, err)
-		}
+// isSourceURL reports whether a URL is on the server of the source, with the same
+// scheme, host and port as ArtiURL
+func (c *Crawler) isSourceURL(u *url.URL) bool {
+	source, err := url.Parse(c.config.ArtiURL)
+	if err != nil {
+		return false
 	}
-	return lastErr
+	return httpclient.SameOrigin(u, source)
 }
 
 // ProcessRepositories processes all repositories defined in the configuration
 func (c *Crawler) ProcessRepositories(repoList []string) error {
-	// Ensure the base directory exists and is sanitized
-	safeBaseDir := pathutil.SanitizePath(c.config.BaseDir)
-	if err := pathutil.EnsureDirectoryExists(safeBaseDir); err != nil {
-		return fmt.Errorf("failed to create base directory %s: %w", safeBaseDir, err)
-	}
-
-	// Create the export directory if it doesn't exist
-	exportDir := filepath.Join(os.Getenv("USERPROFILE"), "Documents", "EXPORT_ARTI")
-	if err := os.MkdirAll(exportDir, 0755); err != nil {
-		return fmt.Errorf("failed to create export directory: %w", err)
+	if err := c.prepare(); err != nil {
+		return err
 	}
 
 	// Process each repository in the list
@@ -368,38 +489,69 @@ func (c *Crawler) ProcessRepositories(repoList []string) error {
 			continue
 		}
 
-		// Create repo-specific directory if it doesn't exist
-		repoDir := filepath.Join(safeBaseDir, strings.ReplaceAll(repo, "/", string(os.PathSeparator)))
-		if err := os.MkdirAll(filepath.Dir(repoDir), 0755); err != nil {
-			fmt.Printf("Failed to create repository directory: %v\n", err)
-			continue
-		}
+		c.beginRepository(repo)
 
-		// Create index filename
-		mainIndexName := strings.Replace(repo, "/", "_", -1) + "-index.html"
-		
-		// Download main index file
-		fmt.Printf("Downloading main index for repo: %s\n", repo)
-		if err := c.downloadFile(mainIndexName, c.config.ArtiURL+repo); err != nil {
-			fmt.Printf("Failed to download index for repo %s: %v\n", repo, err)
-			continue
+		fmt.Printf("Crawling repo: %s\n", repo)
+		err := c.Walk(repo, func(entry Entry) error {
+			c.exportEntry(entry)
+			return c.spaceErr
+		})
+		if c.spaceErr != nil {
+			return c.spaceErr
 		}
+		if err != nil {
+			fmt.Printf("Failed to crawl repo %s: %v\n", repo, err)
+			c.summary.RepositoriesFailed++
+		}
+	}
+
+	return c.finish(repoList)
+}
 
-		// Parse the main index
-		fmt.Printf("Parsing index: %s\n", mainIndexName)
-		if err := c.ParseIndex(mainIndexName, safeBaseDir+"/", c.config.ArtiURL+repo); err != nil {
-			fmt.Printf("Failed to parse index for repo %s: %v\n", repo, err)
+// prepare creates the base directory and the failed downloads log directory
+func (c *Crawler) prepare() error {
+	// Ensure the base directory exists and is sanitized
+	safeBaseDir := pathutil.SanitizePath(c.config.BaseDir)
+	if absBaseDir, err := filepath.Abs(safeBaseDir); err == nil {
+		safeBaseDir = absBaseDir
+	}
+	if c.config.Archive == nil {
+		if err := pathutil.EnsureDirectoryExists(safeBaseDir); err != nil {
+			return fmt.Errorf("failed to create base directory %s: %w", safeBaseDir, err)
 		}
 	}
+	c.baseDir = safeBaseDir
 
-	// Clean up HTML files if configured to do so
-	if err := c.CleanupHTMLFiles(); err != nil {
-		fmt.Printf("Warning: Error during HTML cleanup: %v\n", err)
+	// Exports start with at least the free space kept on the filesystem
+	if free, err := diskspace.Free(c.spaceDir()); err == nil && c.config.MinFreeSpace > 0 {
+		fmt.Printf("Free space on %s: %d MiB, %d MiB kept free\n", c.spaceDir(), diskspace.MiB(free), diskspace.MiB(c.config.MinFreeSpace))
+	}
+	if err := c.waitForSpace(0); err != nil {
+		return err
+	}
+
+	// Create the export directory if it doesn't exist
+	// It holds the failed downloads log, see logFailedDownload
+	if err := os.MkdirAll(exportLogDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
 	}
 
 	return nil
 }
 
+// finish writes the files describing the whole export once all the files are exported
+func (c *Crawler) finish(repoList []string) error {
+	if c.config.Layout == config.LayoutMavenLocal {
+		if err := c.writeRemoteRepositories(); err != nil {
+			return err
+		}
+	}
+	if c.config.RegenerateMavenMetadata {
+		return c.regenerateMavenMetadata(repoList)
+	}
+	return nil
+}
+
 // ParseRepoList reads a list of repositories from a file and processes each one
 func (c *Crawler) ParseRepoList(repoListFile string) error {
 	// Open the repository list file
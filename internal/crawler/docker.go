@@ -0,0 +1,358 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/caezarr-oss/refap/internal/oci"
+)
+
+// linkNextPattern matches the next page of a paginated registry response in its Link header
+var linkNextPattern = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?next"?`)
+
+// ExportDocker exports the images of Docker repositories through the OCI distribution
+// API into one OCI image layout per repository: <repository>/oci-layout,
+// <repository>/index.json referencing each exported image:tag, and the
+// manifests, configs and layers in <repository>/blobs/, verified against their digest.
+// Images are read from DockerImages, or from the catalog of the repository.
+func (c *Crawler) ExportDocker(repoList []string) error {
+	if err := c.prepare(); err != nil {
+		return err
+	}
+
+	for _, repo := range repoList {
+		if c.spaceErr != nil {
+			return c.spaceErr
+		}
+		repo = strings.TrimSpace(repo)
+		if repo == "" {
+			continue
+		}
+		c.beginRepository(repo)
+		registry := c.apiURL("docker", repo) + "v2/"
+
+		specs := c.config.DockerImages
+		if len(specs) == 0 {
+			var err error
+			if specs, err = c.dockerList(registry+"_catalog", "repositories"); err != nil {
+				fmt.Printf("Failed to list the images of %s: %v\n", repo, err)
+				c.summary.RepositoriesFailed++
+				continue
+			}
+		}
+
+		fmt.Printf("Exporting Docker repo: %s (%d images)\n", repo, len(specs))
+		repoDir := strings.Trim(repo, "/")
+		var descriptors []oci.Descriptor
+		for _, spec := range specs {
+			name, tagPattern := parseImageSpec(spec)
+			tags, err := c.dockerList(registry+name+"/tags/list", "tags")
+			if err != nil {
+				fmt.Printf("Failed to list the tags of %s: %v\n", name, err)
+				c.summary.FilesFailed++
+				continue
+			}
+
+			for _, tag := range tags {
+				if !c.acceptTag(tag, tagPattern) {
+					continue
+				}
+				fmt.Printf("Exporting image %s:%s\n", name, tag)
+				descriptor, err := c.exportImage(repoDir, registry, name, tag)
+				if err != nil {
+					fmt.Printf("Failed to export image %s:%s: %v\n", name, tag, err)
+					c.summary.FilesFailed++
+					continue
+				}
+				descriptor.Annotations = map[string]string{
+					oci.AnnotationRefName:       name + ":" + tag,
+					oci.AnnotationContainerName: name + ":" + tag,
+				}
+				descriptors = append(descriptors, descriptor)
+			}
+		}
+
+		if err := c.writeImageLayout(repoDir, descriptors); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseImageSpec splits an image specification such as team/app:1.* into its name and tag pattern
+func parseImageSpec(spec string) (name, tagPattern string) {
+	spec = strings.Trim(strings.TrimSpace(spec), "/")
+	if i := strings.LastIndex(spec, ":"); i > strings.LastIndex(spec, "/") {
+		return spec[:i], spec[i+1:]
+	}
+	return spec, ""
+}
+
+// acceptTag applies the tag pattern of the image, or the configured tag patterns, to a tag
+func (c *Crawler) acceptTag(tag, tagPattern string) bool {
+	if tagPattern != "" {
+		return matchPatterns([]string{tagPattern}, tag)
+	}
+	return len(c.config.DockerTags) == 0 || matchPatterns(c.config.DockerTags, tag)
+}
+
+// acceptPlatform applies the platform filters to a manifest of an index.
+// Patterns without variant, such as linux/arm, match all the variants.
+func (c *Crawler) acceptPlatform(platform *oci.Platform) bool {
+	if len(c.config.DockerPlatforms) == 0 {
+		return true
+	}
+	if platform == nil {
+		return false
+	}
+	for _, pattern := range c.config.DockerPlatforms {
+		target := platform.String()
+		if strings.Count(pattern, "/") == 1 {
+			target = platform.OS + "/" + platform.Architecture
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// dockerList reads a paginated registry list, such as the catalog or the tags of an image
+func (c *Crawler) dockerList(listURL, field string) ([]string, error) {
+	var names []string
+	for listURL != "" {
+		data, header, err := c.readURL(listURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page map[string]json.RawMessage
+		var pageNames []string
+		if err := json.Unmarshal(data, &page); err != nil {
+			return nil, fmt.Errorf("invalid response from %s: %w", listURL, err)
+		}
+		if raw, ok := page[field]; ok && string(raw) != "null" {
+			if err := json.Unmarshal(raw, &pageNames); err != nil {
+				return nil, fmt.Errorf("invalid response from %s: %w", listURL, err)
+			}
+		}
+		names = append(names, pageNames...)
+
+		// Follow the next page
+		next := ""
+		if match := linkNextPattern.FindStringSubmatch(header.Get("Link")); match != nil {
+			base, _ := url.Parse(listURL)
+			if ref, err := url.Parse(match[1]); err == nil && base != nil {
+				next = base.ResolveReference(ref).String()
+			}
+		}
+		listURL = next
+	}
+	return names, nil
+}
+
+// exportImage exports the manifest of a reference with the content it references
+// and returns its descriptor. Manifests of an index are filtered by platform, the
+// index being rewritten when some of them are dropped.
+func (c *Crawler) exportImage(repoDir, registry, name, reference string) (oci.Descriptor, error) {
+	data, mediaType, err := c.fetchManifest(registry, name, reference)
+	if err != nil {
+		return oci.Descriptor{}, err
+	}
+
+	switch {
+	case oci.IsIndex(mediaType):
+		var index oci.Index
+		if err := json.Unmarshal(data, &index); err != nil {
+			return oci.Descriptor{}, fmt.Errorf("invalid index: %w", err)
+		}
+		// The manifests of the index are fetched by the digests of the verified
+		// index, never by tag, so that each of them is verified as well
+		var kept []oci.Descriptor
+		for _, manifest := range index.Manifests {
+			if !c.acceptPlatform(manifest.Platform) {
+				continue
+			}
+			if _, _, err := oci.ParseDigest(manifest.Digest); err != nil {
+				return oci.Descriptor{}, fmt.Errorf("invalid manifest digest %q in index: %w", manifest.Digest, err)
+			}
+			if _, err := c.exportImage(repoDir, registry, name, manifest.Digest); err != nil {
+				return oci.Descriptor{}, fmt.Errorf("%s: %w", manifest.Platform, err)
+			}
+			kept = append(kept, manifest)
+		}
+		if len(kept) == 0 {
+			return oci.Descriptor{}, fmt.Errorf("no manifest matches the platforms")
+		}
+		if len(kept) < len(index.Manifests) {
+			if data, err = pruneIndex(data, kept); err != nil {
+				return oci.Descriptor{}, err
+			}
+		}
+
+	case oci.IsManifest(mediaType):
+		var manifest oci.Manifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return oci.Descriptor{}, fmt.Errorf("invalid manifest: %w", err)
+		}
+		blobs := append([]oci.Descriptor{manifest.Config}, manifest.Layers...)
+		if err := c.waitForSpace(c.missingBlobsSize(repoDir, blobs)); err != nil {
+			return oci.Descriptor{}, err
+		}
+		for _, blob := range blobs {
+			if err := c.exportBlob(repoDir, registry, name, blob); err != nil {
+				return oci.Descriptor{}, err
+			}
+		}
+
+	default:
+		return oci.Descriptor{}, fmt.Errorf("unsupported manifest media type %q", mediaType)
+	}
+
+	descriptor := oci.Descriptor{MediaType: mediaType, Digest: oci.Digest(data), Size: int64(len(data))}
+	return descriptor, c.writeBlob(repoDir, descriptor.Digest, data)
+}
+
+// pruneIndex rewrites an index with the given manifests only, keeping its other fields
+func pruneIndex(data []byte, manifests []oci.Descriptor) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var err error
+	if doc["manifests"], err = json.Marshal(manifests); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// fetchManifest downloads a manifest by tag or digest and returns it with its
+// media type. It is verified against the requested digest, or the digest
+// announced by the registry, and fails when a manifest fetched by tag comes
+// without its digest.
+func (c *Crawler) fetchManifest(registry, name, reference string) ([]byte, string, error) {
+	data, header, err := c.readURL(registry+name+"/manifests/"+reference, http.Header{
+		"Accept": {strings.Join(oci.ManifestAccept, ", ")},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	digest := reference
+	if !strings.Contains(reference, ":") {
+		digest = header.Get("Docker-Content-Digest")
+		if digest == "" {
+			return nil, "", fmt.Errorf("manifest %s: no Docker-Content-Digest header, the manifest cannot be verified", reference)
+		}
+	}
+	if err := oci.Verify(data, digest); err != nil {
+		return nil, "", fmt.Errorf("manifest %s: %w", reference, err)
+	}
+
+	mediaType, _, _ := strings.Cut(header.Get("Content-Type"), ";")
+	if !oci.IsIndex(mediaType) && !oci.IsManifest(mediaType) {
+		mediaType = oci.MediaType(data)
+	}
+	return data, mediaType, nil
+}
+
+// missingBlobsSize returns the size of the blobs of a manifest which are not exported yet,
+// the space needed by the image
+func (c *Crawler) missingBlobsSize(repoDir string, blobs []oci.Descriptor) int64 {
+	var size int64
+	for _, blob := range blobs {
+		blobPath, err := oci.BlobPath(blob.Digest)
+		if err == nil && len(blob.URLs) == 0 && !strings.Contains(blob.MediaType, "foreign") && !c.exists(c.target(path.Join(repoDir, blobPath))) {
+			size += blob.Size
+		}
+	}
+	return size
+}
+
+// exportBlob downloads a config or layer blob into the image layout, verified against its digest.
+// Foreign layers, which may not be distributed, are not exported.
+func (c *Crawler) exportBlob(repoDir, registry, name string, blob oci.Descriptor) error {
+	if len(blob.URLs) > 0 || strings.Contains(blob.MediaType, "foreign") {
+		fmt.Printf("Skipping foreign layer %s\n", blob.Digest)
+		return nil
+	}
+
+	blobPath, err := oci.BlobPath(blob.Digest)
+	if err != nil {
+		return err
+	}
+	algorithm, sum, _ := oci.ParseDigest(blob.Digest)
+
+	target := c.target(path.Join(repoDir, blobPath))
+	if c.exists(target) {
+		c.summary.FilesSkipped++
+		return nil
+	}
+	entry := Entry{Repo: repoDir + "/", Path: blobPath, URL: registry + name + "/blobs/" + blob.Digest}
+	if !c.saveVerified(entry, target, digest{algorithm: algorithm, newHash: oci.NewHash(algorithm), sum: sum}) {
+		return fmt.Errorf("blob %s could not be exported", blob.Digest)
+	}
+	return nil
+}
+
+// writeBlob writes a manifest downloaded in memory into the image layout
+func (c *Crawler) writeBlob(repoDir, digest string, data []byte) error {
+	blobPath, err := oci.BlobPath(digest)
+	if err != nil {
+		return err
+	}
+	target := c.target(path.Join(repoDir, blobPath))
+	if c.exists(target) {
+		c.summary.FilesSkipped++
+		return nil
+	}
+	if err := c.writeFile(path.Join(repoDir, blobPath), data); err != nil {
+		return err
+	}
+	c.summary.FilesDownloaded++
+	c.summary.BytesDownloaded += int64(len(data))
+	return nil
+}
+
+// writeImageLayout writes the oci-layout file and the index of the image layout of a repository.
+// Images exported by a previous run stay in the index.
+func (c *Crawler) writeImageLayout(repoDir string, descriptors []oci.Descriptor) error {
+	var existing []byte
+	if c.config.Archive == nil {
+		if data, err := os.ReadFile(c.target(path.Join(repoDir, "index.json"))); err == nil {
+			existing = data
+		}
+	}
+	index, err := oci.MergeIndex(existing, descriptors)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Generating %s\n", path.Join(repoDir, "index.json"))
+	if err := c.writeFile(path.Join(repoDir, "oci-layout"), []byte(oci.LayoutFile)); err != nil {
+		return err
+	}
+	return c.writeFile(path.Join(repoDir, "index.json"), index)
+}
+
+// readURL downloads a document in memory with the given request headers and returns it with the response headers
+func (c *Crawler) readURL(urlStr string, header http.Header) ([]byte, http.Header, error) {
+	resp, err := c.fetchWithHeaders(urlStr, header)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, resp.Header, nil
+}
@@ -0,0 +1,163 @@
+package crawler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/caezarr-oss/refap/internal/oci"
+)
+
+// registryStub serves the manifests and blobs of the images of a Docker repository
+type registryStub struct {
+	t         *testing.T
+	tags      []string
+	manifests map[string][]byte // By tag and digest
+	types     map[string]string // Media type by tag and digest
+	noDigest  map[string]bool   // Tags served without Docker-Content-Digest
+	blobs     map[string][]byte // By digest
+}
+
+func newRegistryStub(t *testing.T) *registryStub {
+	return &registryStub{
+		t:         t,
+		manifests: make(map[string][]byte),
+		types:     make(map[string]string),
+		noDigest:  make(map[string]bool),
+		blobs:     make(map[string][]byte),
+	}
+}
+
+// blob adds a blob and returns its descriptor
+func (s *registryStub) blob(mediaType, content string) oci.Descriptor {
+	digest := oci.Digest([]byte(content))
+	s.blobs[digest] = []byte(content)
+	return oci.Descriptor{MediaType: mediaType, Digest: digest, Size: int64(len(content))}
+}
+
+// manifest adds a manifest, under its digest and the given tag when set, and returns its descriptor
+func (s *registryStub) manifest(tag, mediaType string, document any) oci.Descriptor {
+	data, err := json.Marshal(document)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	digest := oci.Digest(data)
+	for _, reference := range []string{tag, digest} {
+		if reference != "" {
+			s.manifests[reference] = data
+			s.types[reference] = mediaType
+		}
+	}
+	if tag != "" {
+		s.tags = append(s.tags, tag)
+	}
+	return oci.Descriptor{MediaType: mediaType, Digest: digest, Size: int64(len(data))}
+}
+
+// image adds an image manifest with a config and a layer
+func (s *registryStub) image(tag, layer string) oci.Descriptor {
+	return s.manifest(tag, oci.MediaTypeImageManifest, oci.Manifest{
+		SchemaVersion: 2,
+		MediaType:     oci.MediaTypeImageManifest,
+		Config:        s.blob("application/vnd.oci.image.config.v1+json", `{"layer":"`+layer+`"}`),
+		Layers:        []oci.Descriptor{s.blob("application/vnd.oci.image.layer.v1.tar+gzip", layer)},
+	})
+}
+
+func (s *registryStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest, ok := strings.CutPrefix(r.URL.Path, "/artifactory/api/docker/docker-local/v2/app/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case rest == "tags/list":
+		json.NewEncoder(w).Encode(map[string][]string{"tags": s.tags})
+	case strings.HasPrefix(rest, "manifests/"):
+		reference := strings.TrimPrefix(rest, "manifests/")
+		data, ok := s.manifests[reference]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", s.types[reference])
+		if !s.noDigest[reference] {
+			w.Header().Set("Docker-Content-Digest", oci.Digest(data))
+		}
+		w.Write(data)
+	case strings.HasPrefix(rest, "blobs/"):
+		data, ok := s.blobs[strings.TrimPrefix(rest, "blobs/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestExportDockerVerifiesManifestsAndBlobs(t *testing.T) {
+	registry := newRegistryStub(t)
+
+	// A multi-arch image whose manifests are only reachable through the index
+	amd64 := registry.image("", "amd64 layer")
+	amd64.Platform = &oci.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := registry.image("", "arm64 layer")
+	arm64.Platform = &oci.Platform{OS: "linux", Architecture: "arm64"}
+	registry.manifest("1.0", oci.MediaTypeImageIndex, oci.Index{
+		SchemaVersion: 2,
+		MediaType:     oci.MediaTypeImageIndex,
+		Manifests:     []oci.Descriptor{amd64, arm64},
+	})
+
+	// An image with a corrupted layer
+	corrupted := registry.image("2.0", "original layer")
+	var manifest oci.Manifest
+	json.Unmarshal(registry.manifests[corrupted.Digest], &manifest)
+	registry.blobs[manifest.Layers[0].Digest] = []byte("tampered layer")
+
+	// An image served by tag without its digest
+	registry.image("3.0", "unverified layer")
+	registry.noDigest["3.0"] = true
+
+	source := httptest.NewServer(registry)
+	defer source.Close()
+
+	c := newTestCrawler(t, source, Config{DockerImages: []string{"app"}})
+	if err := c.ExportDocker([]string{"docker-local"}); err != nil {
+		t.Fatal(err)
+	}
+	// The corrupted layer fails with its image, as does the image served without digest
+	if failed := c.Summary().FilesFailed; failed != 3 {
+		t.Errorf("%d files failed, want the corrupted layer, its image and the unverified image", failed)
+	}
+
+	layoutDir := filepath.Join(c.config.BaseDir, "docker-local")
+	data, err := os.ReadFile(filepath.Join(layoutDir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index oci.Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 1 || index.Manifests[0].Annotations[oci.AnnotationRefName] != "app:1.0" {
+		t.Fatalf("image layout index = %s, want app:1.0 only", data)
+	}
+
+	for _, blob := range []oci.Descriptor{amd64, arm64, index.Manifests[0]} {
+		blobPath, _ := oci.BlobPath(blob.Digest)
+		if _, err := os.Stat(filepath.Join(layoutDir, filepath.FromSlash(blobPath))); err != nil {
+			t.Errorf("manifest %s not exported: %v", blob.Digest, err)
+		}
+	}
+	tamperedPath, _ := oci.BlobPath(manifest.Layers[0].Digest)
+	if _, err := os.Stat(filepath.Join(layoutDir, filepath.FromSlash(tamperedPath))); err == nil {
+		t.Errorf("corrupted layer %s exported", manifest.Layers[0].Digest)
+	}
+}
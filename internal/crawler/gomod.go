@@ -0,0 +1,251 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/caezarr-oss/refap/internal/gomod"
+	"github.com/caezarr-oss/refap/internal/pathutil"
+)
+
+// ExportGo exports the modules of Go repositories from their GOPROXY API into a module
+// proxy tree usable with GOPROXY=file://<output>/<repository>: <module>/@v/list lists
+// the exported versions, and <module>/@v/<version>.info, .mod and .zip hold their files.
+// Modules are read from GoModules, as path[@range] entries whose path may be a pattern
+// matching the modules of the GoSumFiles, and the versions required by the GoSumFiles
+// are exported as well. Files are checked against the hashes of the GoSumFiles and
+// of the GoChecksumDB dump.
+func (c *Crawler) ExportGo(repoList []string) error {
+	if err := c.prepare(); err != nil {
+		return err
+	}
+	sums, required, err := c.goSums()
+	if err != nil {
+		return err
+	}
+
+	for _, repo := range repoList {
+		if c.spaceErr != nil {
+			return c.spaceErr
+		}
+		repo = strings.TrimSpace(repo)
+		if repo == "" {
+			continue
+		}
+		c.beginRepository(repo)
+		proxyURL := c.apiURL("go", repo)
+
+		// Versions of each module, with whether their zip is needed
+		versions := make(map[string]map[string]bool)
+		addVersion := func(module, version string, withZip bool) {
+			if versions[module] == nil {
+				versions[module] = make(map[string]bool)
+			}
+			versions[module][version] = versions[module][version] || withZip
+		}
+		for module, moduleVersions := range required {
+			for version, withZip := range moduleVersions {
+				addVersion(module, version, withZip)
+			}
+		}
+
+		for _, spec := range c.config.GoModules {
+			pattern, versionRange, _ := strings.Cut(strings.TrimSpace(spec), "@")
+			modules := []string{pattern}
+			if strings.ContainsAny(pattern, "*?[") {
+				modules = nil
+				for module := range required {
+					if matched, _ := path.Match(pattern, module); matched {
+						modules = append(modules, module)
+					}
+				}
+				sort.Strings(modules)
+			}
+
+			for _, module := range modules {
+				listed, err := c.goVersions(proxyURL, module)
+				if err != nil {
+					fmt.Printf("Failed to list the versions of %s: %v\n", module, err)
+					c.summary.FilesFailed++
+					continue
+				}
+				selected, err := gomod.Select(listed, versionRange, c.config.GoIncludePrerelease, c.config.GoLatestOnly)
+				if err != nil {
+					return fmt.Errorf("invalid version range of %s: %w", spec, err)
+				}
+				if len(selected) == 0 {
+					fmt.Printf("No version of %s matches %q\n", module, versionRange)
+				}
+				for _, version := range selected {
+					addVersion(module, version, true)
+				}
+			}
+		}
+
+		fmt.Printf("Exporting Go repo: %s (%d modules)\n", repo, len(versions))
+		modules := make([]string, 0, len(versions))
+		for module := range versions {
+			modules = append(modules, module)
+		}
+		sort.Strings(modules)
+
+		for _, module := range modules {
+			moduleVersions := make([]string, 0, len(versions[module]))
+			for version := range versions[module] {
+				moduleVersions = append(moduleVersions, version)
+			}
+			sort.Strings(moduleVersions)
+
+			var exported []string
+			for _, version := range moduleVersions {
+				if c.exportGoVersion(repo, proxyURL, module, version, versions[module][version], sums) {
+					exported = append(exported, version)
+				}
+			}
+			if err := c.writeGoVersionList(repo, module, exported); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// goSums loads the hashes of the go.sum files and of the checksum database dump,
+// and returns them with the module versions required by the go.sum files
+func (c *Crawler) goSums() (gomod.Sums, map[string]map[string]bool, error) {
+	goSum := make(gomod.Sums)
+	for _, file := range c.config.GoSumFiles {
+		if err := goSum.Load(file); err != nil {
+			return nil, nil, fmt.Errorf("error reading go.sum: %w", err)
+		}
+	}
+
+	sums := make(gomod.Sums)
+	if c.config.GoChecksumDB != "" {
+		if err := sums.Load(c.config.GoChecksumDB); err != nil {
+			return nil, nil, fmt.Errorf("error reading checksum database: %w", err)
+		}
+	}
+	for key, sum := range goSum {
+		if known, ok := sums[key]; ok && known != sum {
+			return nil, nil, fmt.Errorf("go.sum hash of %s is %s, but %s in the checksum database", key, sum, known)
+		}
+		sums[key] = sum
+	}
+	return sums, goSum.Requirements(), nil
+}
+
+// goVersions lists the versions of a module from its @v/list file
+func (c *Crawler) goVersions(proxyURL, module string) ([]string, error) {
+	escaped, err := gomod.EscapePath(module)
+	if err != nil {
+		return nil, err
+	}
+	data, _, err := c.readURL(proxyURL+escaped+"/@v/list", nil)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// exportGoVersion downloads the .info and .mod files of a module version, and its
+// .zip when withZip is set. It reports whether all of them were exported.
+func (c *Crawler) exportGoVersion(repo, proxyURL, module, version string, withZip bool, sums gomod.Sums) bool {
+	escapedModule, err := gomod.EscapePath(module)
+	var escapedVersion string
+	if err == nil {
+		escapedVersion, err = gomod.EscapePath(version)
+	}
+	if err != nil {
+		fmt.Printf("Invalid module %s %s: %v\n", module, version, err)
+		c.summary.FilesFailed++
+		return false
+	}
+
+	extensions := []string{".info", ".mod"}
+	if withZip {
+		extensions = append(extensions, ".zip")
+	}
+	for _, ext := range extensions {
+		relPath := path.Join(escapedModule, "@v", escapedVersion+ext)
+		entry := Entry{Repo: repo, Path: relPath, URL: proxyURL + relPath}
+		target := c.target(path.Join(strings.Trim(repo, "/"), relPath))
+
+		ok := true
+		sum, hasSum := sums[gomod.Key(module, version, ext == ".mod")]
+		switch {
+		case c.exists(target) && (c.config.Archive != nil || !c.config.ForceReplace):
+			c.summary.FilesSkipped++
+		case ext == ".info":
+			ok = c.save(entry, target)
+		case hasSum:
+			ok = c.saveVerified(entry, target, digest{algorithm: "h1", check: goHashCheck(ext, sum)})
+		default:
+			fmt.Printf("No checksum for %s, the file is not verified\n", relPath)
+			ok = c.save(entry, target)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// goHashCheck returns the check of a downloaded .mod or .zip file against its go.sum hash
+func goHashCheck(ext, want string) func(file *os.File, size int64) error {
+	return func(file *os.File, size int64) error {
+		var got string
+		if ext == ".zip" {
+			var err error
+			if got, err = gomod.HashZip(file, size); err != nil {
+				return err
+			}
+		} else {
+			data, err := io.ReadAll(io.NewSectionReader(file, 0, size))
+			if err != nil {
+				return err
+			}
+			got = gomod.HashMod(data)
+		}
+		if got != want {
+			return fmt.Errorf("expected %s, got %s", want, got)
+		}
+		return nil
+	}
+}
+
+// writeGoVersionList writes the @v/list file of a module, with the exported versions
+// and the ones of a previous export. Pseudo-versions are not listed, as in a proxy.
+func (c *Crawler) writeGoVersionList(repo, module string, versions []string) error {
+	escaped, err := gomod.EscapePath(module)
+	if err != nil || len(versions) == 0 {
+		return nil
+	}
+	relPath := path.Join(strings.Trim(repo, "/"), escaped, "@v", "list")
+
+	if c.config.Archive == nil {
+		if data, err := os.ReadFile(pathutil.SanitizePath(c.target(relPath))); err == nil {
+			versions = append(versions, strings.Fields(string(data))...)
+		}
+	}
+	var listed []string
+	seen := make(map[string]bool)
+	for _, version := range versions {
+		if !seen[version] && !gomod.IsPseudoVersion(version) {
+			seen[version] = true
+			listed = append(listed, version)
+		}
+	}
+	listed, _ = gomod.Select(listed, "", true, false)
+
+	var b strings.Builder
+	for _, version := range listed {
+		b.WriteString(version + "\n")
+	}
+	return c.writeFile(relPath, []byte(b.String()))
+}
@@ -0,0 +1,69 @@
+package crawler
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportGoRejectsZipsNotMatchingGoSum(t *testing.T) {
+	// The go.mod matches its go.sum hash, the zip was tampered with
+	var zipData bytes.Buffer
+	w := zip.NewWriter(&zipData)
+	file, err := w.Create("github.com/pmezard/go-difflib@v1.0.0/LICENSE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("not the license"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := "/artifactory/api/go/go-remote/github.com/pmezard/go-difflib/@v/"
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case prefix + "v1.0.0.info":
+			w.Write([]byte(`{"Version":"v1.0.0","Time":"2016-01-10T10:55:54Z"}`))
+		case prefix + "v1.0.0.mod":
+			w.Write([]byte("module github.com/pmezard/go-difflib\n"))
+		case prefix + "v1.0.0.zip":
+			w.Write(zipData.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer source.Close()
+
+	goSum := filepath.Join(t.TempDir(), "go.sum")
+	if err := os.WriteFile(goSum, []byte(`github.com/pmezard/go-difflib v1.0.0 h1:4DBwDE0NGyQoBHbLQYPwSUPoCMWR5BEzIk/f1lZbAQM=
+github.com/pmezard/go-difflib v1.0.0/go.mod h1:iKH77koFhYxTK1pcRnkKkqfTogsbg7gZNVY4sRDYZ/4=
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestCrawler(t, source, Config{GoSumFiles: []string{goSum}})
+	if err := c.ExportGo([]string{"go-remote"}); err != nil {
+		t.Fatal(err)
+	}
+	if summary := c.Summary(); summary.FilesDownloaded != 2 || summary.FilesFailed != 1 {
+		t.Fatalf("summary = %+v, want the .info and .mod downloaded and the .zip failed", summary)
+	}
+
+	dir := filepath.Join(c.config.BaseDir, "go-remote", "github.com", "pmezard", "go-difflib", "@v")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	// Neither the zip, its temporary file nor the version list are left
+	if len(names) != 2 || names[0] != "v1.0.0.info" || names[1] != "v1.0.0.mod" {
+		t.Errorf("exported files = %v, want only v1.0.0.info and v1.0.0.mod", names)
+	}
+}
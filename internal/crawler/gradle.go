@@ -0,0 +1,192 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/caezarr-oss/refap/internal/gradle"
+)
+
+// snapshotTimestamp matches the timestamp replacing SNAPSHOT in the file names of a snapshot
+var snapshotTimestamp = regexp.MustCompile(`^\d{8}\.\d{6}-\d+`)
+
+// acceptFile applies the extension and classifier filters to a file of the
+// directory dir. Gradle module metadata and the files it references in the
+// directory are accepted whatever their extension when it is enabled.
+func (c *Crawler) acceptFile(dir string, l Link, referenced map[string]bool) bool {
+	if !c.shouldDownloadFile(l.Text) && !referenced[l.Text] && !(c.config.IncludeGradleMetadata && gradle.IsModule(l.Text)) {
+		return false
+	}
+	return c.acceptClassifier(dir, l.Text)
+}
+
+// acceptClassifier applies the classifier filters to a file of the directory dir.
+// Files without classifier are always accepted.
+func (c *Crawler) acceptClassifier(dir, name string) bool {
+	classifier, ok := classifierOf(dir, name)
+	if !ok {
+		return true
+	}
+	if len(c.config.IncludeClassifiers) > 0 && !matchPatterns(c.config.IncludeClassifiers, classifier) {
+		return false
+	}
+	return !matchPatterns(c.config.ExcludeClassifiers, classifier)
+}
+
+// matchPatterns reports whether a value matches one of the path.Match patterns, such as "natives-*"
+func matchPatterns(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// classifierOf returns the classifier of a file of the version directory dir, laid out as
+// <artifactId>/<version>/<artifactId>-<version>[-<classifier>].<extension>.
+// Checksums and signatures have the classifier of the file they belong to.
+func classifierOf(dir, name string) (string, bool) {
+	version := path.Base(dir)
+	artifactID := path.Base(path.Dir(dir))
+
+	rest, ok := strings.CutPrefix(sidecarOf(name), artifactID+"-")
+	if !ok {
+		return "", false
+	}
+	if base, isSnapshot := strings.CutSuffix(version, "SNAPSHOT"); isSnapshot {
+		// Timestamped snapshots replace SNAPSHOT with the timestamp in the file name
+		if rest, ok = strings.CutPrefix(rest, base); !ok {
+			return "", false
+		}
+		if timestamp := snapshotTimestamp.FindString(rest); timestamp != "" {
+			rest = rest[len(timestamp):]
+		} else if rest, ok = strings.CutPrefix(rest, "SNAPSHOT"); !ok {
+			return "", false
+		}
+	} else if rest, ok = strings.CutPrefix(rest, version); !ok {
+		return "", false
+	}
+
+	classifier, ok := strings.CutPrefix(rest, "-")
+	if !ok {
+		return "", false
+	}
+	classifier, _, _ = strings.Cut(classifier, ".")
+	return classifier, classifier != ""
+}
+
+// gradleReferences reads the Gradle module metadata files of a directory listing
+// and returns the names of the files they reference in the directory
+func (c *Crawler) gradleReferences(links []Link) map[string]bool {
+	if !c.config.IncludeGradleMetadata {
+		return nil
+	}
+
+	referenced := make(map[string]bool)
+	for _, l := range links {
+		if !gradle.IsModule(l.Text) {
+			continue
+		}
+		module, err := c.readGradleModule(l.URL)
+		if err != nil {
+			fmt.Printf("Failed to read %s: %v\n", l.URL, err)
+			continue
+		}
+		for _, fileURL := range module.FileURLs() {
+			if name, err := url.PathUnescape(fileURL); err == nil && !strings.Contains(name, "/") {
+				referenced[name] = true
+			}
+		}
+	}
+	return referenced
+}
+
+// exportGradleModule exports the Gradle module metadata at modulePath in the
+// repository with the files it references, and follows the module metadata of
+// the variants available at other modules. seen holds the modules already
+// exported. Most artifacts are not published by Gradle, so a missing module
+// metadata file is ignored.
+func (c *Crawler) exportGradleModule(repo, modulePath string, seen map[string]bool) {
+	if seen[repo+modulePath] {
+		return
+	}
+	seen[repo+modulePath] = true
+
+	moduleURL := c.repoURL(repo) + escapePath(modulePath)
+	module, err := c.readGradleModule(moduleURL)
+	if err != nil {
+		return
+	}
+	defer delete(c.gradleModules, moduleURL)
+	if !c.exportEntry(Entry{Repo: repo, Path: modulePath, URL: moduleURL}) {
+		return
+	}
+
+	dir := path.Dir(modulePath)
+	for _, fileURL := range module.FileURLs() {
+		filePath, ok := moduleRelativePath(dir, fileURL)
+		if !ok || !c.acceptClassifier(path.Dir(filePath), path.Base(filePath)) {
+			continue
+		}
+		c.exportEntry(Entry{Repo: repo, Path: filePath, URL: c.repoURL(repo) + escapePath(filePath)})
+	}
+
+	for _, moduleURL := range module.AvailableAtURLs() {
+		if modulePath, ok := moduleRelativePath(dir, moduleURL); ok {
+			c.exportGradleModule(repo, modulePath, seen)
+		}
+	}
+}
+
+// moduleRelativePath resolves a URL of a module metadata file of the directory dir
+// into a path of the repository. URLs outside of the repository are refused.
+func moduleRelativePath(dir, fileURL string) (string, bool) {
+	name, err := url.PathUnescape(fileURL)
+	if err != nil || strings.Contains(name, ":") || strings.HasPrefix(name, "/") {
+		return "", false
+	}
+	relPath := path.Join(dir, name)
+	if relPath == ".." || strings.HasPrefix(relPath, "../") {
+		return "", false
+	}
+	return relPath, true
+}
+
+// readGradleModule downloads and parses a Gradle module metadata file in memory,
+// keeping its content to export it without downloading it again
+func (c *Crawler) readGradleModule(moduleURL string) (*gradle.Module, error) {
+	resp, err := c.fetch(moduleURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	module, err := gradle.ParseModule(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// The content is kept for fetchFile, as the module metadata is exported next
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+	c.gradleModules[moduleURL] = resp
+	return module, nil
+}
+
+// forgetGradleModules drops the module metadata of the links kept by readGradleModule
+// which were not exported, such as those already in the export
+func (c *Crawler) forgetGradleModules(links []Link) {
+	for _, l := range links {
+		delete(c.gradleModules, l.URL)
+	}
+}
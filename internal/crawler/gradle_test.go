@@ -0,0 +1,145 @@
+package crawler
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/caezarr-oss/refap/config"
+)
+
+func TestClassifierOf(t *testing.T) {
+	for _, tc := range []struct {
+		dir, name  string
+		classifier string
+		ok         bool
+	}{
+		{"org/acme/lib/1.0", "lib-1.0.jar", "", false},
+		{"org/acme/lib/1.0", "lib-1.0-sources.jar", "sources", true},
+		{"org/acme/lib/1.0", "lib-1.0-natives-linux.jar", "natives-linux", true},
+		{"org/acme/lib/1.0", "lib-1.0.tar.gz", "", false},
+		{"org/acme/lib/1.0", "lib-1.0-dist.tar.gz", "dist", true},
+		// Checksums and signatures have the classifier of their file
+		{"org/acme/lib/1.0", "lib-1.0-sources.jar.sha1", "sources", true},
+		{"org/acme/lib/1.0", "lib-1.0-sources.jar.asc", "sources", true},
+		{"org/acme/lib/1.0", "lib-1.0.jar.sha256", "", false},
+		// Snapshots, timestamped or not
+		{"org/acme/lib/1.1-SNAPSHOT", "lib-1.1-SNAPSHOT-sources.jar", "sources", true},
+		{"org/acme/lib/1.1-SNAPSHOT", "lib-1.1-20240101.120000-3-sources.jar", "sources", true},
+		{"org/acme/lib/1.1-SNAPSHOT", "lib-1.1-20240101.120000-3.jar", "", false},
+		{"org/acme/lib/1.1-SNAPSHOT", "lib-1.1-20240101.120000-3-javadoc.jar.md5", "javadoc", true},
+		// Files of another artifact or version
+		{"org/acme/lib/1.0", "lib-extra-1.0-sources.jar", "", false},
+		{"org/acme/lib/1.0", "other-1.0-sources.jar", "", false},
+		{"org/acme/lib/1.0", "maven-metadata.xml", "", false},
+	} {
+		classifier, ok := classifierOf(tc.dir, tc.name)
+		if classifier != tc.classifier || ok != tc.ok {
+			t.Errorf("classifierOf(%q, %q) = %q, %v, want %q, %v", tc.dir, tc.name, classifier, ok, tc.classifier, tc.ok)
+		}
+	}
+}
+
+// gradleModule references the jar of the version, its natives and the jvm variant
+const gradleModule = `{
+	"formatVersion": "1.1",
+	"component": {"group": "org.acme", "module": "lib", "version": "1.0"},
+	"variants": [
+		{"name": "apiElements", "files": [{"name": "lib-1.0.jar", "url": "lib-1.0.jar"}]},
+		{"name": "nativesLinux", "files": [{"name": "lib-1.0-natives-linux.jar", "url": "lib-1.0-natives-linux.jar"}]},
+		{"name": "jvmApiElements", "available-at": {"url": "../../lib-jvm/1.0/lib-jvm-1.0.module", "group": "org.acme", "module": "lib-jvm", "version": "1.0"}}
+	]
+}`
+
+// gradleFiles are the files of a repository publishing Gradle module metadata
+var gradleFiles = map[string]string{
+	"libs/org/acme/lib/1.0/lib-1.0.module":              gradleModule,
+	"libs/org/acme/lib/1.0/lib-1.0.pom":                 "<project/>",
+	"libs/org/acme/lib/1.0/lib-1.0.jar":                 "lib",
+	"libs/org/acme/lib/1.0/lib-1.0-natives-linux.jar":   "natives",
+	"libs/org/acme/lib/1.0/lib-1.0-unreferenced.zip":    "unreferenced",
+	"libs/org/acme/lib-jvm/1.0/lib-jvm-1.0.module":      `{"formatVersion": "1.1", "variants": [{"name": "jvm", "files": [{"name": "lib-jvm-1.0.jar", "url": "lib-jvm-1.0.jar"}]}]}`,
+	"libs/org/acme/lib-jvm/1.0/lib-jvm-1.0.jar":         "lib jvm",
+	"libs/org/acme/lib-jvm/1.0/lib-jvm-1.0-sources.jar": "lib jvm sources",
+}
+
+// checkExported compares the files of the export with the wanted paths
+func checkExported(t *testing.T, c *Crawler, want map[string]bool) {
+	t.Helper()
+	for relPath, exported := range want {
+		_, err := os.Stat(filepath.Join(c.baseDir, filepath.FromSlash(relPath)))
+		if exported != (err == nil) {
+			t.Errorf("%s exported: %v, want %v", relPath, err == nil, exported)
+		}
+	}
+}
+
+func TestExportGradleModuleReferences(t *testing.T) {
+	stub, source := newListingStub(t, gradleFiles)
+	c := newTestCrawler(t, source, Config{
+		FilterMode:            config.FilterModeWhitelist,
+		Extensions:            []string{".pom"},
+		IncludeGradleMetadata: true,
+		ExcludeClassifiers:    []string{"natives-*"},
+	})
+	if err := c.ProcessRepositories([]string{"libs"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The files referenced by a module are exported whatever their extension,
+	// except those whose classifier is excluded
+	checkExported(t, c, map[string]bool{
+		"libs/org/acme/lib/1.0/lib-1.0.module":              true,
+		"libs/org/acme/lib/1.0/lib-1.0.pom":                 true,
+		"libs/org/acme/lib/1.0/lib-1.0.jar":                 true,
+		"libs/org/acme/lib/1.0/lib-1.0-natives-linux.jar":   false,
+		"libs/org/acme/lib/1.0/lib-1.0-unreferenced.zip":    false,
+		"libs/org/acme/lib-jvm/1.0/lib-jvm-1.0.jar":         true,
+		"libs/org/acme/lib-jvm/1.0/lib-jvm-1.0-sources.jar": false,
+	})
+	if got := readExported(t, c, "libs/org/acme/lib/1.0/lib-1.0.module"); got != gradleModule {
+		t.Errorf("module exported as %q", got)
+	}
+
+	// The module metadata read for its references is exported without downloading it again
+	for _, module := range []string{"libs/org/acme/lib/1.0/lib-1.0.module", "libs/org/acme/lib-jvm/1.0/lib-jvm-1.0.module"} {
+		if n := stub.count(http.MethodGet, module); n != 1 {
+			t.Errorf("%s downloaded %d times, want once", module, n)
+		}
+	}
+}
+
+func TestExportGradleModuleFollowsVariants(t *testing.T) {
+	stub, source := newListingStub(t, gradleFiles)
+	c := newTestCrawler(t, source, Config{
+		FilterMode:            config.FilterModeBlacklist,
+		IncludeGradleMetadata: true,
+		IncludeClassifiers:    []string{"sources"},
+	})
+	if err := c.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	c.exportGradleModule("libs/", "org/acme/lib/1.0/lib-1.0.module", seen)
+	// A module already followed is not exported again
+	c.exportGradleModule("libs/", "org/acme/lib-jvm/1.0/lib-jvm-1.0.module", seen)
+
+	// The module available-at is followed to the files of its variants
+	checkExported(t, c, map[string]bool{
+		"libs/org/acme/lib/1.0/lib-1.0.module":              true,
+		"libs/org/acme/lib/1.0/lib-1.0.jar":                 true,
+		"libs/org/acme/lib/1.0/lib-1.0-natives-linux.jar":   false,
+		"libs/org/acme/lib-jvm/1.0/lib-jvm-1.0.module":      true,
+		"libs/org/acme/lib-jvm/1.0/lib-jvm-1.0.jar":         true,
+		"libs/org/acme/lib-jvm/1.0/lib-jvm-1.0-sources.jar": false,
+	})
+	for _, module := range []string{"libs/org/acme/lib/1.0/lib-1.0.module", "libs/org/acme/lib-jvm/1.0/lib-jvm-1.0.module"} {
+		if n := stub.count(http.MethodGet, module); n != 1 {
+			t.Errorf("%s downloaded %d times, want once", module, n)
+		}
+	}
+	if len(c.gradleModules) != 0 {
+		t.Errorf("%d module metadata files kept in memory after the export", len(c.gradleModules))
+	}
+}
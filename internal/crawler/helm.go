@@ -0,0 +1,117 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/caezarr-oss/refap/internal/helm"
+)
+
+// ExportHelm exports the charts of Helm repositories from their index.yaml into a
+// static chart repository: <repository>/index.yaml, pruned to the exported chart
+// versions, and the chart archives next to it, referenced by relative URLs.
+// Charts are filtered by HelmCharts name patterns and the HelmVersions range.
+func (c *Crawler) ExportHelm(repoList []string) error {
+	if err := c.prepare(); err != nil {
+		return err
+	}
+
+	for _, repo := range repoList {
+		if c.spaceErr != nil {
+			return c.spaceErr
+		}
+		repo = strings.TrimSpace(repo)
+		if repo == "" {
+			continue
+		}
+		c.beginRepository(repo)
+
+		indexURL := c.apiURL("helm", repo) + helm.IndexFile
+		data, _, err := c.readURL(indexURL, nil)
+		if err != nil {
+			fmt.Printf("Failed to read the index of %s: %v\n", repo, err)
+			c.summary.RepositoriesFailed++
+			continue
+		}
+		index, err := helm.ParseIndex(data)
+		if err != nil {
+			fmt.Printf("Failed to read the index of %s: %v\n", repo, err)
+			c.summary.RepositoriesFailed++
+			continue
+		}
+
+		fmt.Printf("Exporting Helm repo: %s (%d charts)\n", repo, len(index.Names))
+		repoDir := strings.Trim(repo, "/")
+		exported := make(map[*helm.ChartVersion]bool)
+		for _, name := range index.Names {
+			if len(c.config.HelmCharts) > 0 && !matchPatterns(c.config.HelmCharts, name) {
+				continue
+			}
+			versions, err := helm.Select(index.Entries[name], c.config.HelmVersions, c.config.HelmIncludePrerelease)
+			if err != nil {
+				return fmt.Errorf("invalid Helm versions range: %w", err)
+			}
+			for _, version := range versions {
+				if c.exportChart(repo, indexURL, version) {
+					exported[version] = true
+				}
+			}
+		}
+
+		pruned, err := index.Prune(func(version *helm.ChartVersion) bool { return exported[version] })
+		if err != nil {
+			return err
+		}
+		relPath := path.Join(repoDir, helm.IndexFile)
+		fmt.Printf("Generating %s (%d chart versions)\n", relPath, len(exported))
+		if err := c.writeFile(relPath, pruned); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exportChart downloads the archive of a chart version next to the index and points
+// the version to it. It reports whether the chart version was exported.
+func (c *Crawler) exportChart(repo, indexURL string, version *helm.ChartVersion) bool {
+	if len(version.URLs) == 0 {
+		fmt.Printf("No URL for chart %s %s\n", version.Name, version.Version)
+		return false
+	}
+	base, err := url.Parse(indexURL)
+	if err != nil {
+		return false
+	}
+	ref, err := url.Parse(version.URLs[0])
+	if err != nil {
+		fmt.Printf("Invalid URL for chart %s %s: %v\n", version.Name, version.Version, err)
+		return false
+	}
+	chartURL := base.ResolveReference(ref)
+	filename := path.Base(chartURL.Path)
+	if filename == "/" || filename == "." || filename == ".." {
+		fmt.Printf("Invalid URL for chart %s %s: %s\n", version.Name, version.Version, chartURL)
+		return false
+	}
+
+	entry := Entry{Repo: repo, Path: filename, URL: chartURL.String()}
+	target := c.target(path.Join(strings.Trim(repo, "/"), filename))
+
+	ok := true
+	if c.exists(target) && (c.config.Archive != nil || !c.config.ForceReplace) {
+		c.summary.FilesSkipped++
+	} else if sum, hasSum := version.Sum(); hasSum {
+		ok = c.saveVerified(entry, target, digest{algorithm: "sha256", newHash: sha256.New, sum: sum})
+	} else {
+		fmt.Printf("No digest for %s, the file is not verified\n", filename)
+		ok = c.save(entry, target)
+	}
+	if ok {
+		version.SetURLs(url.PathEscape(filename))
+	}
+	return ok
+}
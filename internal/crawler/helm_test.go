@@ -0,0 +1,182 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/caezarr-oss/refap/internal/helm"
+)
+
+func TestExportHelmSendsCredentialsOnlyToTheSource(t *testing.T) {
+	archive := []byte("chart archive")
+	sum := sha256.Sum256(archive)
+
+	// Charts of a remote repository often keep the absolute URLs of their upstream
+	var upstreamAuth authRecorder
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamAuth.record(r)
+		w.Write(archive)
+	}))
+	defer upstream.Close()
+
+	var sourceAuth authRecorder
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sourceAuth.record(r)
+		switch r.URL.Path {
+		case "/artifactory/api/helm/helm-remote/index.yaml":
+			fmt.Fprintf(w, `apiVersion: v1
+entries:
+  app:
+  - name: app
+    version: 1.0.0
+    digest: %[1]s
+    urls:
+    - %[2]s/charts/app-1.0.0.tgz
+  - name: app
+    version: 1.1.0
+    digest: %[1]s
+    urls:
+    - app-1.1.0.tgz
+`, hex.EncodeToString(sum[:]), upstream.URL)
+		case "/artifactory/api/helm/helm-remote/app-1.1.0.tgz":
+			w.Write(archive)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer source.Close()
+
+	c := newTestCrawler(t, source, Config{})
+	if err := c.ExportHelm([]string{"helm-remote"}); err != nil {
+		t.Fatal(err)
+	}
+	if summary := c.Summary(); summary.FilesDownloaded != 2 || summary.FilesFailed != 0 {
+		t.Fatalf("summary = %+v, want both charts downloaded", summary)
+	}
+
+	if auth, ok := upstreamAuth.auth("/charts/app-1.0.0.tgz"); !ok || auth != "" {
+		t.Errorf("upstream chart requested: %v, with Authorization %q, want no credentials", ok, auth)
+	}
+	if auth, _ := sourceAuth.auth("/artifactory/api/helm/helm-remote/app-1.1.0.tgz"); auth != "Bearer secret" {
+		t.Errorf("source chart requested with Authorization %q, want the token", auth)
+	}
+
+	// The exported index references both archives next to it
+	index, err := os.ReadFile(filepath.Join(c.config.BaseDir, "helm-remote", "index.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(index), upstream.URL) {
+		t.Errorf("exported index still references the upstream:\n%s", index)
+	}
+}
+
+func TestExportHelmPrunesIndexToExportedVersions(t *testing.T) {
+	charts := map[string]string{
+		"app-1.0.0.tgz":      "app 1.0.0",
+		"app-1.1.0.tgz":      "app 1.1.0",
+		"app-2.0.0-rc.1.tgz": "app 2.0.0-rc.1",
+		"app-2.0.0.tgz":      "tampered app 2.0.0",
+		"db-1.0.0.tgz":       "db 1.0.0",
+	}
+	digest := func(content string) string {
+		sum := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(sum[:])
+	}
+
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const prefix = "/artifactory/api/helm/helm-local/"
+		if r.URL.Path == prefix+"index.yaml" {
+			fmt.Fprintf(w, `apiVersion: v1
+entries:
+  app:
+  - name: app
+    version: 1.0.0
+    digest: %s
+    urls:
+    - charts/app-1.0.0.tgz
+  - name: app
+    version: 1.1.0
+    description: The application
+    digest: %s
+    urls:
+    - http://%s%scharts/app-1.1.0.tgz
+  - name: app
+    version: 2.0.0-rc.1
+    digest: %s
+    urls:
+    - charts/app-2.0.0-rc.1.tgz
+  - name: app
+    version: 2.0.0
+    digest: sha256:%s
+    urls:
+    - charts/app-2.0.0.tgz
+  db:
+  - name: db
+    version: 1.0.0
+    digest: %s
+    urls:
+    - charts/db-1.0.0.tgz
+generated: "2024-01-01T00:00:00Z"
+`, digest(charts["app-1.0.0.tgz"]), digest(charts["app-1.1.0.tgz"]), r.Host, prefix,
+				digest(charts["app-2.0.0-rc.1.tgz"]), digest("app 2.0.0"), digest(charts["db-1.0.0.tgz"]))
+			return
+		}
+		content, ok := charts[strings.TrimPrefix(r.URL.Path, prefix+"charts/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, content)
+	}))
+	defer source.Close()
+
+	c := newTestCrawler(t, source, Config{HelmCharts: []string{"ap*"}, HelmVersions: ">=1.1.0"})
+	if err := c.ExportHelm([]string{"helm-local"}); err != nil {
+		t.Fatal(err)
+	}
+	// The prerelease is out of the range, the version whose digest does not match rejected
+	if summary := c.Summary(); summary.FilesDownloaded != 1 || summary.FilesFailed != 1 {
+		t.Errorf("summary = %+v, want 1 chart downloaded and the tampered one failed", summary)
+	}
+
+	repoDir := filepath.Join(c.config.BaseDir, "helm-local")
+	for filename, exported := range map[string]bool{
+		"app-1.0.0.tgz":      false,
+		"app-1.1.0.tgz":      true,
+		"app-2.0.0-rc.1.tgz": false,
+		"app-2.0.0.tgz":      false,
+		"db-1.0.0.tgz":       false,
+	} {
+		if _, err := os.Stat(filepath.Join(repoDir, filename)); exported != (err == nil) {
+			t.Errorf("%s exported: %v, want %v", filename, err == nil, exported)
+		}
+	}
+
+	// The index lists the exported version only, with a URL relative to the index
+	data, err := os.ReadFile(filepath.Join(repoDir, "index.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := helm.ParseIndex(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Names) != 1 || len(index.Entries["app"]) != 1 {
+		t.Fatalf("index lists %v, want app only:\n%s", index.Names, data)
+	}
+	version := index.Entries["app"][0]
+	if version.Version != "1.1.0" || len(version.URLs) != 1 || version.URLs[0] != "app-1.1.0.tgz" {
+		t.Errorf("index entry %+v, want app 1.1.0 at app-1.1.0.tgz", version)
+	}
+	if !strings.Contains(string(data), "description: The application") || strings.Contains(string(data), "2024-01-01") {
+		t.Errorf("index does not keep the fields of the version with a new generated date:\n%s", data)
+	}
+}
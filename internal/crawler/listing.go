@@ -0,0 +1,244 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ListingParser extracts the entries of the directory listing pages of a server
+type ListingParser interface {
+	// Detect reports whether a listing was produced by the server, from its response headers and content
+	Detect(header http.Header, body []byte) bool
+	// Parse extracts the links of the listing at listingURL. Their href may be
+	// relative to listingURL or absolute, readListing resolving them and naming
+	// the entries after their URL.
+	Parse(listingURL string, body []byte) ([]Link, error)
+}
+
+// ListingParsers are the parsers selected by the ListingFormat of the crawler
+var ListingParsers = map[string]ListingParser{
+	"artifactory": artifactoryParser{},
+	"nexus":       nexusParser{},
+	"apache":      apacheParser{},
+	"nginx":       nginxParser{},
+}
+
+// detectOrder is the order in which the parsers are tried by the auto-detection, the
+// markers of the pages coming first as servers are often behind an nginx or Apache
+// proxy. The Artifactory parser is used when none recognizes the listing.
+var detectOrder = []string{"artifactory", "nexus", "apache", "nginx"}
+
+// anchorHrefPattern matches the href attribute of the anchors of a page
+var anchorHrefPattern = regexp.MustCompile(`(?i)<a\s[^>]*?href\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+// readListing downloads a listing page and extracts its entries with the parser
+// of the ListingFormat, or the one recognizing the listing when it is "auto".
+// The links are resolved against the URL the listing was read from after the
+// redirects, those leading to another host or outside rootURL being refused.
+// It also returns that URL.
+func (c *Crawler) readListing(listingURL, rootURL string) ([]Link, string, error) {
+	resp, err := c.fetch(listingURL)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	finalURL := resp.Request.URL.String()
+
+	parser, ok := ListingParsers[c.config.ListingFormat]
+	if !ok {
+		parser = detectListingParser(resp.Header, body)
+	}
+	links, err := parser.Parse(finalURL, body)
+	if err != nil {
+		return nil, "", err
+	}
+	links, err = resolveLinks(finalURL, rootURL, links)
+	return links, finalURL, err
+}
+
+// resolveLinks resolves the href of the links against the listing URL, which is
+// a directory whether or not it ends with a slash, and keeps the direct children
+// of the listing, named after the decoded path of their URL. Links to another
+// host or outside rootURL are refused, parent, sort and duplicate links skipped.
+func resolveLinks(listingURL, rootURL string, links []Link) ([]Link, error) {
+	base, err := url.Parse(dirURL(listingURL))
+	if err != nil {
+		return nil, err
+	}
+	root, err := url.Parse(dirURL(rootURL))
+	if err != nil {
+		return nil, err
+	}
+
+	var resolved []Link
+	seen := make(map[string]bool)
+	for _, l := range links {
+		ref, err := url.Parse(strings.TrimSpace(l.Href))
+		if err != nil || ref.Opaque != "" {
+			continue
+		}
+		target := base.ResolveReference(ref)
+		target.Fragment = ""
+		target.RawFragment = ""
+
+		switch {
+		case !strings.EqualFold(target.Scheme, base.Scheme) || !strings.EqualFold(target.Host, base.Host):
+			fmt.Printf("Refusing link %s of %s: it leads to another host\n", l.Href, listingURL)
+			continue
+		case strings.HasPrefix(base.Path, target.Path):
+			// Link to the listing itself or to a parent
+			continue
+		case !strings.HasPrefix(target.Path, root.Path):
+			fmt.Printf("Refusing link %s of %s: it leads outside of the repository\n", l.Href, listingURL)
+			continue
+		case !strings.HasPrefix(target.Path, base.Path):
+			continue
+		}
+
+		name, isDir := strings.CutSuffix(strings.TrimPrefix(target.Path, base.Path), "/")
+		if name == "" || name == "." || name == ".." || strings.Contains(name, "/") || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		if isDir {
+			name += "/"
+		}
+		resolved = append(resolved, Link{Href: l.Href, Text: name, URL: target.String()})
+	}
+	return resolved, nil
+}
+
+// dirURL returns the URL of a directory ending with a slash, before its query
+func dirURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || strings.HasSuffix(u.Path, "/") {
+		return rawURL
+	}
+	u.Path += "/"
+	if u.RawPath != "" {
+		u.RawPath += "/"
+	}
+	return u.String()
+}
+
+// detectListingParser returns the parser recognizing a listing
+func detectListingParser(header http.Header, body []byte) ListingParser {
+	for _, name := range detectOrder {
+		if ListingParsers[name].Detect(header, body) {
+			return ListingParsers[name]
+		}
+	}
+	return ListingParsers["artifactory"]
+}
+
+// serverIs reports whether the Server header names the product
+func serverIs(header http.Header, product string) bool {
+	return strings.Contains(strings.ToLower(header.Get("Server")), product)
+}
+
+// artifactoryParser reads the listing pages of the Artifactory list/ API
+type artifactoryParser struct{}
+
+func (artifactoryParser) Detect(header http.Header, body []byte) bool {
+	return header.Get("X-Artifactory-Id") != "" || serverIs(header, "artifactory") || bytes.Contains(body, []byte("Artifactory"))
+}
+
+func (artifactoryParser) Parse(listingURL string, body []byte) ([]Link, error) {
+	links := parseListing(body)
+	for i := range links {
+		links[i].Href = html.UnescapeString(links[i].Href)
+	}
+	return links, nil
+}
+
+// nexusParser reads the browse pages of Nexus 3 (/service/rest/repository/browse/<repository>/)
+// and the content listings of Nexus 2, whose links are absolute URLs
+type nexusParser struct{}
+
+func (nexusParser) Detect(header http.Header, body []byte) bool {
+	return serverIs(header, "nexus") || bytes.Contains(body, []byte("Nexus Repository Manager"))
+}
+
+func (nexusParser) Parse(listingURL string, body []byte) ([]Link, error) {
+	return anchorLinks(body), nil
+}
+
+// apacheParser reads the listings of Apache httpd mod_autoindex, whose names are truncated
+type apacheParser struct{}
+
+func (apacheParser) Detect(header http.Header, body []byte) bool {
+	return serverIs(header, "apache") || bytes.Contains(body, []byte("?C=N;O=D"))
+}
+
+func (apacheParser) Parse(listingURL string, body []byte) ([]Link, error) {
+	return anchorLinks(body), nil
+}
+
+// nginxParser reads the listings of nginx autoindex, in the html or json format
+type nginxParser struct{}
+
+// nginxEntry is an entry of an nginx autoindex listing in the json format
+type nginxEntry struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+func (nginxParser) Detect(header http.Header, body []byte) bool {
+	return serverIs(header, "nginx") || isJSONListing(header, body)
+}
+
+func (nginxParser) Parse(listingURL string, body []byte) ([]Link, error) {
+	if !isJSONListing(nil, body) {
+		return anchorLinks(body), nil
+	}
+
+	var entries []nginxEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("error parsing json listing: %w", err)
+	}
+	links := make([]Link, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Name == "" || entry.Name == "." || entry.Name == ".." || strings.Contains(entry.Name, "/") {
+			continue
+		}
+		l := Link{Href: url.PathEscape(entry.Name), Text: entry.Name}
+		if entry.Type == "directory" {
+			l.Href += "/"
+			l.Text += "/"
+		}
+		links = append(links, l)
+	}
+	return links, nil
+}
+
+// isJSONListing reports whether a listing is in the json format
+func isJSONListing(header http.Header, body []byte) bool {
+	if header != nil && strings.Contains(header.Get("Content-Type"), "json") {
+		return true
+	}
+	return bytes.HasPrefix(bytes.TrimSpace(body), []byte("["))
+}
+
+// anchorLinks extracts the href of the anchors of an html listing. Entries are
+// named after their href by readListing, as the text of the anchors may be truncated.
+func anchorLinks(body []byte) []Link {
+	var links []Link
+	for _, match := range anchorHrefPattern.FindAllSubmatch(body, -1) {
+		href := html.UnescapeString(string(match[1]) + string(match[2]))
+		links = append(links, Link{Href: href, Text: href})
+	}
+	return links
+}
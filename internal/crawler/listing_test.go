@@ -0,0 +1,250 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/caezarr-oss/refap/config"
+)
+
+func TestWalkResolvesLinksAgainstRedirectedListing(t *testing.T) {
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/artifactory/list/libs/":
+			fmt.Fprint(w, `<a href="old/">old/</a>`)
+		case "/artifactory/list/libs/old/":
+			http.Redirect(w, r, "/artifactory/list/libs/new/", http.StatusMovedPermanently)
+		case "/artifactory/list/libs/new/":
+			fmt.Fprint(w, `<a href="../">../</a> <a href="lib-1.0.jar">lib-1.0.jar</a>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer source.Close()
+
+	c := newTestCrawler(t, source, Config{ListingFormat: "nexus", FilterMode: config.FilterModeBlacklist})
+	var urls []string
+	err := c.Walk("libs", func(entry Entry) error {
+		urls = append(urls, entry.URL)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The relative links of the listing are those of the page it was redirected to
+	want := source.URL + "/artifactory/list/libs/new/lib-1.0.jar"
+	if len(urls) != 1 || urls[0] != want {
+		t.Errorf("urls = %v, want %s", urls, want)
+	}
+}
+
+func TestWalkSkipsHostileListingLinks(t *testing.T) {
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/artifactory/list/libs/":
+			fmt.Fprint(w, `
+				<a href="../">../</a>
+				<a href="../../etc/cron.d/x">x</a>
+				<a href="/etc/passwd">passwd</a>
+				<a href="/artifactory/list/other/lib-1.0.jar">lib-1.0.jar</a>
+				<a href="http://evil.example.com/lib-1.0.jar">lib-1.0.jar</a>
+				<a href="%2e%2e/%2e%2e/x.jar">x.jar</a>
+				<a href="..%2f..%2fx.jar">x.jar</a>
+				<a href="org/../../x.jar">x.jar</a>
+				<a href="org/">org/</a>
+				<a href="foo..bar-1.0.jar">foo..bar-1.0.jar</a>`)
+		case "/artifactory/list/libs/org/":
+			fmt.Fprint(w, `<a href="..">..</a> <a href="../../libs/org/lib-2.0.jar">lib-2.0.jar</a> <a href="lib-3.0.jar">lib-3.0.jar</a>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer source.Close()
+
+	c := newTestCrawler(t, source, Config{ListingFormat: "nexus", FilterMode: config.FilterModeBlacklist})
+	paths := make(map[string]string)
+	err := c.Walk("libs", func(entry Entry) error {
+		paths[entry.Path] = entry.URL
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the direct children of each listing are kept, whatever their href, and
+	// names containing dots are not mistaken for parent links
+	repoURL := source.URL + "/artifactory/list/libs/"
+	want := map[string]string{
+		"foo..bar-1.0.jar": repoURL + "foo..bar-1.0.jar",
+		"org/lib-2.0.jar":  repoURL + "org/lib-2.0.jar",
+		"org/lib-3.0.jar":  repoURL + "org/lib-3.0.jar",
+	}
+	if len(paths) != len(want) {
+		t.Errorf("paths = %v, want %v", paths, want)
+	}
+	for entryPath, wantURL := range want {
+		if paths[entryPath] != wantURL {
+			t.Errorf("%s URL = %q, want %s", entryPath, paths[entryPath], wantURL)
+		}
+	}
+}
+
+// Sample listing pages of the supported servers, as served for http://repo.example.com/repo/org/example/
+const (
+	artifactoryListing = `<!DOCTYPE html>
+<html>
+<head><meta name="robots" content="noindex" />
+<title>Index of libs-release/org/example</title>
+</head>
+<body>
+<h1>Index of libs-release/org/example</h1>
+<pre>Name                 Last modified      Size</pre><hr/>
+<pre><a href="../">../</a>
+<a href="lib/">lib/</a>                  12-Mar-2024 10:15    -
+<a href="lib-1.0.jar">lib-1.0.jar</a>           12-Mar-2024 10:15  4.12 KB
+</pre>
+<hr/><address style="font-size:small;">Artifactory/7.77.5 Server at repo.example.com Port 443</address></body></html>
+`
+
+	nexusListing = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <title>Index of /org/example</title>
+  <meta http-equiv="Content-Type" content="text/html; charset=UTF-8"/>
+  <link rel="icon" type="image/png" href="../../../../../static/rapture/resources/safari-favicon-32x32.png?3.66.0-02" sizes="32x32">
+  <link rel="stylesheet" type="text/css" href="../../../../../static/css/nexus-content.css?3.66.0-02"/>
+</head>
+<body class="htmlIndex">
+<div class="nexus-header">
+  <a href="../../../../../">
+    <div class="product-logo">
+      <img src="../../../../../static/rapture/resources/images/nexus.png?3.66.0-02" alt="Product logo"/>
+    </div>
+    <div class="product-id">
+      <div class="product-id__line1">
+        <span class="product-name">Nexus Repository Manager</span>
+      </div>
+      <div class="product-id__line2">
+        <span class="product-spec">OSS 3.66.0-02</span>
+      </div>
+    </div>
+  </a>
+</div>
+
+<div class="nexus-body">
+  <div class="content-header">
+    <img src="../../../../../static/rapture/resources/icons/x32/folder.png?3.66.0-02" alt="Folder icon"/>
+    <h1>Index of /org/example</h1>
+  </div>
+  <div class="content-body">
+    <table cellspacing="10">
+      <tr>
+        <th align="left">Name</th>
+        <th>Last Modified</th>
+        <th>Size</th>
+        <th>Description</th>
+      </tr>
+      <tr>
+        <td><a href="../">Parent Directory</a></td>
+      </tr>
+      <tr>
+        <td><a href="lib/">lib</a></td>
+        <td>&nbsp;</td>
+        <td align="right">&nbsp;</td>
+        <td></td>
+      </tr>
+      <tr>
+        <td><a href="lib-1.0.jar">lib-1.0.jar</a></td>
+        <td>Tue Mar 12 10:15:00 UTC 2024</td>
+        <td align="right">4215</td>
+        <td></td>
+      </tr>
+    </table>
+  </div>
+</div>
+</body>
+</html>
+`
+
+	apacheListing = `<!DOCTYPE HTML PUBLIC "-//W3C//DTD HTML 3.2 Final//EN">
+<html>
+ <head>
+  <title>Index of /repo/org/example</title>
+ </head>
+ <body>
+<h1>Index of /repo/org/example</h1>
+<pre><img src="/icons/blank.gif" alt="Icon "> <a href="?C=N;O=D">Name</a>                    <a href="?C=M;O=A">Last modified</a>      <a href="?C=S;O=A">Size</a>  <a href="?C=D;O=A">Description</a><hr><img src="/icons/back.gif" alt="[PARENTDIR]"> <a href="/repo/org/">Parent Directory</a>                             -   
+<img src="/icons/folder.gif" alt="[DIR]"> <a href="lib/">lib/</a>                    2024-03-12 10:15    -   
+<img src="/icons/unknown.gif" alt="[   ]"> <a href="lib-1.0-javadoc-and-sources.jar">lib-1.0-javadoc-and-so..&gt;</a> 2024-03-12 10:15  4.1K  
+<hr></pre>
+<address>Apache/2.4.58 (Debian) Server at repo.example.com Port 80</address>
+</body></html>
+`
+
+	nginxListing = `<html>
+<head><title>Index of /repo/org/example/</title></head>
+<body>
+<h1>Index of /repo/org/example/</h1><hr><pre><a href="../">../</a>
+<a href="lib/">lib/</a>                                               12-Mar-2024 10:15                   -
+<a href="lib-1.0-javadoc-and-sources.jar">lib-1.0-javadoc-and-sources.jar</a>                    12-Mar-2024 10:15                4215
+<a href="lib%201.0.jar">lib 1.0.jar</a>                                        12-Mar-2024 10:15                4215
+</pre><hr></body>
+</html>
+`
+
+	nginxJSONListing = `[
+{ "name":"lib", "type":"directory", "mtime":"Tue, 12 Mar 2024 10:15:00 GMT" },
+{ "name":"lib 1.0.jar", "type":"file", "mtime":"Tue, 12 Mar 2024 10:15:00 GMT", "size":4215 }
+]
+`
+)
+
+func TestDetectListingParser(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		header  http.Header
+		body    string
+		want    string
+		entries []string
+	}{
+		{"artifactory", http.Header{"X-Artifactory-Id": {"a1b2c3"}}, artifactoryListing, "artifactory", []string{"lib/", "lib-1.0.jar"}},
+		{"artifactory behind nginx", http.Header{"Server": {"nginx/1.24.0"}}, artifactoryListing, "artifactory", []string{"lib/", "lib-1.0.jar"}},
+		{"nexus", http.Header{"Server": {"Nexus/3.66.0-02 (OSS)"}}, nexusListing, "nexus", []string{"lib/", "lib-1.0.jar"}},
+		{"nexus behind apache", http.Header{"Server": {"Apache/2.4.58 (Debian)"}}, nexusListing, "nexus", []string{"lib/", "lib-1.0.jar"}},
+		{"apache", http.Header{"Server": {"Apache/2.4.58 (Debian)"}}, apacheListing, "apache", []string{"lib/", "lib-1.0-javadoc-and-sources.jar"}},
+		{"apache without server header", nil, apacheListing, "apache", []string{"lib/", "lib-1.0-javadoc-and-sources.jar"}},
+		{"nginx", http.Header{"Server": {"nginx/1.24.0"}}, nginxListing, "nginx", []string{"lib/", "lib-1.0-javadoc-and-sources.jar", "lib 1.0.jar"}},
+		{"nginx json", http.Header{"Server": {"nginx/1.24.0"}, "Content-Type": {"application/json"}}, nginxJSONListing, "nginx", []string{"lib/", "lib 1.0.jar"}},
+		{"nginx json without headers", nil, nginxJSONListing, "nginx", []string{"lib/", "lib 1.0.jar"}},
+		// Without a Server header, an nginx html listing is read as an Artifactory one
+		{"nginx without server header", nil, nginxListing, "artifactory", []string{"lib/", "lib-1.0-javadoc-and-sources.jar", "lib 1.0.jar"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			parser := detectListingParser(test.header, []byte(test.body))
+			if parser != ListingParsers[test.want] {
+				t.Fatalf("detected %T, want the %s parser", parser, test.want)
+			}
+
+			listingURL := "http://repo.example.com/repo/org/example/"
+			links, err := parser.Parse(listingURL, []byte(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			links, err = resolveLinks(listingURL, "http://repo.example.com/repo/", links)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var entries []string
+			for _, l := range links {
+				entries = append(entries, l.Text)
+			}
+			if strings.Join(entries, "|") != strings.Join(test.entries, "|") {
+				t.Errorf("entries = %q, want %q", entries, test.entries)
+			}
+		})
+	}
+}
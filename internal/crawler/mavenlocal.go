@@ -0,0 +1,255 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/caezarr-oss/refap/config"
+	"github.com/caezarr-oss/refap/internal/maven"
+	"github.com/caezarr-oss/refap/internal/pathutil"
+)
+
+// remoteRepositoriesFile is the Maven Resolver file recording, for each file of
+// a local repository directory, the ids of the repositories it was downloaded from
+const remoteRepositoriesFile = "_remote.repositories"
+
+// sidecarSuffixes are the extensions of the checksum and signature files of an artifact
+var sidecarSuffixes = []string{".md5", ".sha1", ".sha256", ".sha512", ".asc"}
+
+// exportMavenLocal exports a file into a Maven local repository tree merging all
+// the repositories. The repository metadata is renamed maven-metadata-<id>.xml
+// and the origin of the other files is recorded in _remote.repositories.
+func (c *Crawler) exportMavenLocal(entry Entry) bool {
+	id := c.repositoryID(entry.Repo)
+	relPath := mavenLocalPath(entry.Path, id)
+	target := c.target(relPath)
+
+	// Remote metadata is kept per repository, so it never conflicts
+	if relPath != entry.Path {
+		if c.exists(target) && (c.config.Archive != nil || !c.config.ForceReplace) {
+			c.summary.FilesSkipped++
+			return true
+		}
+		return c.saveEntry(entry, target)
+	}
+
+	dir, name := path.Split(relPath)
+	files := c.mavenFiles(dir)
+	origins := files[name]
+	if len(origins) == 0 {
+		// Checksums and signatures follow the artifact they belong to
+		origins = files[sidecarOf(name)]
+	}
+
+	if !c.exists(target) || (origins[id] && len(origins) == 1 && c.config.Archive == nil && c.config.ForceReplace) {
+		if !c.saveEntry(entry, target) {
+			return false
+		}
+		recordOrigin(files, name, id)
+		return true
+	}
+
+	if origins[id] {
+		c.summary.FilesSkipped++
+		return true
+	}
+
+	// Another repository already provided this file, compare the contents
+	same, err := c.sameContent(entry.URL, target)
+	if err != nil {
+		c.summary.FilesFailed++
+		fmt.Printf("Failed to compare %s with %s: %v\n", entry.URL, target, err)
+		return false
+	}
+	if same {
+		recordOrigin(files, name, id)
+		c.summary.FilesSkipped++
+		return true
+	}
+
+	c.summary.Conflicts++
+	fmt.Printf("Conflict: %s from %s differs from the file provided by %s\n", relPath, id, strings.Join(sortedKeys(origins), ", "))
+	if c.config.ConflictPolicy == config.ConflictFail {
+		c.summary.FilesFailed++
+		return false
+	}
+	c.summary.FilesSkipped++
+	return true
+}
+
+// repositoryID returns the Maven repository id of a repository
+func (c *Crawler) repositoryID(repo string) string {
+	repo = strings.Trim(repo, "/")
+	if id, ok := c.config.RepositoryIDs[repo]; ok {
+		return id
+	}
+	return repo
+}
+
+// mavenFiles returns the origins of the files of a directory of the local
+// repository, loading the _remote.repositories file left by a previous export
+func (c *Crawler) mavenFiles(dir string) map[string]map[string]bool {
+	if files, ok := c.mavenOrigins[dir]; ok {
+		return files
+	}
+
+	files := make(map[string]map[string]bool)
+	c.mavenOrigins[dir] = files
+	if c.config.Archive != nil {
+		return files
+	}
+
+	f, err := os.Open(pathutil.SafeJoin(c.baseDir, filepath.FromSlash(dir), remoteRepositoriesFile))
+	if err != nil {
+		return files
+	}
+	defer f.Close()
+
+	// Lines have the form "<file>><repository id>=", comments start with #
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, id, ok := strings.Cut(strings.TrimSuffix(line, "="), ">")
+		if ok {
+			recordOrigin(files, name, id)
+		}
+	}
+	return files
+}
+
+// sameContent reports whether the file at urlStr has the same content as the exported target
+func (c *Crawler) sameContent(urlStr, target string) (bool, error) {
+	var existing string
+	if c.config.Archive != nil {
+		entry, ok := c.config.Archive.Lookup(target)
+		if !ok {
+			return false, fmt.Errorf("%s is missing from the archive index", target)
+		}
+		existing = entry.SHA256
+	} else {
+		f, err := os.Open(target)
+		if err != nil {
+			return false, err
+		}
+		hash := sha256.New()
+		_, err = io.Copy(hash, f)
+		f.Close()
+		if err != nil {
+			return false, err
+		}
+		existing = hex.EncodeToString(hash.Sum(nil))
+	}
+
+	resp, err := c.fetch(urlStr)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	// Artifactory reports the sha256 of the file, otherwise hash the content
+	remote := resp.Header.Get("X-Checksum-Sha256")
+	if remote == "" {
+		hash := sha256.New()
+		if _, err := io.Copy(hash, resp.Body); err != nil {
+			return false, err
+		}
+		remote = hex.EncodeToString(hash.Sum(nil))
+	}
+	return strings.EqualFold(remote, existing), nil
+}
+
+// writeRemoteRepositories writes the _remote.repositories file of every directory of the local repository
+func (c *Crawler) writeRemoteRepositories() error {
+	dirs := sortedKeys(c.mavenOrigins)
+	for _, dir := range dirs {
+		var content bytes.Buffer
+		for _, name := range sortedKeys(c.mavenOrigins[dir]) {
+			if isSidecar(name) {
+				continue
+			}
+			for _, id := range sortedKeys(c.mavenOrigins[dir][name]) {
+				fmt.Fprintf(&content, "%s>%s=\n", name, id)
+			}
+		}
+		if content.Len() == 0 {
+			continue
+		}
+
+		data := []byte("#NOTE: This is a Maven Resolver internal implementation file, its format can be changed without prior notice.\n" +
+			"#" + time.Now().Format("Mon Jan 02 15:04:05 MST 2006") + "\n" + content.String())
+
+		if c.config.Archive != nil {
+			name := path.Join(c.config.ArchivePrefix, dir, remoteRepositoriesFile)
+			if _, err := c.config.Archive.Add(name, int64(len(data)), time.Now(), bytes.NewReader(data)); err != nil {
+				return fmt.Errorf("failed to archive %s: %w", name, err)
+			}
+			continue
+		}
+
+		markerPath := pathutil.SafeJoin(c.baseDir, filepath.FromSlash(dir), remoteRepositoriesFile)
+		if err := c.checkTarget(markerPath); err != nil {
+			return err
+		}
+		if err := os.WriteFile(markerPath, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", markerPath, err)
+		}
+	}
+	return nil
+}
+
+// mavenLocalPath returns the path of a file in the local repository.
+// The repository metadata and its checksums are suffixed with the repository id.
+func mavenLocalPath(relPath, id string) string {
+	dir, name := path.Split(relPath)
+	if !strings.HasPrefix(name, maven.MetadataName) {
+		return relPath
+	}
+	base := strings.TrimSuffix(maven.MetadataName, ".xml")
+	return dir + base + "-" + id + ".xml" + strings.TrimPrefix(name, maven.MetadataName)
+}
+
+// isSidecar reports whether a file is the checksum or signature of another file
+func isSidecar(name string) bool {
+	return sidecarOf(name) != name
+}
+
+// sidecarOf returns the artifact a checksum or signature file belongs to, or name itself
+func sidecarOf(name string) string {
+	for _, suffix := range sidecarSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+	return name
+}
+
+// recordOrigin records that a repository provides a file
+func recordOrigin(files map[string]map[string]bool, name, id string) {
+	if files[name] == nil {
+		files[name] = make(map[string]bool)
+	}
+	files[name][id] = true
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
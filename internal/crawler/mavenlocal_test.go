@@ -0,0 +1,118 @@
+package crawler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/caezarr-oss/refap/config"
+)
+
+// readExported returns the content of an exported file, failing when it is missing
+func readExported(t *testing.T, c *Crawler, relPath string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(c.baseDir, filepath.FromSlash(relPath)))
+	if err != nil {
+		t.Fatalf("%s not exported: %v", relPath, err)
+	}
+	return string(data)
+}
+
+func TestExportMavenLocalMergesRepositories(t *testing.T) {
+	_, source := newListingStub(t, map[string]string{
+		"libs-release/org/acme/lib/1.0/lib-1.0.jar":      "lib 1.0",
+		"libs-release/org/acme/lib/1.0/lib-1.0.jar.sha1": "sha1 of lib 1.0",
+		"libs-release/org/acme/lib/maven-metadata.xml":   "release metadata",
+		"remote-cache/org/acme/lib/1.0/lib-1.0.jar":      "lib 1.0",
+		"remote-cache/org/acme/lib/2.0/lib-2.0.jar":      "lib 2.0",
+		"remote-cache/org/acme/lib/maven-metadata.xml":   "central metadata",
+	})
+	c := newTestCrawler(t, source, Config{
+		FilterMode:           config.FilterModeBlacklist,
+		IncludeMavenMetadata: true,
+		Layout:               config.LayoutMavenLocal,
+		RepositoryIDs:        map[string]string{"remote-cache": "central"},
+	})
+	if err := c.ProcessRepositories([]string{"libs-release", "remote-cache"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The metadata of each repository is kept under the name Maven Resolver gives it
+	if got := readExported(t, c, "org/acme/lib/maven-metadata-libs-release.xml"); got != "release metadata" {
+		t.Errorf("maven-metadata-libs-release.xml = %q", got)
+	}
+	if got := readExported(t, c, "org/acme/lib/maven-metadata-central.xml"); got != "central metadata" {
+		t.Errorf("maven-metadata-central.xml = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(c.baseDir, "org", "acme", "lib", "maven-metadata.xml")); err == nil {
+		t.Error("maven-metadata.xml exported without the repository id")
+	}
+
+	// A file provided by both repositories lists both, its checksums none
+	remote := readExported(t, c, "org/acme/lib/1.0/_remote.repositories")
+	if !strings.HasPrefix(remote, "#NOTE: This is a Maven Resolver internal implementation file") {
+		t.Errorf("_remote.repositories without the Maven Resolver header:\n%s", remote)
+	}
+	lines := strings.Split(strings.TrimSpace(remote), "\n")[2:]
+	if want := []string{"lib-1.0.jar>central=", "lib-1.0.jar>libs-release="}; strings.Join(lines, ",") != strings.Join(want, ",") {
+		t.Errorf("_remote.repositories of 1.0 lists %v, want %v", lines, want)
+	}
+	if remote := readExported(t, c, "org/acme/lib/2.0/_remote.repositories"); !strings.HasSuffix(remote, "\nlib-2.0.jar>central=\n") {
+		t.Errorf("_remote.repositories of 2.0 does not list central:\n%s", remote)
+	}
+
+	summary := c.Summary()
+	if summary.FilesDownloaded != 5 || summary.FilesSkipped != 1 || summary.Conflicts != 0 {
+		t.Errorf("summary = %+v, want 5 files downloaded and the identical copy skipped", summary)
+	}
+}
+
+func TestExportMavenLocalConflictPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy config.ConflictPolicy
+		failed int
+	}{
+		{config.ConflictFirst, 0},
+		{config.ConflictFail, 1},
+	} {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			_, source := newListingStub(t, map[string]string{
+				"libs-release/org/acme/lib/1.0/lib-1.0.jar": "first build",
+				"libs-staging/org/acme/lib/1.0/lib-1.0.jar": "second build",
+			})
+			c := newTestCrawler(t, source, Config{
+				FilterMode:     config.FilterModeBlacklist,
+				Layout:         config.LayoutMavenLocal,
+				ConflictPolicy: tc.policy,
+			})
+			if err := c.ProcessRepositories([]string{"libs-release", "libs-staging"}); err != nil {
+				t.Fatal(err)
+			}
+
+			// The file of the first repository is kept whatever the policy
+			if got := readExported(t, c, "org/acme/lib/1.0/lib-1.0.jar"); got != "first build" {
+				t.Errorf("lib-1.0.jar = %q, want the file of the first repository", got)
+			}
+			if remote := readExported(t, c, "org/acme/lib/1.0/_remote.repositories"); strings.Contains(remote, "libs-staging") {
+				t.Errorf("_remote.repositories lists the conflicting repository:\n%s", remote)
+			}
+			summary := c.Summary()
+			if summary.Conflicts != 1 || summary.FilesFailed != tc.failed {
+				t.Errorf("summary = %+v, want 1 conflict and %d failed files", summary, tc.failed)
+			}
+		})
+	}
+}
+
+func TestMavenLocalPath(t *testing.T) {
+	for relPath, want := range map[string]string{
+		"org/acme/lib/maven-metadata.xml":      "org/acme/lib/maven-metadata-central.xml",
+		"org/acme/lib/maven-metadata.xml.sha1": "org/acme/lib/maven-metadata-central.xml.sha1",
+		"org/acme/lib/1.0/lib-1.0.jar":         "org/acme/lib/1.0/lib-1.0.jar",
+	} {
+		if got := mavenLocalPath(relPath, "central"); got != want {
+			t.Errorf("mavenLocalPath(%q) = %q, want %q", relPath, got, want)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/caezarr-oss/refap/config"
+	"github.com/caezarr-oss/refap/internal/maven"
+	"github.com/caezarr-oss/refap/internal/pathutil"
+)
+
+// exportedArtifact is an artifact found in the export with its versions
+type exportedArtifact struct {
+	groupID    string
+	artifactID string
+	versions   []string
+}
+
+// isMavenMetadata reports whether a file is a maven-metadata.xml file or one of its checksums
+func isMavenMetadata(name string) bool {
+	return sidecarOf(name) == maven.MetadataName
+}
+
+// keepMavenMetadata reads the metadata found on the server in memory instead of
+// exporting it. It is used to carry the plugins of group metadata and the
+// snapshot version metadata over to the regenerated files.
+func (c *Crawler) keepMavenMetadata(entry Entry) {
+	if path.Base(entry.Path) != maven.MetadataName {
+		return
+	}
+
+	resp, err := c.fetch(entry.URL)
+	if err != nil {
+		fmt.Printf("Failed to download %s: %v\n", entry.URL, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Printf("Failed to download %s: %v\n", entry.URL, err)
+		return
+	}
+
+	relPath := path.Join(strings.Trim(entry.Repo, "/"), entry.Path)
+	if c.config.Layout == config.LayoutMavenLocal {
+		relPath = mavenLocalPath(entry.Path, c.repositoryID(entry.Repo))
+	}
+	c.remoteMetadata[relPath] = data
+}
+
+// regenerateMavenMetadata writes the maven-metadata.xml files of the export,
+// listing only the versions actually exported, with their .sha1 and .md5 files
+func (c *Crawler) regenerateMavenMetadata(repoList []string) error {
+	// The merged layout has a single root, the mirror layout one per repository
+	roots := []string{""}
+	if c.config.Layout != config.LayoutMavenLocal {
+		roots = roots[:0]
+		for _, repo := range repoList {
+			if repo = strings.Trim(strings.TrimSpace(repo), "/"); repo != "" {
+				roots = append(roots, repo)
+			}
+		}
+	}
+
+	now := time.Now()
+	versionDirs := make(map[string]bool)
+	for _, root := range roots {
+		files, err := c.exportedFiles(root)
+		if err != nil {
+			return err
+		}
+		artifacts := collectArtifacts(files)
+
+		// Artifact metadata
+		groupDirs := make(map[string]bool)
+		for _, dir := range sortedKeys(artifacts) {
+			artifact := artifacts[dir]
+			groupDirs[path.Dir(dir)] = true
+			for _, version := range artifact.versions {
+				versionDirs[path.Join(root, dir, version)] = true
+			}
+
+			for name, versions := range c.artifactVersions(root, dir, artifact) {
+				metadata := maven.NewArtifactMetadata(artifact.groupID, artifact.artifactID, versions, now)
+				if err := c.writeMavenMetadata(path.Join(root, dir, name), metadata); err != nil {
+					return err
+				}
+			}
+		}
+
+		// Group metadata listing the plugins of the group
+		for _, dir := range sortedKeys(groupDirs) {
+			if artifacts[dir] != nil {
+				continue
+			}
+			for name, original := range c.originalMetadata(path.Join(root, dir)) {
+				if original.Plugins == nil || len(original.Plugins.Plugin) == 0 {
+					continue
+				}
+				metadata := &maven.Metadata{GroupID: original.GroupID, Plugins: &maven.Plugins{}}
+				for _, plugin := range original.Plugins.Plugin {
+					if artifacts[path.Join(dir, plugin.ArtifactID)] != nil {
+						metadata.Plugins.Plugin = append(metadata.Plugins.Plugin, plugin)
+					}
+				}
+				if err := c.writeMavenMetadata(path.Join(root, dir, name), metadata); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// Snapshot version metadata of the exported versions is copied as found on the server
+	for _, relPath := range sortedKeys(c.remoteMetadata) {
+		if !versionDirs[path.Dir(relPath)] {
+			continue
+		}
+		original, err := maven.ParseMetadata(c.remoteMetadata[relPath])
+		if err != nil || original.Version == "" {
+			continue
+		}
+		if err := c.writeMetadataFile(relPath, c.remoteMetadata[relPath]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exportedFiles lists the slash separated paths of the files exported below root
+func (c *Crawler) exportedFiles(root string) ([]string, error) {
+	var files []string
+
+	if c.config.Archive != nil {
+		prefix := path.Join(c.config.ArchivePrefix, root)
+		if prefix != "" {
+			prefix += "/"
+		}
+		for _, entry := range c.config.Archive.Entries() {
+			if strings.HasPrefix(entry.Path, prefix) {
+				files = append(files, strings.TrimPrefix(entry.Path, prefix))
+			}
+		}
+		return files, nil
+	}
+
+	rootDir := c.target(root)
+	err := filepath.WalkDir(rootDir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && filePath == rootDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(rootDir, filePath)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the exported files of %s: %w", rootDir, err)
+	}
+	return files, nil
+}
+
+// artifactVersions returns the versions to list in each metadata file of an artifact.
+// The merged layout has one maven-metadata-<id>.xml per repository listing the
+// versions it provides, according to _remote.repositories.
+func (c *Crawler) artifactVersions(root, dir string, artifact *exportedArtifact) map[string][]string {
+	if c.config.Layout != config.LayoutMavenLocal {
+		return map[string][]string{maven.MetadataName: artifact.versions}
+	}
+
+	byName := make(map[string][]string)
+	for _, version := range artifact.versions {
+		ids := make(map[string]bool)
+		for name, origins := range c.mavenFiles(path.Join(root, dir, version) + "/") {
+			if isSidecar(name) {
+				continue
+			}
+			for id := range origins {
+				ids[id] = true
+			}
+		}
+		for id := range ids {
+			name := mavenLocalPath(maven.MetadataName, id)
+			byName[name] = append(byName[name], version)
+		}
+	}
+	return byName
+}
+
+// originalMetadata returns the metadata files of a directory as found on the
+// server, or left on disk by a previous export, by file name
+func (c *Crawler) originalMetadata(dir string) map[string]*maven.Metadata {
+	originals := make(map[string]*maven.Metadata)
+	for relPath, data := range c.remoteMetadata {
+		if path.Dir(relPath) != dir {
+			continue
+		}
+		if metadata, err := maven.ParseMetadata(data); err == nil {
+			originals[path.Base(relPath)] = metadata
+		}
+	}
+
+	if c.config.Archive != nil {
+		return originals
+	}
+
+	entries, err := os.ReadDir(c.target(dir))
+	if err != nil {
+		return originals
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if originals[name] != nil || !strings.HasPrefix(name, "maven-metadata") || !strings.HasSuffix(name, ".xml") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(c.target(dir), name))
+		if err != nil {
+			continue
+		}
+		if metadata, err := maven.ParseMetadata(data); err == nil {
+			originals[name] = metadata
+		}
+	}
+	return originals
+}
+
+// writeMavenMetadata writes a metadata document with its checksums
+func (c *Crawler) writeMavenMetadata(relPath string, metadata *maven.Metadata) error {
+	data, err := metadata.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to generate %s: %w", relPath, err)
+	}
+	return c.writeMetadataFile(relPath, data)
+}
+
+// writeMetadataFile writes a metadata file and its .sha1 and .md5 files to the archive or the output directory
+func (c *Crawler) writeMetadataFile(relPath string, data []byte) error {
+	sha1Sum, md5Sum := maven.Checksums(data)
+	files := []struct {
+		relPath string
+		data    []byte
+	}{
+		{relPath, data},
+		{relPath + ".sha1", []byte(sha1Sum)},
+		{relPath + ".md5", []byte(md5Sum)},
+	}
+
+	fmt.Printf("Generating %s\n", relPath)
+	for _, file := range files {
+		if err := c.writeFile(file.relPath, file.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile writes a generated file of the export to the archive or the output directory
+func (c *Crawler) writeFile(relPath string, data []byte) error {
+	target := c.target(relPath)
+	if err := c.waitForSpace(int64(len(data))); err != nil {
+		return err
+	}
+	if c.config.Archive != nil {
+		if _, err := c.config.Archive.Add(target, int64(len(data)), time.Now(), bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("failed to archive %s: %w", target, c.spaceError(err))
+		}
+		return nil
+	}
+
+	if err := c.checkTarget(target); err != nil {
+		return err
+	}
+	if err := pathutil.EnsureDirectoryExists(filepath.Dir(target)); err != nil {
+		return err
+	}
+	if c.config.Store != nil {
+		// The file may be a link to the content store, which must not be written through
+		os.Remove(target)
+	}
+	if err := os.WriteFile(target, data, 0644); err != nil {
+		os.Remove(target)
+		return fmt.Errorf("failed to write %s: %w", target, c.spaceError(err))
+	}
+	return nil
+}
+
+// collectArtifacts finds the artifacts of a repository tree from its file paths,
+// laid out as <group path>/<artifactId>/<version>/<artifactId>-<version>*.
+// Artifacts are keyed by their directory.
+func collectArtifacts(files []string) map[string]*exportedArtifact {
+	artifacts := make(map[string]*exportedArtifact)
+	seen := make(map[string]bool)
+
+	for _, file := range files {
+		parts := strings.Split(file, "/")
+		n := len(parts)
+		if n < 4 {
+			continue
+		}
+		artifactID, version, name := parts[n-3], parts[n-2], parts[n-1]
+		if isMavenMetadata(name) || name == remoteRepositoriesFile {
+			continue
+		}
+		// Timestamped snapshots replace SNAPSHOT with the timestamp in the file name
+		if !strings.HasPrefix(name, artifactID+"-"+strings.TrimSuffix(version, "SNAPSHOT")) {
+			continue
+		}
+
+		dir := strings.Join(parts[:n-2], "/")
+		artifact := artifacts[dir]
+		if artifact == nil {
+			artifact = &exportedArtifact{
+				groupID:    strings.Join(parts[:n-3], "."),
+				artifactID: artifactID,
+			}
+			artifacts[dir] = artifact
+		}
+		if !seen[dir+"/"+version] {
+			seen[dir+"/"+version] = true
+			artifact.versions = append(artifact.versions, version)
+		}
+	}
+
+	return artifacts
+}
@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/caezarr-oss/refap/config"
+	"github.com/caezarr-oss/refap/internal/maven"
+)
+
+// readMetadata parses an exported maven-metadata.xml file and checks its checksums
+func readMetadata(t *testing.T, c *Crawler, relPath string) *maven.Metadata {
+	t.Helper()
+	data := readExported(t, c, relPath)
+	sha1Sum, md5Sum := maven.Checksums([]byte(data))
+	if got := readExported(t, c, relPath+".sha1"); got != sha1Sum {
+		t.Errorf("%s.sha1 = %q, want %q", relPath, got, sha1Sum)
+	}
+	if got := readExported(t, c, relPath+".md5"); got != md5Sum {
+		t.Errorf("%s.md5 = %q, want %q", relPath, got, md5Sum)
+	}
+	metadata, err := maven.ParseMetadata([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metadata
+}
+
+// checkVersioning compares the versions, latest and release of regenerated metadata
+func checkVersioning(t *testing.T, relPath string, metadata *maven.Metadata, versions []string, latest, release string) {
+	t.Helper()
+	v := metadata.Versioning
+	if v == nil {
+		t.Fatalf("%s has no versioning", relPath)
+	}
+	if strings.Join(v.Versions, ",") != strings.Join(versions, ",") || v.Latest != latest || v.Release != release {
+		t.Errorf("%s lists %v, latest %q, release %q, want %v, latest %q, release %q",
+			relPath, v.Versions, v.Latest, v.Release, versions, latest, release)
+	}
+}
+
+func TestRegenerateMavenMetadataListsExportedVersions(t *testing.T) {
+	_, source := newListingStub(t, map[string]string{
+		// The metadata of the server lists versions which are not exported
+		"libs/org/acme/lib/maven-metadata.xml":                            `<metadata><groupId>org.acme</groupId><artifactId>lib</artifactId><versioning><latest>3.0</latest><release>3.0</release><versions><version>0.9</version><version>1.0</version><version>3.0</version></versions></versioning></metadata>`,
+		"libs/org/acme/lib/maven-metadata.xml.sha1":                       "stale",
+		"libs/org/acme/lib/0.9/lib-0.9.zip":                               "filtered out",
+		"libs/org/acme/lib/1.0/lib-1.0.jar":                               "lib 1.0",
+		"libs/org/acme/lib/1.10/lib-1.10.jar":                             "lib 1.10",
+		"libs/org/acme/lib/1.2/lib-1.2.jar":                               "lib 1.2",
+		"libs/org/acme/lib/2.0-SNAPSHOT/lib-2.0-20240101.120000-1.jar":    "lib 2.0 snapshot",
+		"libs/org/acme/lib/2.0-SNAPSHOT/maven-metadata.xml":               `<metadata><groupId>org.acme</groupId><artifactId>lib</artifactId><version>2.0-SNAPSHOT</version></metadata>`,
+		"libs/org/acme/maven-metadata.xml":                                `<metadata><groupId>org.acme</groupId><plugins><plugin><prefix>lib</prefix><artifactId>lib</artifactId></plugin><plugin><prefix>gone</prefix><artifactId>gone-maven-plugin</artifactId></plugin></plugins></metadata>`,
+		"libs/org/acme/other/1.0/other-1.0.jar":                           "other 1.0",
+		"libs/org/acme/other/1.0/not-an-artifact-of-this-directory-1.jar": "ignored by the versions",
+	})
+	c := newTestCrawler(t, source, Config{
+		FilterMode:              config.FilterModeBlacklist,
+		Extensions:              []string{".zip"},
+		RegenerateMavenMetadata: true,
+	})
+	if err := c.ProcessRepositories([]string{"libs"}); err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := readMetadata(t, c, "libs/org/acme/lib/maven-metadata.xml")
+	checkVersioning(t, "lib", metadata, []string{"1.0", "1.2", "1.10", "2.0-SNAPSHOT"}, "2.0-SNAPSHOT", "1.10")
+	if metadata.GroupID != "org.acme" || metadata.ArtifactID != "lib" {
+		t.Errorf("metadata of %s:%s, want org.acme:lib", metadata.GroupID, metadata.ArtifactID)
+	}
+	checkVersioning(t, "other", readMetadata(t, c, "libs/org/acme/other/maven-metadata.xml"), []string{"1.0"}, "1.0", "1.0")
+
+	// The snapshot metadata is copied, the group metadata only lists the exported plugins
+	if snapshot := readMetadata(t, c, "libs/org/acme/lib/2.0-SNAPSHOT/maven-metadata.xml"); snapshot.Version != "2.0-SNAPSHOT" {
+		t.Errorf("snapshot metadata of version %q", snapshot.Version)
+	}
+	group := readMetadata(t, c, "libs/org/acme/maven-metadata.xml")
+	if group.Plugins == nil || len(group.Plugins.Plugin) != 1 || group.Plugins.Plugin[0].ArtifactID != "lib" {
+		t.Errorf("group metadata plugins = %+v, want the lib plugin only", group.Plugins)
+	}
+}
+
+func TestRegenerateMavenMetadataPerRepositoryInMavenLocal(t *testing.T) {
+	_, source := newListingStub(t, map[string]string{
+		"libs-release/org/acme/lib/1.0/lib-1.0.jar":                    "lib 1.0",
+		"libs-release/org/acme/lib/maven-metadata.xml":                 "<metadata/>",
+		"libs-snapshot/org/acme/lib/1.0/lib-1.0.jar":                   "lib 1.0",
+		"libs-snapshot/org/acme/lib/1.1-SNAPSHOT/lib-1.1-SNAPSHOT.jar": "lib 1.1 snapshot",
+		"libs-snapshot/org/acme/lib/maven-metadata.xml":                "<metadata/>",
+	})
+	c := newTestCrawler(t, source, Config{
+		FilterMode:              config.FilterModeBlacklist,
+		Layout:                  config.LayoutMavenLocal,
+		RepositoryIDs:           map[string]string{"libs-snapshot": "snapshots"},
+		RegenerateMavenMetadata: true,
+	})
+	if err := c.ProcessRepositories([]string{"libs-release", "libs-snapshot"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each maven-metadata-<id>.xml lists the versions its repository provides
+	checkVersioning(t, "libs-release", readMetadata(t, c, "org/acme/lib/maven-metadata-libs-release.xml"), []string{"1.0"}, "1.0", "1.0")
+	checkVersioning(t, "snapshots", readMetadata(t, c, "org/acme/lib/maven-metadata-snapshots.xml"), []string{"1.0", "1.1-SNAPSHOT"}, "1.1-SNAPSHOT", "1.0")
+}
@@ -0,0 +1,151 @@
+package crawler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/caezarr-oss/refap/internal/metrics"
+)
+
+// Metrics are the Prometheus metrics of an export, shared by the crawlers of its sources.
+// The statistics of the summary are published per source and repository as counters.
+type Metrics struct {
+	files        *metrics.Vec
+	bytes        *metrics.Vec
+	repositories *metrics.Vec
+	failures     *metrics.Vec
+	retries      *metrics.Vec
+	queueDepth   *metrics.Vec
+	active       *metrics.Vec
+	latency      *metrics.HistogramVec
+	lastRun      *metrics.Vec
+	lastSuccess  *metrics.Vec
+}
+
+// NewMetrics registers the metrics of an export
+func NewMetrics(registry *metrics.Registry) *Metrics {
+	return &Metrics{
+		files:        registry.Counter("refap_files_total", "Files processed by source, repository and result: downloaded, skipped, failed or linked from the content store.", "source", "repository", "result"),
+		bytes:        registry.Counter("refap_bytes_downloaded_total", "Bytes of the downloaded files by source and repository.", "source", "repository"),
+		repositories: registry.Counter("refap_repositories_total", "Repositories processed, by result: started or failed.", "result"),
+		failures:     registry.Counter("refap_request_failures_total", "Failed HTTP requests by status code, \"timeout\" or \"error\" when no response was received.", "code"),
+		retries:      registry.Counter("refap_request_retries_total", "HTTP requests retried after a failure."),
+		queueDepth:   registry.Gauge("refap_queue_depth", "Files listed and not exported yet."),
+		active:       registry.Gauge("refap_active_workers", "Workers downloading a file: one per crawler for an export, one per upload worker for a migration."),
+		latency:      registry.Histogram("refap_request_duration_seconds", "Time to receive the response headers of the HTTP requests, by method.", metrics.DefaultBuckets, "method"),
+		lastRun:      registry.Gauge("refap_last_run_timestamp_seconds", "Time the last export ended, 0 while the first one runs."),
+		lastSuccess:  registry.Gauge("refap_last_run_success", "Whether every source of the last export succeeded, 1 or 0."),
+	}
+}
+
+// RunFinished records the end of an export, so that the runs of the scheduled mode can be monitored
+func (m *Metrics) RunFinished(success bool) {
+	m.lastRun.Set(float64(time.Now().Unix()))
+	if success {
+		m.lastSuccess.Set(1)
+	} else {
+		m.lastSuccess.Set(0)
+	}
+}
+
+// AddActiveWorkers adds n to the workers downloading a file, -1 when one is done
+func (m *Metrics) AddActiveWorkers(n int) {
+	m.active.Add(float64(n))
+}
+
+// AddFile counts a file processed outside of a crawler, such as by a migration,
+// with the bytes read from the source
+func (m *Metrics) AddFile(source, repo, result string, size int64) {
+	m.files.Add(1, source, repo, result)
+	if size > 0 {
+		m.bytes.Add(float64(size), source, repo)
+	}
+}
+
+// publish adds the statistics gathered since the last call to the metrics,
+// under the source and the repository being exported
+func (c *Crawler) publish() {
+	m := c.config.Metrics
+	if m == nil {
+		return
+	}
+	now, last := c.summary, c.published
+	c.published = now
+
+	m.repositories.Add(float64(now.Repositories-last.Repositories), "started")
+	m.repositories.Add(float64(now.RepositoriesFailed-last.RepositoriesFailed), "failed")
+	if c.repo == "" {
+		return
+	}
+	source := c.config.MetricsSource
+	m.files.Add(float64(now.FilesDownloaded-last.FilesDownloaded), source, c.repo, "downloaded")
+	m.files.Add(float64(now.FilesSkipped-last.FilesSkipped), source, c.repo, "skipped")
+	m.files.Add(float64(now.FilesFailed-last.FilesFailed), source, c.repo, "failed")
+	m.files.Add(float64(now.FilesLinked-last.FilesLinked), source, c.repo, "linked")
+	m.bytes.Add(float64(now.BytesDownloaded-last.BytesDownloaded), source, c.repo)
+}
+
+// Flush publishes the statistics not published yet to the metrics, at the end of an export
+func (c *Crawler) Flush() {
+	c.publish()
+}
+
+// beginRepository counts a repository and attributes the following statistics to it
+func (c *Crawler) beginRepository(repo string) {
+	c.publish()
+	c.summary.Repositories++
+	c.repo = repo
+	c.publish()
+}
+
+// queued adds n files to the files listed and not exported yet
+func (c *Crawler) queued(n int) {
+	c.queue += n
+	if c.config.Metrics != nil {
+		c.config.Metrics.queueDepth.Set(float64(c.queue))
+	}
+}
+
+// retried counts a request retried after a failure
+func (c *Crawler) retried() {
+	if c.config.Metrics != nil {
+		c.config.Metrics.retries.Add(1)
+	}
+}
+
+// downloading marks a download as started or finished
+func (c *Crawler) downloading(active bool) {
+	if c.config.Metrics == nil {
+		return
+	}
+	if active {
+		c.config.Metrics.AddActiveWorkers(1)
+	} else {
+		c.config.Metrics.AddActiveWorkers(-1)
+	}
+}
+
+// do performs a request with the shared client, recording its latency and failure
+func (c *Crawler) do(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	m := c.config.Metrics
+	if m == nil {
+		return resp, err
+	}
+
+	m.latency.Observe(time.Since(start).Seconds(), req.Method)
+	var urlErr interface{ Timeout() bool }
+	switch {
+	case err != nil && errors.As(err, &urlErr) && urlErr.Timeout():
+		m.failures.Add(1, "timeout")
+	case err != nil:
+		m.failures.Add(1, "error")
+	case resp.StatusCode >= 400:
+		m.failures.Add(1, strconv.Itoa(resp.StatusCode))
+	}
+	c.publish()
+	return resp, err
+}
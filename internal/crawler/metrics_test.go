@@ -0,0 +1,68 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/caezarr-oss/refap/internal/metrics"
+)
+
+func TestMetricsTellSourcesApart(t *testing.T) {
+	registry := metrics.NewRegistry()
+	m := NewMetrics(registry)
+	for _, source := range []string{"prod", "staging"} {
+		c := New(Config{Metrics: m, MetricsSource: source})
+		c.beginRepository("libs-release")
+		c.summary.FilesDownloaded++
+		c.summary.BytesDownloaded += 10
+		c.Flush()
+	}
+
+	var b strings.Builder
+	if err := registry.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`refap_files_total{source="prod",repository="libs-release",result="downloaded"} 1`,
+		`refap_files_total{source="staging",repository="libs-release",result="downloaded"} 1`,
+		`refap_bytes_downloaded_total{source="prod",repository="libs-release"} 10`,
+		`refap_bytes_downloaded_total{source="staging",repository="libs-release"} 10`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics do not contain %s:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestMetricsCountActiveWorkers(t *testing.T) {
+	registry := metrics.NewRegistry()
+	m := NewMetrics(registry)
+	workers := []*Crawler{New(Config{Metrics: m}), New(Config{Metrics: m}), New(Config{Metrics: m})}
+	for _, c := range workers {
+		c.downloading(true)
+	}
+	workers[0].downloading(false)
+
+	var b strings.Builder
+	if err := registry.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "refap_active_workers 2\n") {
+		t.Errorf("metrics do not count the 2 busy workers:\n%s", b.String())
+	}
+}
+
+func TestMetricsRecordLastRun(t *testing.T) {
+	registry := metrics.NewRegistry()
+	m := NewMetrics(registry)
+	m.RunFinished(true)
+	m.RunFinished(false)
+
+	var b strings.Builder
+	if err := registry.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "refap_last_run_success 0\n") || strings.Contains(b.String(), "refap_last_run_timestamp_seconds 0\n") {
+		t.Errorf("metrics do not report the failed last run:\n%s", b.String())
+	}
+}
@@ -0,0 +1,181 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// nexusPage is a page of the components or assets of the Nexus REST API
+type nexusPage struct {
+	Items             []json.RawMessage `json:"items"`
+	ContinuationToken *string           `json:"continuationToken"`
+}
+
+// nexusComponent is an item of the components API
+type nexusComponent struct {
+	Assets []nexusAsset `json:"assets"`
+}
+
+// nexusAsset is an item of the assets API, or an asset of a component
+type nexusAsset struct {
+	DownloadURL string            `json:"downloadUrl"`
+	Path        string            `json:"path"`
+	Checksum    map[string]string `json:"checksum"`
+	FileSize    int64             `json:"fileSize"`
+}
+
+// nexusAPIURL returns the URL of the REST API of a Nexus server, whose
+// repositories are configured with their content URL, e.g. https://nexus.example.com/repository/
+func (c *Crawler) nexusAPIURL() string {
+	base := strings.TrimSuffix(strings.TrimSuffix(c.config.ArtiURL, "/"), "/repository")
+	return base + "/service/rest/v1/"
+}
+
+// walkNexus lists the files of a Nexus repository through the components API, then
+// the assets API for the files which do not belong to a component, such as the
+// maven-metadata.xml files, and calls fn for each file accepted by the filters.
+// The size of the accepted files is printed as an estimate of the export.
+// A repository may be followed by a path, e.g. "maven-releases/org/acme", to only
+// export the files below it.
+func (c *Crawler) walkNexus(repo string, fn WalkFunc) error {
+	repository, prefix, _ := strings.Cut(strings.Trim(repo, "/"), "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	assets := make(map[string]nexusAsset)
+	addAsset := func(asset nexusAsset) {
+		asset.Path = strings.TrimPrefix(asset.Path, "/")
+		if strings.HasPrefix(asset.Path, prefix) && !strings.HasSuffix(asset.Path, "/") {
+			assets[asset.Path] = asset
+		}
+	}
+
+	err := c.nexusList("components", repository, func(item json.RawMessage) error {
+		var component nexusComponent
+		if err := json.Unmarshal(item, &component); err != nil {
+			return err
+		}
+		for _, asset := range component.Assets {
+			addAsset(asset)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = c.nexusList("assets", repository, func(item json.RawMessage) error {
+		var asset nexusAsset
+		if err := json.Unmarshal(item, &asset); err != nil {
+			return err
+		}
+		addAsset(asset)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Files are grouped by directory, as a listing, for the Gradle module references
+	dirs := make(map[string][]Link)
+	for assetPath := range assets {
+		dir, name := path.Split(strings.TrimPrefix(assetPath, prefix))
+		href := url.PathEscape(name)
+		dirs[dir] = append(dirs[dir], Link{Href: href, Text: name, URL: c.repoURL(repo) + escapePath(dir) + href})
+	}
+	dirNames := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		dirNames = append(dirNames, dir)
+	}
+	sort.Strings(dirNames)
+
+	var entries []Entry
+	var size int64
+	for _, dir := range dirNames {
+		links := dirs[dir]
+		sort.Slice(links, func(i, j int) bool { return links[i].Text < links[j].Text })
+		referenced := c.gradleReferences(links)
+
+		for _, l := range links {
+			if !c.acceptFile(strings.TrimSuffix(dir, "/"), l, referenced) {
+				continue
+			}
+			asset := assets[prefix+dir+l.Text]
+			entry := Entry{
+				Repo:   repo,
+				Path:   dir + l.Text,
+				URL:    l.URL,
+				SHA1:   asset.Checksum["sha1"],
+				SHA256: asset.Checksum["sha256"],
+			}
+			// The download URL of the API is only used on the server of the source,
+			// the content URL of the repository being requested otherwise
+			if downloadURL, err := url.Parse(asset.DownloadURL); err == nil && asset.DownloadURL != "" {
+				if c.isSourceURL(downloadURL) {
+					entry.URL = asset.DownloadURL
+				} else {
+					fmt.Printf("Ignoring the download URL %s of %s, it is not on the source\n", asset.DownloadURL, entry.Path)
+				}
+			}
+			entries = append(entries, entry)
+			size += asset.FileSize
+		}
+	}
+
+	c.estimateSpace(repo, size)
+	remaining := len(entries)
+	c.queued(remaining)
+	defer func() { c.queued(-remaining) }()
+	for _, entry := range entries {
+		remaining--
+		c.queued(-1)
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nexusList calls fn for each item of the components or assets of a repository,
+// following the continuation tokens of the pages
+func (c *Crawler) nexusList(endpoint, repository string, fn func(item json.RawMessage) error) error {
+	query := url.Values{"repository": {repository}}
+	for page := 1; ; page++ {
+		fmt.Printf("Listing %s of %s (page %d)\n", endpoint, repository, page)
+		data, _, err := c.readURL(c.nexusAPIURL()+endpoint+"?"+query.Encode(), nil)
+		if err != nil {
+			return err
+		}
+
+		var result nexusPage
+		if err := json.Unmarshal(data, &result); err != nil {
+			return fmt.Errorf("error parsing %s page: %w", endpoint, err)
+		}
+		for _, item := range result.Items {
+			if err := fn(item); err != nil {
+				return fmt.Errorf("error parsing %s page: %w", endpoint, err)
+			}
+		}
+
+		if result.ContinuationToken == nil || *result.ContinuationToken == "" {
+			return nil
+		}
+		if *result.ContinuationToken == query.Get("continuationToken") {
+			return fmt.Errorf("the %s API returned the same continuation token twice", endpoint)
+		}
+		query.Set("continuationToken", *result.ContinuationToken)
+	}
+}
+
+// escapePath escapes each segment of a slash separated path
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
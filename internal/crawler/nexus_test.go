@@ -0,0 +1,119 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/caezarr-oss/refap/config"
+)
+
+// nexusStub serves the components and assets pages of a Nexus repository,
+// the components over two pages linked by a continuation token
+func nexusStub(foreignURL string, auth *authRecorder) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth.record(r)
+		if r.URL.Query().Get("repository") != "maven-releases" {
+			http.NotFound(w, r)
+			return
+		}
+		token := r.URL.Query().Get("continuationToken")
+		switch {
+		case r.URL.Path == "/service/rest/v1/components" && token == "":
+			fmt.Fprintf(w, `{"items": [{"assets": [
+				{"path": "org/acme/lib/1.0/lib-1.0.jar", "downloadUrl": "http://%s/repository/maven-releases/org/acme/lib/1.0/lib-1.0.jar", "checksum": {"sha1": "a"}},
+				{"path": "org/other/app/1.0/app-1.0.jar", "downloadUrl": "http://%s/repository/maven-releases/org/other/app/1.0/app-1.0.jar"}
+			]}], "continuationToken": "page2"}`, r.Host, r.Host)
+		case r.URL.Path == "/service/rest/v1/components" && token == "page2":
+			fmt.Fprintf(w, `{"items": [{"assets": [
+				{"path": "org/acme/lib/1.1/lib-1.1.jar", "downloadUrl": "%s/org/acme/lib/1.1/lib-1.1.jar", "checksum": {"sha1": "b"}}
+			]}], "continuationToken": null}`, foreignURL)
+		case r.URL.Path == "/service/rest/v1/assets" && token == "":
+			fmt.Fprint(w, `{"items": [
+				{"path": "/org/acme/lib/maven-metadata.xml"},
+				{"path": "org/acme/lib/1.0/"}
+			], "continuationToken": null}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestWalkNexusFollowsContinuationTokens(t *testing.T) {
+	var foreignAuth authRecorder
+	foreign := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		foreignAuth.record(r)
+	}))
+	defer foreign.Close()
+
+	var sourceAuth authRecorder
+	source := nexusStub(foreign.URL, &sourceAuth)
+	defer source.Close()
+
+	c := newTestCrawler(t, source, Config{
+		ArtiURL:              "/repository/",
+		SourceType:           config.SourceNexus,
+		FilterMode:           config.FilterModeBlacklist,
+		IncludeMavenMetadata: true,
+	})
+	entries := make(map[string]Entry)
+	err := c.Walk("maven-releases/org/acme", func(entry Entry) error {
+		entries[entry.Path] = entry
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the files below the prefix are listed, relative to it
+	repoURL := source.URL + "/repository/maven-releases/org/acme/"
+	want := map[string]string{
+		"lib/1.0/lib-1.0.jar":    source.URL + "/repository/maven-releases/org/acme/lib/1.0/lib-1.0.jar",
+		"lib/1.1/lib-1.1.jar":    repoURL + "lib/1.1/lib-1.1.jar",
+		"lib/maven-metadata.xml": repoURL + "lib/maven-metadata.xml",
+	}
+	if len(entries) != len(want) {
+		t.Errorf("entries = %v, want %d files", entries, len(want))
+	}
+	for entryPath, wantURL := range want {
+		entry, ok := entries[entryPath]
+		if !ok {
+			t.Errorf("%s not listed", entryPath)
+			continue
+		}
+		// The download URL off the source is replaced by the content URL of the source
+		if entry.URL != wantURL {
+			t.Errorf("%s URL = %s, want %s", entryPath, entry.URL, wantURL)
+		}
+	}
+	if sha1 := entries["lib/1.1/lib-1.1.jar"].SHA1; sha1 != "b" {
+		t.Errorf("lib-1.1.jar SHA1 = %q, want the checksum of the asset", sha1)
+	}
+
+	if auth, _ := sourceAuth.auth("/service/rest/v1/components"); auth != "Bearer secret" {
+		t.Errorf("components requested with Authorization %q, want the token", auth)
+	}
+	for _, entry := range entries {
+		if resp, err := c.Open(entry.URL); err == nil {
+			resp.Body.Close()
+		}
+	}
+	if _, ok := foreignAuth.auth("/org/acme/lib/1.1/lib-1.1.jar"); ok {
+		t.Error("the download URL off the source was requested")
+	}
+}
+
+func TestWalkNexusRefusesRepeatedContinuationToken(t *testing.T) {
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"items": [], "continuationToken": "same"}`)
+	}))
+	defer source.Close()
+
+	c := newTestCrawler(t, source, Config{ArtiURL: "/repository/", SourceType: config.SourceNexus})
+	err := c.Walk("maven-releases", func(entry Entry) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "same continuation token twice") {
+		t.Fatalf("err = %v, want the repeated continuation token", err)
+	}
+}
@@ -0,0 +1,174 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/caezarr-oss/refap/internal/npm"
+)
+
+// npmIndexName is the name of the package metadata document in the static registry layout
+const npmIndexName = "index.json"
+
+// ExportNpm exports the packages of npm repositories in a layout served by a static
+// web server: <repository>/<package>/index.json holds the package metadata, pruned
+// to the exported versions, and <repository>/<package>/-/ the tarballs.
+// Packages are read from NpmPackages, or found in the repository listing.
+func (c *Crawler) ExportNpm(repoList []string) error {
+	if err := c.prepare(); err != nil {
+		return err
+	}
+
+	for _, repo := range repoList {
+		if c.spaceErr != nil {
+			return c.spaceErr
+		}
+		repo = strings.TrimSpace(repo)
+		if repo == "" {
+			continue
+		}
+		if !strings.HasSuffix(repo, "/") {
+			repo += "/"
+		}
+		c.beginRepository(repo)
+
+		specs := c.config.NpmPackages
+		if len(specs) == 0 {
+			var err error
+			if specs, err = c.npmPackages(repo); err != nil {
+				fmt.Printf("Failed to list the packages of %s: %v\n", repo, err)
+				c.summary.RepositoriesFailed++
+				continue
+			}
+		}
+
+		fmt.Printf("Exporting npm repo: %s (%d packages)\n", repo, len(specs))
+		for _, spec := range specs {
+			name, versionRange := npm.ParseSpec(spec)
+			if err := c.exportNpmPackage(repo, name, versionRange); err != nil {
+				fmt.Printf("Failed to export package %s: %v\n", name, err)
+				c.summary.FilesFailed++
+			}
+		}
+	}
+
+	return nil
+}
+
+// npmPackages lists the packages of a repository from its listing, scoped
+// packages being stored below their @scope directory
+func (c *Crawler) npmPackages(repo string) ([]string, error) {
+	links, _, err := c.readListing(c.repoURL(repo), c.repoURL(repo))
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []string
+	for _, l := range links {
+		name := strings.TrimSuffix(l.Text, "/")
+		if !strings.HasSuffix(l.Text, "/") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if !strings.HasPrefix(name, "@") {
+			packages = append(packages, name)
+			continue
+		}
+
+		scopeLinks, _, err := c.readListing(l.URL, c.repoURL(repo))
+		if err != nil {
+			fmt.Printf("Failed to list scope %s: %v\n", name, err)
+			continue
+		}
+		for _, scoped := range scopeLinks {
+			if strings.HasSuffix(scoped.Text, "/") {
+				packages = append(packages, name+"/"+strings.TrimSuffix(scoped.Text, "/"))
+			}
+		}
+	}
+	return packages, nil
+}
+
+// exportNpmPackage exports the versions of a package matching the range and writes its pruned metadata
+func (c *Crawler) exportNpmPackage(repo, name, versionRange string) error {
+	packument, err := c.readPackument(repo, name)
+	if err != nil {
+		return err
+	}
+
+	versions, err := packument.Select(versionRange, c.config.NpmIncludePrerelease, c.config.NpmLatestOnly)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return fmt.Errorf("no version matches %q", versionRange)
+	}
+
+	packageDir := path.Join(strings.Trim(repo, "/"), name)
+	var exported []string
+	tarballs := make(map[string]string) // Tarball file name by version
+	for _, version := range versions {
+		dist := packument.Versions[version].Dist
+		tarballURL, err := url.Parse(dist.Tarball)
+		if err != nil || dist.Tarball == "" {
+			fmt.Printf("Invalid tarball URL for %s@%s: %q\n", name, version, dist.Tarball)
+			c.summary.FilesFailed++
+			continue
+		}
+		tarball := path.Base(tarballURL.Path)
+		relPath := path.Join(name, "-", tarball)
+		entry := Entry{Repo: repo, Path: relPath, URL: tarballURL.String()}
+
+		target := c.target(path.Join(packageDir, "-", tarball))
+		ok := true
+		if c.exists(target) && (c.config.Archive != nil || !c.config.ForceReplace) {
+			c.summary.FilesSkipped++
+		} else if sum, found := dist.Digest(); found {
+			ok = c.saveVerified(entry, target, digest{algorithm: sum.Algorithm, newHash: sum.NewHash, sum: sum.Sum})
+		} else {
+			fmt.Printf("No integrity for %s@%s, the tarball is not verified\n", name, version)
+			ok = c.save(entry, target)
+		}
+		if ok {
+			exported = append(exported, version)
+			tarballs[version] = tarball
+		}
+	}
+	if len(exported) == 0 {
+		return fmt.Errorf("no tarball could be exported")
+	}
+
+	index, err := packument.Prune(exported, func(version string) string {
+		return strings.TrimSuffix(c.config.NpmRegistryURL, "/") + "/" + name + "/-/" + tarballs[version]
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Generating %s\n", path.Join(packageDir, npmIndexName))
+	return c.writeFile(path.Join(packageDir, npmIndexName), index)
+}
+
+// readPackument downloads the metadata document of a package from the npm API of the repository
+func (c *Crawler) readPackument(repo, name string) (*npm.Packument, error) {
+	resp, err := c.fetch(c.apiURL("npm", repo) + npm.EscapeName(name))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return npm.ParsePackument(data)
+}
+
+// apiURL returns the base URL of the Artifactory API of a package type for a
+// repository, derived from the listing URL: .../artifactory/list/ gives
+// .../artifactory/api/<packageType>/<repo>/
+func (c *Crawler) apiURL(packageType, repo string) string {
+	base := strings.TrimSuffix(strings.TrimSuffix(c.config.ArtiURL, "/"), "/list")
+	return base + "/api/" + packageType + "/" + strings.Trim(repo, "/") + "/"
+}
@@ -0,0 +1,173 @@
+package crawler
+
+import (
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// authRecorder records the Authorization header of each request served by a test server
+type authRecorder struct {
+	mu    sync.Mutex
+	auths map[string]string // Authorization header by request path
+}
+
+func (r *authRecorder) record(req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.auths == nil {
+		r.auths = make(map[string]string)
+	}
+	r.auths[req.URL.Path] = req.Header.Get("Authorization")
+}
+
+func (r *authRecorder) auth(path string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	auth, ok := r.auths[path]
+	return auth, ok
+}
+
+// newTestCrawler returns a crawler of the source server, authenticated with a token.
+// ArtiURL is the path of the source on the server, /artifactory/list/ when not set.
+func newTestCrawler(t *testing.T, source *httptest.Server, config Config) *Crawler {
+	// The failed downloads are logged below the home directory
+	t.Setenv("HOME", t.TempDir())
+	if config.ArtiURL == "" {
+		config.ArtiURL = "/artifactory/list/"
+	}
+	config.ArtiURL = source.URL + config.ArtiURL
+	config.BaseDir = t.TempDir()
+	config.RetryAttempts = 1
+	config.Timeout = 10
+	config.AuthType = "token"
+	config.AuthAccessToken = "secret"
+	return New(config)
+}
+
+func TestExportNpmSendsCredentialsOnlyToTheSource(t *testing.T) {
+	tarball := []byte("left-pad tarball")
+	sum := sha1.Sum(tarball)
+
+	var upstreamAuth authRecorder
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamAuth.record(r)
+		w.Write(tarball)
+	}))
+	defer upstream.Close()
+
+	var sourceAuth authRecorder
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sourceAuth.record(r)
+		switch r.URL.Path {
+		case "/artifactory/api/npm/npm-remote/left-pad":
+			// The first tarball is on an upstream registry, the second on the source
+			fmt.Fprintf(w, `{"name": "left-pad", "dist-tags": {"latest": "1.1.0"}, "versions": {
+				"1.0.0": {"version": "1.0.0", "dist": {"tarball": "%s/left-pad/-/left-pad-1.0.0.tgz", "shasum": "%s"}},
+				"1.1.0": {"version": "1.1.0", "dist": {"tarball": "http://%s/artifactory/api/npm/npm-remote/left-pad/-/left-pad-1.1.0.tgz", "shasum": "%s"}}}}`,
+				upstream.URL, hex.EncodeToString(sum[:]), r.Host, hex.EncodeToString(sum[:]))
+		case "/artifactory/api/npm/npm-remote/left-pad/-/left-pad-1.1.0.tgz":
+			w.Write(tarball)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer source.Close()
+
+	c := newTestCrawler(t, source, Config{NpmPackages: []string{"left-pad"}, NpmRegistryURL: "http://registry.local/npm-remote/"})
+	if err := c.ExportNpm([]string{"npm-remote"}); err != nil {
+		t.Fatal(err)
+	}
+	if summary := c.Summary(); summary.FilesDownloaded != 2 || summary.FilesFailed != 0 {
+		t.Fatalf("summary = %+v, want both tarballs downloaded", summary)
+	}
+
+	if auth, ok := upstreamAuth.auth("/left-pad/-/left-pad-1.0.0.tgz"); !ok || auth != "" {
+		t.Errorf("upstream tarball requested: %v, with Authorization %q, want no credentials", ok, auth)
+	}
+	if auth, _ := sourceAuth.auth("/artifactory/api/npm/npm-remote/left-pad/-/left-pad-1.1.0.tgz"); auth != "Bearer secret" {
+		t.Errorf("source tarball requested with Authorization %q, want the token", auth)
+	}
+	if _, err := os.Stat(filepath.Join(c.config.BaseDir, "npm-remote", "left-pad", "-", "left-pad-1.0.0.tgz")); err != nil {
+		t.Errorf("upstream tarball not exported: %v", err)
+	}
+}
+
+func TestExportNpmRejectsTarballsNotMatchingTheirDigest(t *testing.T) {
+	tarball := []byte("left-pad tarball")
+	integrity := func(content string) string {
+		sum := sha512.Sum512([]byte(content))
+		return "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+	}
+	shasum := func(content string) string {
+		sum := sha1.Sum([]byte(content))
+		return hex.EncodeToString(sum[:])
+	}
+
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tarballURL := "http://" + r.Host + "/artifactory/api/npm/npm-remote/left-pad/-/"
+		switch {
+		case r.URL.Path == "/artifactory/api/npm/npm-remote/left-pad":
+			// The integrity is preferred to the shasum, which is used when it is the only digest
+			fmt.Fprintf(w, `{"name": "left-pad", "dist-tags": {"latest": "1.2.0", "beta": "1.0.0"}, "versions": {
+				"1.0.0": {"version": "1.0.0", "dist": {"tarball": "%[1]sleft-pad-1.0.0.tgz", "integrity": "%[2]s", "shasum": "%[4]s"}},
+				"1.1.0": {"version": "1.1.0", "dist": {"tarball": "%[1]sleft-pad-1.1.0.tgz", "integrity": "%[3]s", "shasum": "%[5]s"}},
+				"1.2.0": {"version": "1.2.0", "dist": {"tarball": "%[1]sleft-pad-1.2.0.tgz", "shasum": "%[4]s"}}}}`,
+				tarballURL, integrity(string(tarball)), integrity("another tarball"), shasum("another tarball"), shasum(string(tarball)))
+		case strings.HasPrefix(r.URL.Path, "/artifactory/api/npm/npm-remote/left-pad/-/"):
+			w.Write(tarball)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer source.Close()
+
+	c := newTestCrawler(t, source, Config{NpmPackages: []string{"left-pad"}, NpmRegistryURL: "http://registry.local/npm-remote/"})
+	if err := c.ExportNpm([]string{"npm-remote"}); err != nil {
+		t.Fatal(err)
+	}
+	if summary := c.Summary(); summary.FilesDownloaded != 1 || summary.FilesFailed != 2 {
+		t.Fatalf("summary = %+v, want the 2 tarballs not matching their digest rejected", summary)
+	}
+
+	packageDir := filepath.Join(c.config.BaseDir, "npm-remote", "left-pad")
+	for version, exported := range map[string]bool{"1.0.0": true, "1.1.0": false, "1.2.0": false} {
+		_, err := os.Stat(filepath.Join(packageDir, "-", "left-pad-"+version+".tgz"))
+		if exported != (err == nil) {
+			t.Errorf("tarball of %s exported: %v, want %v", version, err == nil, exported)
+		}
+	}
+
+	// The metadata only lists the exported version, latest moving to it
+	data, err := os.ReadFile(filepath.Join(packageDir, npmIndexName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index struct {
+		DistTags map[string]string `json:"dist-tags"`
+		Versions map[string]struct {
+			Dist struct {
+				Tarball string `json:"tarball"`
+			} `json:"dist"`
+		} `json:"versions"`
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Versions) != 1 || index.Versions["1.0.0"].Dist.Tarball != "http://registry.local/npm-remote/left-pad/-/left-pad-1.0.0.tgz" {
+		t.Errorf("versions = %+v, want 1.0.0 served by the registry", index.Versions)
+	}
+	if index.DistTags["latest"] != "1.0.0" || index.DistTags["beta"] != "1.0.0" {
+		t.Errorf("dist-tags = %v, want latest and beta on 1.0.0", index.DistTags)
+	}
+}
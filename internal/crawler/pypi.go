@@ -0,0 +1,191 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/caezarr-oss/refap/internal/pypi"
+)
+
+// pypiIndexName is the name of the pages of the exported simple repository
+const pypiIndexName = "index.html"
+
+// pypiAttributes are the attributes of the links kept in the exported pages.
+// The core metadata attributes are dropped as the metadata files are not exported.
+var pypiAttributes = []string{"data-requires-python", "data-yanked"}
+
+// ExportPyPI exports the projects of PyPI repositories from their PEP 503 simple
+// API into a simple repository tree usable with pip --index-url file://...:
+// <repository>/simple/index.html lists the projects, <repository>/simple/<project>/index.html
+// their files, stored in <repository>/packages/<project>/.
+// Projects are read from PyPIProjects, or from the project list of the repository.
+func (c *Crawler) ExportPyPI(repoList []string) error {
+	if err := c.prepare(); err != nil {
+		return err
+	}
+
+	for _, repo := range repoList {
+		if c.spaceErr != nil {
+			return c.spaceErr
+		}
+		repo = strings.TrimSpace(repo)
+		if repo == "" {
+			continue
+		}
+		c.beginRepository(repo)
+		simpleURL := c.apiURL("pypi", repo) + "simple/"
+
+		projects := c.config.PyPIProjects
+		if len(projects) == 0 {
+			var err error
+			if projects, err = c.pypiProjects(simpleURL); err != nil {
+				fmt.Printf("Failed to list the projects of %s: %v\n", repo, err)
+				c.summary.RepositoriesFailed++
+				continue
+			}
+		}
+
+		fmt.Printf("Exporting PyPI repo: %s (%d projects)\n", repo, len(projects))
+		repoDir := strings.Trim(repo, "/")
+		var exported []string
+		for _, project := range projects {
+			project = pypi.Normalize(strings.TrimSpace(project))
+			ok, err := c.exportPyPIProject(repo, simpleURL, project)
+			if err != nil {
+				fmt.Printf("Failed to export project %s: %v\n", project, err)
+				c.summary.FilesFailed++
+			}
+			if ok {
+				exported = append(exported, project)
+			}
+		}
+
+		relPath := path.Join(repoDir, "simple", pypiIndexName)
+		fmt.Printf("Generating %s\n", relPath)
+		if err := c.writeFile(relPath, pypi.RootPage(exported)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pypiProjects lists the projects of the simple repository at simpleURL
+func (c *Crawler) pypiProjects(simpleURL string) ([]string, error) {
+	page, err := c.fetchListing(simpleURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var projects []string
+	for _, link := range pypi.ParsePage(page) {
+		if link.Text != "" {
+			projects = append(projects, link.Text)
+		}
+	}
+	return projects, nil
+}
+
+// exportPyPIProject downloads the files of a project accepted by the filters and
+// writes its page. It reports whether the project holds exported files.
+func (c *Crawler) exportPyPIProject(repo, simpleURL, project string) (bool, error) {
+	pageURL, err := url.Parse(simpleURL + project + "/")
+	if err != nil {
+		return false, err
+	}
+	page, err := c.fetchListing(pageURL.String())
+	if err != nil {
+		return false, err
+	}
+
+	repoDir := strings.Trim(repo, "/")
+	var files []pypi.ProjectFile
+	for _, link := range pypi.ParsePage(page) {
+		href, err := url.Parse(link.Href)
+		if err != nil {
+			continue
+		}
+		fileURL := pageURL.ResolveReference(href)
+		fileURL.Fragment = ""
+		// The path of the URL is already unescaped, a name escaped twice keeps its % escapes
+		filename := path.Base(fileURL.Path)
+		if !c.acceptDistribution(filename) {
+			continue
+		}
+
+		relPath := path.Join("packages", project, filename)
+		entry := Entry{Repo: repo, Path: relPath, URL: fileURL.String()}
+		target := c.target(path.Join(repoDir, relPath))
+
+		ok := true
+		hashName, sum, hasHash := link.Hash()
+		if c.exists(target) && (c.config.Archive != nil || !c.config.ForceReplace) {
+			c.summary.FilesSkipped++
+		} else if hasHash {
+			ok = c.saveVerified(entry, target, digest{algorithm: hashName, newHash: pypi.NewHash(hashName), sum: sum})
+		} else {
+			fmt.Printf("No hash for %s, the file is not verified\n", filename)
+			ok = c.save(entry, target)
+		}
+		if !ok {
+			continue
+		}
+
+		// The page links the file relatively to simple/<project>/
+		file := pypi.ProjectFile{
+			Href:       "../../packages/" + url.PathEscape(project) + "/" + url.PathEscape(filename),
+			Filename:   filename,
+			Attributes: make(map[string]string),
+		}
+		if hasHash {
+			file.Href += "#" + hashName + "=" + fmt.Sprintf("%x", sum)
+		}
+		for _, name := range pypiAttributes {
+			if value, ok := link.Attributes[name]; ok {
+				file.Attributes[name] = value
+			}
+		}
+		files = append(files, file)
+	}
+
+	if len(files) == 0 {
+		fmt.Printf("No file of %s matches the filters\n", project)
+		return false, nil
+	}
+
+	relPath := path.Join(repoDir, "simple", project, pypiIndexName)
+	fmt.Printf("Generating %s\n", relPath)
+	return true, c.writeFile(relPath, pypi.ProjectPage(project, files))
+}
+
+// acceptDistribution applies the package type, Python tag and platform filters to a
+// distribution file. Tags are only read from wheel names, source distributions
+// being independent of the Python implementation and the platform.
+func (c *Crawler) acceptDistribution(filename string) bool {
+	dist, err := pypi.ParseFilename(filename)
+	if err != nil {
+		return false
+	}
+	if len(c.config.PyPIPackageTypes) > 0 && !matchPatterns(c.config.PyPIPackageTypes, dist.Type) {
+		return false
+	}
+	if dist.Type != pypi.Wheel {
+		return true
+	}
+	return matchAnyTag(c.config.PyPIPythonTags, dist.PythonTags) && matchAnyTag(c.config.PyPIPlatforms, dist.PlatformTags)
+}
+
+// matchAnyTag reports whether one of the tags matches one of the patterns, an empty pattern list matching any tag
+func matchAnyTag(patterns, tags []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, tag := range tags {
+		if matchPatterns(patterns, tag) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package crawler
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/caezarr-oss/refap/internal/pypi"
+)
+
+func TestExportPyPISendsCredentialsOnlyToTheSource(t *testing.T) {
+	content := []byte("demo distribution")
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	// Files of a remote repository are often linked on the upstream file host
+	var filesAuth authRecorder
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filesAuth.record(r)
+		w.Write(content)
+	}))
+	defer files.Close()
+
+	var sourceAuth authRecorder
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sourceAuth.record(r)
+		switch r.URL.Path {
+		case "/artifactory/api/pypi/pypi-remote/simple/demo/":
+			fmt.Fprintf(w, `<html><body>
+<a href="%s/packages/demo-1.0.tar.gz#sha256=%s">demo-1.0.tar.gz</a>
+<a href="../../packages/demo-1.0-py3-none-any.whl#sha256=%s">demo-1.0-py3-none-any.whl</a>
+</body></html>`, files.URL, hash, hash)
+		case "/artifactory/api/pypi/pypi-remote/packages/demo-1.0-py3-none-any.whl":
+			w.Write(content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer source.Close()
+
+	c := newTestCrawler(t, source, Config{PyPIProjects: []string{"demo"}})
+	if err := c.ExportPyPI([]string{"pypi-remote"}); err != nil {
+		t.Fatal(err)
+	}
+	if summary := c.Summary(); summary.FilesDownloaded != 2 || summary.FilesFailed != 0 {
+		t.Fatalf("summary = %+v, want both files downloaded", summary)
+	}
+
+	if auth, ok := filesAuth.auth("/packages/demo-1.0.tar.gz"); !ok || auth != "" {
+		t.Errorf("upstream file requested: %v, with Authorization %q, want no credentials", ok, auth)
+	}
+	if auth, _ := sourceAuth.auth("/artifactory/api/pypi/pypi-remote/packages/demo-1.0-py3-none-any.whl"); auth != "Bearer secret" {
+		t.Errorf("source file requested with Authorization %q, want the token", auth)
+	}
+}
+
+func TestExportPyPIWritesSimplePages(t *testing.T) {
+	files := map[string]string{
+		"demo_pkg-0.9.tar.gz":              "tampered sdist",
+		"demo_pkg-1.0.tar.gz":              "sdist",
+		"demo_pkg-1.0-py3-none-any.whl":    "wheel",
+		"demo_pkg-1.0%2Bdev.zip":           "zip escaped twice",
+		"empty-1.0-py3-none-any.whl.asc":   "not a distribution",
+		"demo_pkg-1.0-py3-none-any.whl.gz": "not a distribution",
+	}
+	hashOf := func(newHash func() hash.Hash, content string) string {
+		h := newHash()
+		h.Write([]byte(content))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	sdistHash := hashOf(sha256.New, "sdist")
+	wheelHash := hashOf(md5.New, "wheel")
+
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const prefix = "/artifactory/api/pypi/pypi-remote/"
+		switch r.URL.Path {
+		case prefix + "simple/":
+			fmt.Fprint(w, `<a href="Demo_Pkg/">Demo_Pkg</a><a href="empty/">empty</a>`)
+		case prefix + "simple/demo-pkg/":
+			fmt.Fprintf(w, `<html><body>
+<a href="../../packages/demo_pkg-0.9.tar.gz#sha256=%s">demo_pkg-0.9.tar.gz</a>
+<a href="../../packages/demo_pkg-1.0.tar.gz#sha256=%s" data-requires-python="&gt;=3.8" data-dist-info-metadata="sha256=%s">demo_pkg-1.0.tar.gz</a>
+<a href="../../packages/demo_pkg-1.0-py3-none-any.whl#md5=%s" data-yanked="">demo_pkg-1.0-py3-none-any.whl</a>
+<a href="../../packages/demo_pkg-1.0%%252Bdev.zip">demo_pkg-1.0%%2Bdev.zip</a>
+<a href="../../packages/demo_pkg-1.0-py3-none-any.whl.gz">demo_pkg-1.0-py3-none-any.whl.gz</a>
+</body></html>`, sdistHash, sdistHash, sdistHash, wheelHash)
+		case prefix + "simple/empty/":
+			fmt.Fprint(w, `<a href="../../packages/empty-1.0-py3-none-any.whl.asc">empty-1.0-py3-none-any.whl.asc</a>`)
+		default:
+			content, ok := files[strings.TrimPrefix(r.URL.Path, prefix+"packages/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprint(w, content)
+		}
+	}))
+	defer source.Close()
+
+	c := newTestCrawler(t, source, Config{})
+	if err := c.ExportPyPI([]string{"pypi-remote"}); err != nil {
+		t.Fatal(err)
+	}
+	if summary := c.Summary(); summary.FilesDownloaded != 3 || summary.FilesFailed != 1 {
+		t.Errorf("summary = %+v, want 3 files downloaded and the tampered one failed", summary)
+	}
+
+	// The root page lists the projects holding exported files, by normalized name
+	simpleDir := filepath.Join(c.config.BaseDir, "pypi-remote", "simple")
+	root, err := os.ReadFile(filepath.Join(simpleDir, pypiIndexName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var projects []string
+	for _, link := range pypi.ParsePage(root) {
+		projects = append(projects, link.Href)
+	}
+	if strings.Join(projects, ",") != "demo-pkg/" {
+		t.Errorf("root page links %v, want demo-pkg/", projects)
+	}
+
+	// The project page links the exported files relatively, with the hash of their link
+	page, err := os.ReadFile(filepath.Join(simpleDir, "demo-pkg", pypiIndexName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := pypi.ParsePage(page)
+	want := []struct {
+		href, filename, content string
+		attributes              map[string]string
+	}{
+		{"../../packages/demo-pkg/demo_pkg-1.0.tar.gz#sha256=" + sdistHash, "demo_pkg-1.0.tar.gz", "sdist", map[string]string{"data-requires-python": ">=3.8"}},
+		{"../../packages/demo-pkg/demo_pkg-1.0-py3-none-any.whl#md5=" + wheelHash, "demo_pkg-1.0-py3-none-any.whl", "wheel", map[string]string{"data-yanked": ""}},
+		{"../../packages/demo-pkg/demo_pkg-1.0%252Bdev.zip", "demo_pkg-1.0%2Bdev.zip", "zip escaped twice", map[string]string{}},
+	}
+	if len(links) != len(want) {
+		t.Fatalf("project page links %+v, want %d files", links, len(want))
+	}
+	for i, link := range links {
+		if link.Href != want[i].href || link.Text != want[i].filename || fmt.Sprint(link.Attributes) != fmt.Sprint(want[i].attributes) {
+			t.Errorf("link %+v, want %+v", link, want[i])
+		}
+
+		// The link leads to the exported file, as pip resolves it
+		href, _ := url.Parse(link.Href)
+		fileURL := (&url.URL{Path: "/pypi-remote/simple/demo-pkg/"}).ResolveReference(href)
+		data, err := os.ReadFile(filepath.Join(c.config.BaseDir, filepath.FromSlash(fileURL.Path)))
+		if err != nil || string(data) != want[i].content {
+			t.Errorf("%s leads to %q (%v), want %q", link.Href, data, err, want[i].content)
+		}
+	}
+}
+
+func TestAcceptDistributionFilters(t *testing.T) {
+	files := []string{
+		"demo-1.0.tar.gz",
+		"demo-1.0-py3-none-any.whl",
+		"demo-1.0-cp311-cp311-manylinux_2_17_x86_64.manylinux2014_x86_64.whl",
+		"demo-1.0-cp311-cp311-win_amd64.whl",
+		"demo-1.0-1-cp310-cp310-manylinux_2_17_x86_64.whl",
+		"demo-1.0.exe",
+	}
+	for _, tc := range []struct {
+		name   string
+		config Config
+		want   []string
+	}{
+		{"no filter", Config{}, files[:5]},
+		{"wheels", Config{PyPIPackageTypes: []string{pypi.Wheel}}, files[1:5]},
+		{"sdists", Config{PyPIPackageTypes: []string{pypi.Sdist}}, files[:1]},
+		{"python tag", Config{PyPIPythonTags: []string{"cp311"}}, []string{files[0], files[2], files[3]}},
+		{"platform pattern", Config{PyPIPlatforms: []string{"manylinux2014_*"}}, []string{files[0], files[2]}},
+		{"python tag and platforms", Config{PyPIPythonTags: []string{"py3", "cp31*"}, PyPIPlatforms: []string{"any", "manylinux_2_17_x86_64"}},
+			[]string{files[0], files[1], files[2], files[4]}},
+		{"wheels of a platform", Config{PyPIPackageTypes: []string{pypi.Wheel}, PyPIPlatforms: []string{"win_*"}}, files[3:4]},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := New(tc.config)
+			var accepted []string
+			for _, file := range files {
+				if c.acceptDistribution(file) {
+					accepted = append(accepted, file)
+				}
+			}
+			if strings.Join(accepted, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("accepted %v, want %v", accepted, tc.want)
+			}
+		})
+	}
+}
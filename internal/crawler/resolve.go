@@ -0,0 +1,292 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/caezarr-oss/refap/internal/gradle"
+	"github.com/caezarr-oss/refap/internal/maven"
+)
+
+// DefaultResolveScopes are the dependency scopes followed by default
+var DefaultResolveScopes = []string{"compile", "runtime"}
+
+// Unresolved is a coordinate that could not be resolved, with the reason
+type Unresolved struct {
+	Coordinates string
+	Reason      string
+}
+
+// Resolution is the result of a dependency resolution
+type Resolution struct {
+	Artifacts  []maven.Coordinates // Artifacts of the closure, with their version
+	Unresolved []Unresolved
+}
+
+// resolver fetches the transitive closure of a set of artifacts
+type resolver struct {
+	c      *Crawler
+	repos  []string
+	scopes map[string]bool
+
+	poms     map[string]*resolvedPOM // By POM coordinates
+	versions map[string][]string     // Versions of an artifact listed in the metadata, by groupId:artifactId
+	modules  map[string]bool         // Gradle module metadata already exported
+}
+
+// resolvedPOM is a POM found in one of the repositories, or the error when it was not found
+type resolvedPOM struct {
+	pom  *maven.POM
+	repo string
+	err  error
+}
+
+// resolveNode is an artifact to resolve with the exclusions inherited from its dependents
+type resolveNode struct {
+	coordinates maven.Coordinates
+	depth       int
+	exclusions  []maven.Exclusion
+}
+
+// Resolve downloads the given artifacts and their transitive dependencies from
+// the repositories, searched in order. POMs are downloaded with their parents
+// and the BOMs they import. Dependencies follow the Maven rules: the dependency
+// management, properties and exclusions are applied, the nearest version of an
+// artifact wins, optional dependencies and the test and provided scopes are not
+// transitive. scopes are the scopes of the direct dependencies of the roots to follow.
+func (c *Crawler) Resolve(roots []maven.Coordinates, repoList []string, scopes []string) (Resolution, error) {
+	if err := c.prepare(); err != nil {
+		return Resolution{}, err
+	}
+
+	r := &resolver{
+		c:        c,
+		scopes:   make(map[string]bool),
+		poms:     make(map[string]*resolvedPOM),
+		versions: make(map[string][]string),
+		modules:  make(map[string]bool),
+	}
+	for _, repo := range repoList {
+		if repo = strings.TrimSpace(repo); repo != "" {
+			if !strings.HasSuffix(repo, "/") {
+				repo += "/"
+			}
+			r.repos = append(r.repos, repo)
+		}
+	}
+	if len(scopes) == 0 {
+		scopes = DefaultResolveScopes
+	}
+	for _, scope := range scopes {
+		r.scopes[scope] = true
+	}
+	c.summary.Repositories += len(r.repos)
+
+	resolution := r.resolve(roots)
+	return resolution, c.finish(r.repos)
+}
+
+// resolve walks the dependency graph breadth first so that the nearest version of an artifact wins
+func (r *resolver) resolve(roots []maven.Coordinates) Resolution {
+	var resolution Resolution
+	selected := make(map[string]string) // Version of each groupId:artifactId
+	done := make(map[string]bool)
+	reported := make(map[string]bool)
+	unresolved := func(coordinates, reason string) {
+		if !reported[coordinates] {
+			reported[coordinates] = true
+			resolution.Unresolved = append(resolution.Unresolved, Unresolved{coordinates, reason})
+		}
+	}
+
+	queue := make([]resolveNode, 0, len(roots))
+	for _, root := range roots {
+		queue = append(queue, resolveNode{coordinates: root})
+	}
+
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		coordinates := node.coordinates
+		key := coordinates.GroupID + ":" + coordinates.ArtifactID
+
+		if maven.IsVersionRange(coordinates.Version) {
+			version, err := r.resolveRange(coordinates)
+			if err != nil {
+				unresolved(coordinates.String(), err.Error())
+				continue
+			}
+			coordinates.Version = version
+		}
+
+		// Nearest wins: a version already selected for the artifact is kept
+		if version, ok := selected[key]; ok && version != coordinates.Version {
+			continue
+		}
+		if done[coordinates.String()] {
+			continue
+		}
+		done[coordinates.String()] = true
+
+		model, repo, err := r.model(coordinates)
+		if err != nil {
+			unresolved(coordinates.String(), err.Error())
+			continue
+		}
+		selected[key] = coordinates.Version
+
+		// Download the artifact itself, its POM was downloaded with the model
+		if coordinates.Type == "" && node.depth == 0 {
+			coordinates.Type = model.Packaging
+		}
+		if coordinates.Type != "pom" {
+			entry := Entry{Repo: repo, Path: coordinates.Path(), URL: r.c.config.ArtiURL + repo + coordinates.Path()}
+			if !r.c.exportEntry(entry) {
+				unresolved(coordinates.String(), "artifact could not be downloaded from "+repo)
+				continue
+			}
+		}
+		resolution.Artifacts = append(resolution.Artifacts, coordinates)
+
+		// Gradle reads the module metadata first when the POM says it was published
+		if r.c.config.IncludeGradleMetadata {
+			modulePath := strings.TrimSuffix(coordinates.POM().Path(), ".pom") + gradle.ModuleExtension
+			r.c.exportGradleModule(repo, modulePath, r.modules)
+		}
+
+		for _, dependency := range model.Dependencies {
+			if !r.follow(node, dependency) {
+				continue
+			}
+			dependencyCoordinates := dependency.Coordinates()
+			if dependencyCoordinates.Version == "" {
+				unresolved(dependencyCoordinates.String(), "no version declared or managed in "+coordinates.String())
+				continue
+			}
+			queue = append(queue, resolveNode{
+				coordinates: dependencyCoordinates,
+				depth:       node.depth + 1,
+				exclusions:  append(append([]maven.Exclusion(nil), node.exclusions...), dependency.Exclusions...),
+			})
+		}
+	}
+
+	return resolution
+}
+
+// follow reports whether a dependency of a node is part of the closure
+func (r *resolver) follow(node resolveNode, dependency maven.Dependency) bool {
+	if dependency.Scope == "system" || dependency.Scope == "import" {
+		return false
+	}
+	if node.depth == 0 {
+		if !r.scopes[dependency.Scope] {
+			return false
+		}
+	} else {
+		// Optional dependencies and the test and provided scopes are not transitive
+		if dependency.IsOptional() || (dependency.Scope != "compile" && dependency.Scope != "runtime") || !r.scopes[dependency.Scope] {
+			return false
+		}
+	}
+
+	for _, exclusion := range node.exclusions {
+		if exclusion.Excludes(dependency.Coordinates()) {
+			return false
+		}
+	}
+	return true
+}
+
+// model builds the effective model of an artifact and returns the repository holding its POM
+func (r *resolver) model(coordinates maven.Coordinates) (*maven.Model, string, error) {
+	pom, repo, err := r.pom(coordinates.POM())
+	if err != nil {
+		return nil, "", err
+	}
+	model, err := maven.BuildModel(pom, func(parent maven.Coordinates) (*maven.POM, error) {
+		parentPOM, _, err := r.pom(parent.POM())
+		return parentPOM, err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return model, repo, nil
+}
+
+// pom downloads a POM from the first repository holding it
+func (r *resolver) pom(coordinates maven.Coordinates) (*maven.POM, string, error) {
+	if resolved, ok := r.poms[coordinates.String()]; ok {
+		return resolved.pom, resolved.repo, resolved.err
+	}
+
+	resolved := &resolvedPOM{err: fmt.Errorf("POM not found in %s", strings.Join(r.repos, ", "))}
+	r.poms[coordinates.String()] = resolved
+
+	for _, repo := range r.repos {
+		data, err := r.read(repo + coordinates.Path())
+		if err != nil {
+			continue
+		}
+		pom, err := maven.ParsePOM(data)
+		if err != nil {
+			resolved.err = fmt.Errorf("%s%s: %w", repo, coordinates.Path(), err)
+			return nil, "", resolved.err
+		}
+
+		// Export the POM through the regular download path
+		entry := Entry{Repo: repo, Path: coordinates.Path(), URL: r.c.config.ArtiURL + repo + coordinates.Path()}
+		if !r.c.exportEntry(entry) {
+			resolved.err = fmt.Errorf("POM could not be downloaded from %s", repo)
+			return nil, "", resolved.err
+		}
+
+		fmt.Printf("Resolved %s in %s\n", coordinates, repo)
+		resolved.pom, resolved.repo, resolved.err = pom, repo, nil
+		return pom, repo, nil
+	}
+
+	return nil, "", resolved.err
+}
+
+// resolveRange selects the highest version in a range among the versions listed by the repositories
+func (r *resolver) resolveRange(coordinates maven.Coordinates) (string, error) {
+	versionRange, err := maven.ParseVersionRange(coordinates.Version)
+	if err != nil {
+		return "", err
+	}
+
+	key := coordinates.GroupID + ":" + coordinates.ArtifactID
+	versions, ok := r.versions[key]
+	if !ok {
+		for _, repo := range r.repos {
+			data, err := r.read(repo + coordinates.MetadataPath())
+			if err != nil {
+				continue
+			}
+			metadata, err := maven.ParseMetadata(data)
+			if err != nil || metadata.Versioning == nil {
+				continue
+			}
+			versions = append(versions, metadata.Versioning.Versions...)
+		}
+		r.versions[key] = versions
+	}
+
+	version, ok := versionRange.Highest(versions)
+	if !ok {
+		return "", fmt.Errorf("no version in range %s", coordinates.Version)
+	}
+	return version, nil
+}
+
+// read downloads a file of a repository in memory
+func (r *resolver) read(repoPath string) ([]byte, error) {
+	resp, err := r.c.fetch(r.c.config.ArtiURL + repoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,186 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/caezarr-oss/refap/config"
+	"github.com/caezarr-oss/refap/internal/diskspace"
+)
+
+// ErrLowSpace is returned when the free space of the export filesystem is below MinFreeSpace
+var ErrLowSpace = errors.New("not enough free disk space")
+
+// spaceRetryInterval is the time waited before checking the free space again when paused
+const spaceRetryInterval = 30 * time.Second
+
+// spaceCheckInterval is the number of bytes read between two checks of the free space
+// during a download, for the files whose size is not known in advance
+const spaceCheckInterval = 16 * 1024 * 1024
+
+// lowSpaceError reports a lack of free space to write a file of the given size
+type lowSpaceError struct {
+	dir    string
+	free   int64
+	needed int64
+	total  int64 // Size of the whole file, needed again when its download is restarted
+	kept   int64
+	full   bool // A write failed as the filesystem is full
+}
+
+func (e *lowSpaceError) Error() string {
+	if e.full {
+		return fmt.Sprintf("%v on %s: the filesystem is full", ErrLowSpace, e.dir)
+	}
+	return fmt.Sprintf("%v on %s: %d MiB free, %d MiB needed with %d MiB kept free",
+		ErrLowSpace, e.dir, diskspace.MiB(e.free), diskspace.MiB(e.needed), diskspace.MiB(e.kept))
+}
+
+func (e *lowSpaceError) Unwrap() error {
+	return ErrLowSpace
+}
+
+// Err returns the error which stopped the export, such as a lack of free disk space
+func (c *Crawler) Err() error {
+	return c.spaceErr
+}
+
+// spaceDir returns the directory whose filesystem receives the export
+func (c *Crawler) spaceDir() string {
+	if c.config.Archive != nil {
+		return filepath.Dir(c.config.Archive.BasePath())
+	}
+	return c.baseDir
+}
+
+// checkSpace returns a *lowSpaceError when writing needed bytes would leave less than
+// MinFreeSpace on the export filesystem. Nothing is checked when MinFreeSpace is 0 or
+// the free space cannot be read.
+func (c *Crawler) checkSpace(needed int64) error {
+	if c.config.MinFreeSpace <= 0 {
+		return nil
+	}
+	if needed < 0 {
+		needed = 0
+	}
+	dir := c.spaceDir()
+	free, err := diskspace.Free(dir)
+	if err != nil {
+		return nil
+	}
+	if free-needed < c.config.MinFreeSpace {
+		return &lowSpaceError{dir: dir, free: free, needed: needed, total: needed, kept: c.config.MinFreeSpace}
+	}
+	return nil
+}
+
+// waitForSpace checks that needed bytes can be written. When they cannot, it waits
+// until space is freed with the pause action, or aborts the export: the error is
+// kept and returned by the following calls, so that no other file is downloaded.
+func (c *Crawler) waitForSpace(needed int64) error {
+	if c.spaceErr != nil {
+		return c.spaceErr
+	}
+	for {
+		err := c.checkSpace(needed)
+		if err == nil {
+			return nil
+		}
+		if c.config.LowSpaceAction != config.LowSpacePause {
+			fmt.Printf("Aborting the export: %v\n", err)
+			c.spaceErr = err
+			return err
+		}
+		fmt.Printf("Pausing the export: %v, checking again in %s\n", err, spaceRetryInterval)
+		time.Sleep(spaceRetryInterval)
+	}
+}
+
+// withSpace runs a download, which fails with a *lowSpaceError when the file does not
+// fit on the export filesystem. The download is run again once space is freed with the
+// pause action, the export being aborted otherwise. As the download restarts from the
+// beginning, it waits for the size of the whole file, not only the rest of it.
+func (c *Crawler) withSpace(download func() (int64, error)) (int64, error) {
+	var needed int64
+	for {
+		if err := c.waitForSpace(needed); err != nil {
+			return 0, err
+		}
+		written, err := download()
+		var lowSpace *lowSpaceError
+		if !errors.As(err, &lowSpace) {
+			return written, err
+		}
+		needed = lowSpace.total
+	}
+}
+
+// spaceReader returns the body of a download, checking the free space against its
+// Content-Length first, then periodically while it is read
+func (c *Crawler) spaceReader(body io.Reader, size int64) (io.Reader, error) {
+	if err := c.checkSpace(size); err != nil {
+		return nil, err
+	}
+	return &spaceCheckReader{c: c, r: body, size: size, next: spaceCheckInterval}, nil
+}
+
+// spaceCheckReader checks the free space every spaceCheckInterval bytes read, for the
+// rest of the file when its size is known
+type spaceCheckReader struct {
+	c    *Crawler
+	r    io.Reader
+	size int64
+	read int64
+	next int64
+}
+
+func (r *spaceCheckReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.read += int64(n)
+	if r.read >= r.next {
+		r.next = r.read + spaceCheckInterval
+		// The rest of the file must still fit, as other writers may fill the filesystem
+		if spaceErr := r.c.checkSpace(r.size - r.read); spaceErr != nil {
+			var lowSpace *lowSpaceError
+			if errors.As(spaceErr, &lowSpace) {
+				lowSpace.total = max(r.size, r.read)
+			}
+			return n, spaceErr
+		}
+	}
+	return n, err
+}
+
+// spaceError aborts the export when a write failed because the filesystem is full,
+// whatever the low space action, as the free space checks did not prevent it
+func (c *Crawler) spaceError(err error) error {
+	if !errors.Is(err, syscall.ENOSPC) || c.spaceErr != nil {
+		return err
+	}
+	c.spaceErr = &lowSpaceError{dir: c.spaceDir(), full: true}
+	fmt.Printf("Aborting the export: %v\n", c.spaceErr)
+	return c.spaceErr
+}
+
+// estimateSpace prints the size of the files about to be exported, when it is known,
+// with a warning when it exceeds the free space of the export filesystem. Files which
+// are already exported are counted as well, the estimate being an upper bound.
+func (c *Crawler) estimateSpace(name string, size int64) {
+	if size <= 0 {
+		return
+	}
+	free, err := diskspace.Free(c.spaceDir())
+	if err != nil {
+		fmt.Printf("Estimated size of %s: %d MiB\n", name, diskspace.MiB(size))
+		return
+	}
+	fmt.Printf("Estimated size of %s: %d MiB, %d MiB free\n", name, diskspace.MiB(size), diskspace.MiB(free))
+	if free-size < c.config.MinFreeSpace {
+		fmt.Printf("Warning: %s may not fit on %s, the export stops when %d MiB are left\n",
+			name, c.spaceDir(), diskspace.MiB(c.config.MinFreeSpace))
+	}
+}
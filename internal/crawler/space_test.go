@@ -0,0 +1,99 @@
+package crawler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/caezarr-oss/refap/config"
+	"github.com/caezarr-oss/refap/internal/archive"
+	"github.com/caezarr-oss/refap/internal/diskspace"
+)
+
+func TestSpaceCheckReaderReportsWholeFile(t *testing.T) {
+	c := New(Config{MinFreeSpace: 1 << 62})
+	c.baseDir = t.TempDir()
+	size := int64(1 << 40)
+	r := &spaceCheckReader{c: c, r: strings.NewReader("partial content"), size: size, next: 4}
+
+	_, err := io.ReadAll(r)
+	var lowSpace *lowSpaceError
+	if !errors.As(err, &lowSpace) {
+		t.Fatalf("err = %v, want a lack of free space", err)
+	}
+	if lowSpace.needed != size-r.read || lowSpace.total != size {
+		t.Errorf("needed %d and total %d, want the rest %d and the whole file %d", lowSpace.needed, lowSpace.total, size-r.read, size)
+	}
+}
+
+func TestWithSpaceWaitsForWholeFileBeforeRetrying(t *testing.T) {
+	// The free space is enough for the rest of the file only
+	c := New(Config{MinFreeSpace: 1, LowSpaceAction: config.LowSpaceAbort})
+	c.baseDir = t.TempDir()
+	downloads := 0
+	_, err := c.withSpace(func() (int64, error) {
+		downloads++
+		if downloads > 1 {
+			return 0, errors.New("download restarted")
+		}
+		return 0, &lowSpaceError{needed: 1024, total: 1 << 62}
+	})
+
+	var lowSpace *lowSpaceError
+	if !errors.As(err, &lowSpace) || lowSpace.needed != 1<<62 {
+		t.Fatalf("err = %v, want a lack of space for the whole file", err)
+	}
+	if downloads != 1 {
+		t.Errorf("%d downloads, want no restart before the whole file fits", downloads)
+	}
+}
+
+func TestArchiveLowSpaceAddsNoPartialFile(t *testing.T) {
+	// The file is sent without Content-Length, its size being unknown until the end
+	content := bytes.Repeat([]byte("refap"), 2*spaceCheckInterval/5)
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		w.Write(content)
+	}))
+	defer source.Close()
+
+	w, err := archive.NewWriter(filepath.Join(t.TempDir(), "export"), archive.FormatTarGz, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	free, err := diskspace.Free(filepath.Dir(w.BasePath()))
+	if err != nil {
+		t.Skipf("free space unavailable: %v", err)
+	}
+
+	// The space is lacking once the first spaceCheckInterval bytes are written
+	c := newTestCrawler(t, source, Config{
+		Archive:        w,
+		MinFreeSpace:   free - spaceCheckInterval/2,
+		LowSpaceAction: config.LowSpaceAbort,
+	})
+	if c.save(Entry{URL: source.URL + "/big.bin", Path: "big.bin"}, "libs/big.bin") {
+		t.Fatal("file saved without the free space")
+	}
+	if !errors.Is(c.Err(), ErrLowSpace) {
+		t.Errorf("Err() = %v, want the lack of free space", c.Err())
+	}
+	if c.summary.FilesFailed != 1 || c.summary.FilesDownloaded != 0 {
+		t.Errorf("%d files failed and %d downloaded, want the file failed", c.summary.FilesFailed, c.summary.FilesDownloaded)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if entries := w.Entries(); len(entries) != 0 {
+		t.Errorf("archive entries = %+v, want no partial file", entries)
+	}
+	if len(w.Volumes()) != 0 {
+		t.Errorf("volumes %v created, want no volume", w.Volumes())
+	}
+}
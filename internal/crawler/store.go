@@ -0,0 +1,59 @@
+package crawler
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// linkStored links a file from the content store instead of downloading it, when
+// its expected sha256 is known and the store already holds it. It reports whether
+// the file was linked.
+func (c *Crawler) linkStored(target string, want digest) bool {
+	if c.config.Store == nil || want.algorithm != "sha256" {
+		return false
+	}
+	sum := hex.EncodeToString(want.sum)
+	size, ok := c.config.Store.Size(sum)
+	if !ok {
+		return false
+	}
+	if err := c.checkTarget(target); err != nil {
+		return false
+	}
+
+	fmt.Printf("Linking %s in %s from the content store\n", filepath.Base(target), filepath.Dir(target))
+	if err := c.config.Store.Link(sum, target); err != nil {
+		fmt.Printf("Failed to link %s: %v\n", target, err)
+		return false
+	}
+	c.summary.FilesLinked++
+	c.summary.BytesSaved += size
+	return true
+}
+
+// remoteSHA256 returns the sha256 of a file reported by the X-Checksum-Sha256
+// header of Artifactory, using a HEAD request, or an empty string
+func (c *Crawler) remoteSHA256(urlStr string) string {
+	return strings.ToLower(c.head(urlStr).Get("X-Checksum-Sha256"))
+}
+
+// head performs a HEAD request on the URL of a file and returns the headers of the
+// response, or nil when the request failed
+func (c *Crawler) head(urlStr string) http.Header {
+	req, err := c.newRequest(http.MethodHead, urlStr, nil)
+	if err != nil {
+		return nil
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	return resp.Header
+}
@@ -0,0 +1,72 @@
+package crawler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/caezarr-oss/refap/config"
+	"github.com/caezarr-oss/refap/internal/cas"
+)
+
+func TestProcessRepositoriesDownloadsSharedContentOnce(t *testing.T) {
+	content := strings.Repeat("shared jar content", 100)
+	sum := sha256.Sum256([]byte(content))
+	stub, source := newListingStub(t, map[string]string{
+		"libs-a/org/lib-1.0.jar": content,
+		"libs-b/org/lib-1.0.jar": content,
+	})
+	for _, relPath := range []string{"libs-a/org/lib-1.0.jar", "libs-b/org/lib-1.0.jar"} {
+		stub.headers[relPath] = http.Header{"X-Checksum-Sha256": {hex.EncodeToString(sum[:])}}
+	}
+
+	store, err := cas.Open(t.TempDir(), cas.LinkHardlink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newTestCrawler(t, source, Config{FilterMode: config.FilterModeBlacklist, Store: store})
+	if err := c.ProcessRepositories([]string{"libs-a", "libs-b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := stub.count(http.MethodGet, "libs-a/org/lib-1.0.jar") + stub.count(http.MethodGet, "libs-b/org/lib-1.0.jar"); n != 1 {
+		t.Errorf("content downloaded %d times, want once", n)
+	}
+
+	// Both targets are links to the stored content
+	var infos []os.FileInfo
+	for _, repo := range []string{"libs-a", "libs-b"} {
+		target := filepath.Join(c.config.BaseDir, repo, "org", "lib-1.0.jar")
+		data, err := os.ReadFile(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("%s holds %q, want the shared content", target, data)
+		}
+		info, err := os.Stat(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		infos = append(infos, info)
+	}
+	if !os.SameFile(infos[0], infos[1]) {
+		t.Error("the targets are not links to the same file")
+	}
+
+	summary := c.Summary()
+	if summary.FilesDownloaded != 1 || summary.FilesLinked != 1 || summary.BytesSaved != int64(len(content)) {
+		t.Errorf("summary = %+v, want 1 file downloaded and 1 linked saving %d bytes", summary, len(content))
+	}
+	var printed bytes.Buffer
+	summary.Print(&printed)
+	if want := fmt.Sprintf("Files linked from the content store: 1 (%d bytes saved)", len(content)); !strings.Contains(printed.String(), want) {
+		t.Errorf("summary printed:\n%s\nwant %q", printed.String(), want)
+	}
+}
@@ -0,0 +1,63 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+)
+
+// Summary holds the statistics of a crawl
+type Summary struct {
+	Repositories       int
+	RepositoriesFailed int
+	FilesDownloaded    int
+	FilesSkipped       int
+	FilesFailed        int
+	BytesDownloaded    int64
+	Conflicts          int   // Files provided with a different content by several repositories
+	CyclesSkipped      int   // Listings already crawled, reached again through a link or a redirect
+	DepthLimited       int   // Directories not crawled as they are deeper than MaxDepth
+	FilesLinked        int   // Files linked from the content store instead of being downloaded
+	BytesSaved         int64 // Size of the files linked from the content store
+	FilesFromCache     int   // Files read from the download cache instead of the server
+	BytesFromCache     int64 // Size of the files read from the download cache
+}
+
+// Add accumulates the statistics of another summary
+func (s *Summary) Add(other Summary) {
+	s.Repositories += other.Repositories
+	s.RepositoriesFailed += other.RepositoriesFailed
+	s.FilesDownloaded += other.FilesDownloaded
+	s.FilesSkipped += other.FilesSkipped
+	s.FilesFailed += other.FilesFailed
+	s.BytesDownloaded += other.BytesDownloaded
+	s.Conflicts += other.Conflicts
+	s.CyclesSkipped += other.CyclesSkipped
+	s.DepthLimited += other.DepthLimited
+	s.FilesLinked += other.FilesLinked
+	s.BytesSaved += other.BytesSaved
+	s.FilesFromCache += other.FilesFromCache
+	s.BytesFromCache += other.BytesFromCache
+}
+
+// Print writes a human readable summary
+func (s *Summary) Print(w io.Writer) {
+	fmt.Fprintf(w, "Repositories processed: %d (%d failed)\n", s.Repositories, s.RepositoriesFailed)
+	fmt.Fprintf(w, "Files downloaded: %d (%d bytes)\n", s.FilesDownloaded, s.BytesDownloaded)
+	if s.FilesLinked > 0 {
+		fmt.Fprintf(w, "Files linked from the content store: %d (%d bytes saved)\n", s.FilesLinked, s.BytesSaved)
+	}
+	if s.FilesFromCache > 0 {
+		fmt.Fprintf(w, "Files read from the download cache: %d (%d bytes)\n", s.FilesFromCache, s.BytesFromCache)
+	}
+	fmt.Fprintf(w, "Files skipped: %d\n", s.FilesSkipped)
+	fmt.Fprintf(w, "Files failed: %d\n", s.FilesFailed)
+	if s.Conflicts > 0 {
+		fmt.Fprintf(w, "Conflicts: %d\n", s.Conflicts)
+	}
+	if s.CyclesSkipped > 0 {
+		fmt.Fprintf(w, "Listing cycles skipped: %d\n", s.CyclesSkipped)
+	}
+	if s.DepthLimited > 0 {
+		fmt.Fprintf(w, "Directories beyond max depth: %d\n", s.DepthLimited)
+	}
+}
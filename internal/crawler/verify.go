@@ -0,0 +1,189 @@
+package crawler
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/caezarr-oss/refap/internal/pathutil"
+)
+
+// digest is a checksum a downloaded file must match: the sum of its content, or a
+// check of the downloaded file when it cannot be hashed as a stream
+type digest struct {
+	algorithm string
+	newHash   func() hash.Hash
+	sum       []byte
+	check     func(file *os.File, size int64) error
+}
+
+// saveEntry downloads a file found by Walk to its target, and checks it against
+// the strongest checksum provided by the listing when there is one. With a content
+// store, the sha256 is asked to the server when the listing does not provide it,
+// so that a content already stored is not downloaded again.
+func (c *Crawler) saveEntry(entry Entry, target string) bool {
+	if c.config.Store != nil && entry.SHA256 == "" {
+		entry.SHA256 = c.remoteSHA256(entry.URL)
+	}
+	for _, candidate := range []struct {
+		algorithm string
+		newHash   func() hash.Hash
+		value     string
+	}{{"sha256", sha256.New, entry.SHA256}, {"sha1", sha1.New, entry.SHA1}} {
+		if sum, err := hex.DecodeString(candidate.value); err == nil && len(sum) == candidate.newHash().Size() {
+			return c.saveVerified(entry, target, digest{algorithm: candidate.algorithm, newHash: candidate.newHash, sum: sum})
+		}
+	}
+	return c.save(entry, target)
+}
+
+// saveVerified downloads a file to its target and checks it against the expected digest.
+// The file is downloaded to a temporary file first, so that a file which does not
+// match is never exported. It reports whether the file was exported.
+func (c *Crawler) saveVerified(entry Entry, target string, want digest) bool {
+	if c.spaceErr != nil {
+		// The export was aborted for a lack of free disk space
+		return false
+	}
+	if c.linkStored(target, want) {
+		return true
+	}
+
+	if c.config.Archive != nil {
+		fmt.Printf("Archiving %s\n", target)
+	} else {
+		fmt.Printf("Downloading %s in %s\n", filepath.Base(target), filepath.Dir(target))
+	}
+	c.downloading(true)
+	written, err := c.downloadVerified(target, entry.URL, want)
+	c.downloading(false)
+
+	if err == nil {
+		c.countDownload(written)
+	} else {
+		c.summary.FilesFailed++
+		fmt.Printf("Failed to download %s: %v\n", entry.URL, err)
+		c.logFailedDownload(path.Base(entry.Path), entry.URL)
+	}
+	c.publish()
+
+	// Wait between downloads as specified in config
+	time.Sleep(time.Duration(c.config.Delay) * time.Second)
+	return err == nil
+}
+
+// downloadVerified downloads a file to a temporary file, checks its digest and
+// moves it to its target in the output directory or the archive. With a content
+// store, the file is moved into the store and linked at its target.
+func (c *Crawler) downloadVerified(target, urlStr string, want digest) (int64, error) {
+	if c.config.Archive == nil {
+		if err := c.checkTarget(target); err != nil {
+			return 0, err
+		}
+	}
+
+	var sum string
+	if want.algorithm == "sha256" {
+		sum = hex.EncodeToString(want.sum)
+	}
+	return c.withSpace(func() (int64, error) {
+		return c.downloadTemp(target, urlStr, sum, want)
+	})
+}
+
+// downloadTemp performs a download of downloadVerified, the file being fetched from
+// the download cache when its sha256 sum is known
+func (c *Crawler) downloadTemp(target, urlStr, sum string, want digest) (int64, error) {
+	resp, err := c.fetchFile(urlStr, sum)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := c.spaceReader(resp.Body, resp.ContentLength)
+	if err != nil {
+		return 0, err
+	}
+
+	// The temporary file is created next to the target to be renamed, or next to
+	// the archive volumes, whose free space is checked
+	tempDir := c.spaceDir()
+	if c.config.Archive == nil {
+		tempDir = filepath.Dir(pathutil.SanitizePath(target))
+		if err := pathutil.EnsureDirectoryExists(tempDir); err != nil {
+			return 0, err
+		}
+	}
+	tempFile, err := os.CreateTemp(tempDir, ".refap-*.part")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	writers := []io.Writer{tempFile}
+	var h, contentHash hash.Hash
+	if want.newHash != nil {
+		h = want.newHash()
+		writers = append(writers, h)
+	}
+	if c.config.Store != nil {
+		contentHash = sha256.New()
+		writers = append(writers, contentHash)
+	}
+	writer := io.MultiWriter(writers...)
+	written, err := io.Copy(writer, body)
+	if err != nil {
+		return 0, c.spaceError(err)
+	}
+	if h != nil {
+		if sum := h.Sum(nil); !bytes.Equal(sum, want.sum) {
+			return 0, fmt.Errorf("%s mismatch: expected %s, got %s", want.algorithm, hex.EncodeToString(want.sum), hex.EncodeToString(sum))
+		}
+	}
+	if want.check != nil {
+		if err := want.check(tempFile, written); err != nil {
+			return 0, fmt.Errorf("%s mismatch: %w", want.algorithm, err)
+		}
+	}
+
+	if c.config.Archive != nil {
+		modTime, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+		if err != nil {
+			modTime = time.Now()
+		}
+		if _, err := tempFile.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if _, err := c.config.Archive.Add(target, written, modTime, tempFile); err != nil {
+			return 0, c.spaceError(err)
+		}
+		return written, nil
+	}
+
+	if err := tempFile.Close(); err != nil {
+		return 0, c.spaceError(err)
+	}
+	if c.config.Store != nil {
+		sum := hex.EncodeToString(contentHash.Sum(nil))
+		if err := c.config.Store.Put(tempFile.Name(), sum); err != nil {
+			return 0, err
+		}
+		if err := c.config.Store.Link(sum, pathutil.SanitizePath(target)); err != nil {
+			return 0, err
+		}
+		return written, nil
+	}
+	if err := os.Rename(tempFile.Name(), pathutil.SanitizePath(target)); err != nil {
+		return 0, err
+	}
+	return written, nil
+}
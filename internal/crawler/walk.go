@@ -0,0 +1,222 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/caezarr-oss/refap/config"
+	"github.com/caezarr-oss/refap/internal/httpclient"
+)
+
+// Entry is a file found while walking a repository listing
+type Entry struct {
+	Repo string // Repository as configured, e.g. "libs-release/"
+	Path string // Slash separated path of the file relative to the repository
+	URL  string // URL of the file
+
+	// Checksums of the file, when the listing provides them
+	SHA1   string
+	SHA256 string
+}
+
+// WalkFunc is called for each file of a repository accepted by the filters.
+// Returning an error stops the walk.
+type WalkFunc func(entry Entry) error
+
+// Link is an entry of a listing page. Directories end with a slash.
+type Link struct {
+	Href string // Value of the href attribute
+	Text string // Name of the entry
+	URL  string // URL of the entry, resolved against the listing URL by readListing
+}
+
+// Walk crawls the listing pages of a repository recursively and calls fn for
+// each file accepted by the filters. Listings are read in memory only, each of
+// them once, and directories deeper than MaxDepth are not crawled.
+func (c *Crawler) Walk(repo string, fn WalkFunc) error {
+	if c.config.SourceType == config.SourceNexus {
+		return c.walkNexus(repo, fn)
+	}
+	return c.walkListing(repo, c.repoURL(repo), "", 0, make(map[string]bool), fn)
+}
+
+// walkListing reads the listing at listingURL, which is the directory dir of the
+// repository at the given depth. visited holds the normalized URLs of the listings
+// already read, so that links and redirects back to them are not followed again.
+func (c *Crawler) walkListing(repo, listingURL, dir string, depth int, visited map[string]bool, fn WalkFunc) error {
+	if c.skipVisited(listingURL, visited) {
+		return nil
+	}
+
+	links, finalURL, err := c.readListing(listingURL, c.repoURL(repo))
+	if errors.Is(err, httpclient.ErrRedirectLoop) {
+		fmt.Printf("Skipping %s: %v\n", listingURL, err)
+		c.summary.CyclesSkipped++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if finalURL != listingURL && c.skipVisited(finalURL, visited) {
+		return nil
+	}
+
+	referenced := c.gradleReferences(links)
+	defer c.forgetGradleModules(links)
+
+	// The files of the listing are queued while its subdirectories are crawled
+	remaining := 0
+	for _, l := range links {
+		if !strings.HasSuffix(l.Text, "/") && c.acceptFile(dir, l, referenced) {
+			remaining++
+		}
+	}
+	c.queued(remaining)
+	defer func() { c.queued(-remaining) }()
+
+	// Parent links and names leading out of the listing are already skipped by readListing
+	for _, l := range links {
+		if strings.HasSuffix(l.Text, "/") {
+			// This is a directory, crawl recursively
+			subDir := path.Join(dir, strings.TrimSuffix(l.Text, "/"))
+			if c.config.MaxDepth > 0 && depth >= c.config.MaxDepth {
+				fmt.Printf("Not crawling %s: deeper than the max depth of %d\n", path.Join(repo, subDir), c.config.MaxDepth)
+				c.summary.DepthLimited++
+				continue
+			}
+			fmt.Printf("Crawling %s\n", path.Join(repo, subDir))
+			if err := c.walkListing(repo, l.URL, subDir, depth+1, visited, fn); err != nil {
+				fmt.Printf("Failed to crawl %s: %v\n", l.URL, err)
+			}
+			continue
+		}
+
+		// Check if it's a file we want to download
+		if !c.acceptFile(dir, l, referenced) {
+			continue
+		}
+
+		entry := Entry{
+			Repo: repo,
+			Path: path.Join(dir, l.Text),
+			URL:  l.URL,
+		}
+		remaining--
+		c.queued(-1)
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// repoURL returns the URL of the root listing of a repository, ending with a slash
+func (c *Crawler) repoURL(repo string) string {
+	return strings.TrimSuffix(c.config.ArtiURL, "/") + "/" + strings.Trim(repo, "/") + "/"
+}
+
+// skipVisited reports whether a listing was already read, and marks it as read otherwise
+func (c *Crawler) skipVisited(listingURL string, visited map[string]bool) bool {
+	key := normalizeURL(listingURL)
+	if visited[key] {
+		fmt.Printf("Skipping %s: listing already crawled\n", listingURL)
+		c.summary.CyclesSkipped++
+		return true
+	}
+	visited[key] = true
+	return false
+}
+
+// normalizeURL returns the form of a URL used to recognize a listing: lower-case
+// scheme and host without default port, clean path without trailing slash, escaped
+// the same way whatever the encoding of the link, and no fragment
+func normalizeURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "http" && u.Port() == "80") || (u.Scheme == "https" && u.Port() == "443") {
+		u.Host = strings.TrimSuffix(u.Host, ":"+u.Port())
+	}
+	u.Path = strings.TrimSuffix(path.Clean("/"+u.Path), "/")
+	u.RawPath = ""
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String()
+}
+
+// fetchListing downloads a listing page in memory
+func (c *Crawler) fetchListing(urlStr string) ([]byte, error) {
+	resp, err := c.fetch(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
+
+// parseListing extracts the links of an Artifactory listing page
+func parseListing(listing []byte) []Link {
+	var links []Link
+
+	// Read the listing line by line
+	scanner := bufio.NewScanner(bytes.NewReader(listing))
+	for scanner.Scan() {
+		if l, ok := parseListingLine(scanner.Text()); ok {
+			links = append(links, l)
+		}
+	}
+
+	return links
+}
+
+// parseListingLine extracts the link of a listing line starting with "<a href=" or "<pre><a href="
+func parseListingLine(line string) (Link, bool) {
+	line = strings.TrimLeft(strings.Replace(line, "\t", "", -1), " ")
+
+	// Check if the line starts with "<a href=" or "<pre><a href="
+	if !strings.HasPrefix(line, "<a href=") && !strings.HasPrefix(line, "<pre><a href=") {
+		return Link{}, false
+	}
+
+	// Extract href value
+	hrefStartIndex := strings.Index(line, "href=") + len("href=")
+	if hrefStartIndex+1 > len(line) {
+		// The line ends right after href=
+		return Link{}, false
+	}
+
+	// The closing quote is searched after the opening one
+	hrefEndIndex := strings.Index(line[hrefStartIndex+1:], "\"")
+	if hrefEndIndex < 0 {
+		return Link{}, false
+	}
+	hrefEndIndex += hrefStartIndex + 1
+	urlValue := line[hrefStartIndex+1 : hrefEndIndex]
+
+	// Extract element value (text between <a> tags)
+	elStartIndex := strings.Index(line[hrefEndIndex:], ">") + 1
+	if elStartIndex < 1 {
+		return Link{}, false
+	}
+	elStartIndex += hrefEndIndex
+
+	elEndIndex := strings.Index(line[elStartIndex:], "</a>")
+	if elEndIndex < 0 {
+		return Link{}, false
+	}
+	elEndIndex += elStartIndex
+	elValue := line[elStartIndex:elEndIndex]
+
+	return Link{Href: urlValue, Text: elValue}, true
+}
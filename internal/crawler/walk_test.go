@@ -0,0 +1,225 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/caezarr-oss/refap/config"
+)
+
+// listingStub is an Artifactory serving the files of its repositories below
+// /artifactory/list/, with a listing page for each directory. It counts the
+// requests by method and path, and answers Not Modified to a matching If-None-Match.
+type listingStub struct {
+	mu       sync.Mutex
+	files    map[string]string      // Content by path below /artifactory/list/
+	headers  map[string]http.Header // Additional response headers by path
+	requests map[string]int         // Requests by "<method> <path>"
+}
+
+func newListingStub(t *testing.T, files map[string]string) (*listingStub, *httptest.Server) {
+	stub := &listingStub{files: files, headers: make(map[string]http.Header), requests: make(map[string]int)}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	return stub, server
+}
+
+// count returns the number of requests of a method on a path below /artifactory/list/
+func (s *listingStub) count(method, relPath string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[method+" /artifactory/list/"+relPath]
+}
+
+func (s *listingStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[r.Method+" "+r.URL.Path]++
+
+	relPath, ok := strings.CutPrefix(r.URL.Path, "/artifactory/list/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if content, ok := s.files[relPath]; ok {
+		for name, values := range s.headers[relPath] {
+			w.Header()[name] = values
+		}
+		if etag := w.Header().Get("ETag"); etag != "" && r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		io.WriteString(w, content)
+		return
+	}
+
+	// The listing of a directory has a line per child, directories ending with a slash
+	dir := strings.TrimSuffix(relPath, "/") + "/"
+	children := make(map[string]bool)
+	for filePath := range s.files {
+		if rest, ok := strings.CutPrefix(filePath, dir); ok {
+			name, _, isDir := strings.Cut(rest, "/")
+			if isDir {
+				name += "/"
+			}
+			children[name] = true
+		}
+	}
+	if len(children) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	fmt.Fprintln(w, `<a href="../">../</a>`)
+	for _, name := range sortedKeys(children) {
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", name, name)
+	}
+}
+
+func TestParseListingLine(t *testing.T) {
+	for line, want := range map[string]Link{
+		`<a href="lib-1.0.jar">lib-1.0.jar</a>    01-Jan-2024 10:00  1.2 KB`: {Href: "lib-1.0.jar", Text: "lib-1.0.jar"},
+		`<pre><a href="org/">org/</a>`:                                       {Href: "org/", Text: "org/"},
+		"\t  <a href=\"1.0/\">1.0/</a>":                                      {Href: "1.0/", Text: "1.0/"},
+	} {
+		got, ok := parseListingLine(line)
+		if !ok || got != want {
+			t.Errorf("parseListingLine(%q) = %+v, %v, want %+v", line, got, ok, want)
+		}
+	}
+}
+
+func TestParseListingLineSkipsMalformedLines(t *testing.T) {
+	for _, line := range []string{
+		`<a href=`,
+		`<pre><a href=`,
+		`<a href="`,
+		`<a href="lib-1.0.jar`,
+		`<a href="lib-1.0.jar"`,
+		`<a href="lib-1.0.jar">lib-1.0.jar`,
+		`<p>not a link</p>`,
+	} {
+		if l, ok := parseListingLine(line); ok {
+			t.Errorf("parseListingLine(%q) = %+v, want the line skipped", line, l)
+		}
+	}
+}
+
+func TestParseListingSkipsTruncatedLines(t *testing.T) {
+	links := parseListing([]byte("<a href=\n<pre><a href=\n<a href=\"lib-1.0.jar\">lib-1.0.jar</a>\n"))
+	if len(links) != 1 || links[0].Href != "lib-1.0.jar" {
+		t.Errorf("links = %+v, want lib-1.0.jar only", links)
+	}
+}
+
+// walkPaths walks a repository and returns the paths of its files
+func walkPaths(t *testing.T, c *Crawler, repo string) []string {
+	t.Helper()
+	var paths []string
+	err := c.Walk(repo, func(entry Entry) error {
+		paths = append(paths, entry.Path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestWalkSkipsListingsReachedAgain(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/artifactory/list/libs/":
+			// Links to the listing itself, and a directory redirected back to it
+			fmt.Fprint(w, `<a href="./">./</a>
+<a href="/artifactory/list/libs/">libs/</a>
+<a href="/artifactory/list/libs">libs</a>
+<a href="loop/">loop/</a>
+<a href="org/">org/</a>
+<a href="lib-1.0.jar">lib-1.0.jar</a>`)
+		case "/artifactory/list/libs/loop/":
+			http.Redirect(w, r, "/artifactory/list/libs/", http.StatusFound)
+		case "/artifactory/list/libs/org/":
+			fmt.Fprint(w, `<a href="../">../</a>
+<a href=".">.</a>
+<a href="lib-2.0.jar">lib-2.0.jar</a>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer source.Close()
+
+	c := newTestCrawler(t, source, Config{FilterMode: config.FilterModeBlacklist})
+	paths := walkPaths(t, c, "libs")
+	if strings.Join(paths, " ") != "org/lib-2.0.jar lib-1.0.jar" {
+		t.Errorf("paths = %v, want each file once", paths)
+	}
+	if summary := c.Summary(); summary.CyclesSkipped != 1 {
+		t.Errorf("CyclesSkipped = %d, want the redirect back to the root counted once", summary.CyclesSkipped)
+	}
+	// The self links are not followed, only the redirect reads the root again
+	if requests["/artifactory/list/libs/org/"] != 1 || requests["/artifactory/list/libs/"] != 2 {
+		t.Errorf("requests = %v, want each listing read once, the root again through the redirect", requests)
+	}
+}
+
+func TestWalkStopsAtMaxDepth(t *testing.T) {
+	stub, source := newListingStub(t, map[string]string{
+		"libs/lib-1.0.jar":               "1",
+		"libs/org/lib-2.0.jar":           "2",
+		"libs/org/example/lib-3.0.jar":   "3",
+		"libs/org/example/a/lib-4.0.jar": "4",
+		"libs/org/other/lib-5.0.jar":     "5",
+	})
+
+	c := newTestCrawler(t, source, Config{FilterMode: config.FilterModeBlacklist, MaxDepth: 1})
+	paths := walkPaths(t, c, "libs")
+	if strings.Join(paths, " ") != "lib-1.0.jar org/lib-2.0.jar" {
+		t.Errorf("paths = %v, want the files of the root and of its subdirectories", paths)
+	}
+	if summary := c.Summary(); summary.DepthLimited != 2 {
+		t.Errorf("DepthLimited = %d, want org/example and org/other counted", summary.DepthLimited)
+	}
+	if n := stub.count(http.MethodGet, "libs/org/example/"); n != 0 {
+		t.Errorf("libs/org/example/ read %d times, want not crawled", n)
+	}
+}
+
+func TestWalkSkipsRedirectLoops(t *testing.T) {
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/artifactory/list/libs/":
+			fmt.Fprint(w, `<a href="a/">a/</a>
+<a href="org/">org/</a>`)
+		case "/artifactory/list/libs/a/":
+			http.Redirect(w, r, "/artifactory/list/libs/b/", http.StatusFound)
+		case "/artifactory/list/libs/b/":
+			http.Redirect(w, r, "/artifactory/list/libs/a/", http.StatusFound)
+		case "/artifactory/list/libs/org/":
+			fmt.Fprint(w, `<a href="lib-1.0.jar">lib-1.0.jar</a>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer source.Close()
+
+	c := newTestCrawler(t, source, Config{FilterMode: config.FilterModeBlacklist})
+	paths := walkPaths(t, c, "libs")
+	if len(paths) != 1 || paths[0] != "org/lib-1.0.jar" {
+		t.Errorf("paths = %v, want the walk to go on after the loop", paths)
+	}
+	if summary := c.Summary(); summary.CyclesSkipped != 1 {
+		t.Errorf("CyclesSkipped = %d, want the redirect loop counted", summary.CyclesSkipped)
+	}
+}
@@ -0,0 +1,11 @@
+package diskspace
+
+import "errors"
+
+// ErrUnsupported is returned by Free on the platforms where the free space cannot be read
+var ErrUnsupported = errors.New("free disk space cannot be read on this platform")
+
+// MiB converts a size in bytes to MiB, for messages
+func MiB(size int64) int64 {
+	return size / (1024 * 1024)
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package diskspace
+
+// Free is not supported on this platform
+func Free(path string) (int64, error) {
+	return 0, ErrUnsupported
+}
@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd
+
+package diskspace
+
+import "golang.org/x/sys/unix"
+
+// Free returns the space available to the user on the filesystem holding path, in bytes
+func Free(path string) (int64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,16 @@
+package diskspace
+
+import "golang.org/x/sys/windows"
+
+// Free returns the space available to the user on the volume holding path, in bytes
+func Free(path string) (int64, error) {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var available, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(name, &available, &total, &free); err != nil {
+		return 0, err
+	}
+	return int64(available), nil
+}
@@ -0,0 +1,196 @@
+package gomod
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/caezarr-oss/refap/internal/npm"
+)
+
+// pseudoVersionPattern matches the pseudo-versions of untagged commits, e.g. v0.0.0-20191109021931-daa7c04131f5
+var pseudoVersionPattern = regexp.MustCompile(`^v[0-9]+\.(0\.0-|\d+\.\d+-([^+]*\.)?0\.)\d{14}-[A-Za-z0-9]+(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`)
+
+// ModSuffix is the suffix of the go.sum versions holding the hash of a go.mod file
+const ModSuffix = "/go.mod"
+
+// EscapePath escapes a module path or a version for the GOPROXY protocol,
+// each upper-case letter being replaced with an exclamation mark followed by
+// the lower-case letter, e.g. github.com/!azure/azure-sdk-for-go
+func EscapePath(s string) (string, error) {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '!' || r >= utf8.RuneSelf:
+			return "", fmt.Errorf("invalid character %q in %q", r, s)
+		case 'A' <= r && r <= 'Z':
+			b.WriteByte('!')
+			b.WriteRune(r + 'a' - 'A')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String(), nil
+}
+
+// IsPseudoVersion reports whether the version is a pseudo-version
+func IsPseudoVersion(version string) bool {
+	return strings.Count(version, "-") >= 2 && pseudoVersionPattern.MatchString(version)
+}
+
+// Sums are the h1: hashes of go.sum files, keyed by "<module> <version>" for
+// the module zips and "<module> <version>/go.mod" for their go.mod files
+type Sums map[string]string
+
+// Key returns the key of the hash of a module zip, or of its go.mod file when mod is set
+func Key(module, version string, mod bool) string {
+	if mod {
+		return module + " " + version + ModSuffix
+	}
+	return module + " " + version
+}
+
+// Parse adds the hashes of a go.sum file. The lines which are not
+// "<module> <version>[/go.mod] h1:<hash>" are ignored, so that the
+// responses of the checksum database lookup endpoint can also be read.
+func (s Sums) Parse(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || !strings.HasPrefix(fields[2], "h1:") {
+			continue
+		}
+		s[fields[0]+" "+fields[1]] = fields[2]
+	}
+	return scanner.Err()
+}
+
+// Load adds the hashes of a go.sum file, or of all the files of a directory
+// such as a dump of the checksum database lookup responses
+func (s Sums) Load(name string) error {
+	return filepath.WalkDir(name, func(filePath string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		file, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if err := s.Parse(file); err != nil {
+			return fmt.Errorf("error reading %s: %w", filePath, err)
+		}
+		return nil
+	})
+}
+
+// Requirements returns the module versions of the hashes. A version only listed
+// with its go.mod file is needed for the module graph only, so it does not need its zip.
+func (s Sums) Requirements() map[string]map[string]bool {
+	requirements := make(map[string]map[string]bool)
+	for key := range s {
+		module, version, _ := strings.Cut(key, " ")
+		version, isMod := strings.CutSuffix(version, ModSuffix)
+		if requirements[module] == nil {
+			requirements[module] = make(map[string]bool)
+		}
+		requirements[module][version] = requirements[module][version] || !isMod
+	}
+	return requirements
+}
+
+// HashMod returns the h1: hash of a go.mod file
+func HashMod(data []byte) string {
+	sum, _ := hashFiles([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+	return sum
+}
+
+// HashZip returns the h1: hash of a module zip, computed over its files as the go command does
+func HashZip(r io.ReaderAt, size int64) (string, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return "", err
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	names := make([]string, 0, len(archive.File))
+	for _, file := range archive.File {
+		if strings.Contains(file.Name, "\n") {
+			return "", fmt.Errorf("invalid file name %q", file.Name)
+		}
+		if _, ok := files[file.Name]; ok {
+			return "", fmt.Errorf("duplicate file %s", file.Name)
+		}
+		files[file.Name] = file
+		names = append(names, file.Name)
+	}
+
+	return hashFiles(names, func(name string) (io.ReadCloser, error) {
+		return files[name].Open()
+	})
+}
+
+// hashFiles computes the h1: hash of a file tree: the SHA-256 of the list of the
+// "<sha256>  <name>" lines of its files, sorted by name
+func hashFiles(names []string, open func(string) (io.ReadCloser, error)) (string, error) {
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+
+	summary := sha256.New()
+	for _, name := range names {
+		file, err := open(name)
+		if err != nil {
+			return "", fmt.Errorf("error reading %s: %w", name, err)
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, file)
+		file.Close()
+		if err != nil {
+			return "", fmt.Errorf("error reading %s: %w", name, err)
+		}
+		fmt.Fprintf(summary, "%x  %s\n", h.Sum(nil), name)
+	}
+	return "h1:" + base64.StdEncoding.EncodeToString(summary.Sum(nil)), nil
+}
+
+// Select returns the versions within the semver range, sorted from the lowest to the
+// highest, prereleases and pseudo-versions being ignored unless includePrerelease is set.
+// With latestOnly, only the highest one is returned.
+func Select(versions []string, versionRange string, includePrerelease, latestOnly bool) ([]string, error) {
+	r, err := npm.ParseRange(versionRange)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []string
+	parsed := make(map[string]npm.Version)
+	for _, version := range versions {
+		v, err := npm.ParseVersion(version)
+		if err != nil || !strings.HasPrefix(version, "v") {
+			continue
+		}
+		if r.Contains(v, includePrerelease) {
+			selected = append(selected, version)
+			parsed[version] = v
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return parsed[selected[i]].Compare(parsed[selected[j]]) < 0
+	})
+
+	if latestOnly && len(selected) > 0 {
+		return selected[len(selected)-1:], nil
+	}
+	return selected, nil
+}
@@ -0,0 +1,119 @@
+package gomod
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// goSum holds the lines of the go.sum of refap for the modules of testdata
+const goSum = `github.com/kr/text v0.2.0/go.mod h1:eLer722TekiGuMkidMxC/pM04lWEeraHUUmBw8l2grE=
+github.com/pmezard/go-difflib v1.0.0 h1:4DBwDE0NGyQoBHbLQYPwSUPoCMWR5BEzIk/f1lZbAQM=
+github.com/pmezard/go-difflib v1.0.0/go.mod h1:iKH77koFhYxTK1pcRnkKkqfTogsbg7gZNVY4sRDYZ/4=
+`
+
+func readSums(t *testing.T) Sums {
+	t.Helper()
+	sums := make(Sums)
+	if err := sums.Parse(strings.NewReader(goSum)); err != nil {
+		t.Fatal(err)
+	}
+	return sums
+}
+
+func TestHashMod(t *testing.T) {
+	sums := readSums(t)
+	for _, test := range []struct {
+		file, module, version string
+	}{
+		{"go-difflib@v1.0.0.mod", "github.com/pmezard/go-difflib", "v1.0.0"},
+		{"text@v0.2.0.mod", "github.com/kr/text", "v0.2.0"},
+	} {
+		data, err := os.ReadFile(filepath.Join("testdata", test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := sums[Key(test.module, test.version, true)]
+		if got := HashMod(data); got != want {
+			t.Errorf("HashMod(%s) = %s, want %s", test.file, got, want)
+		}
+	}
+}
+
+func TestHashZip(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "go-difflib@v1.0.0.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := readSums(t)[Key("github.com/pmezard/go-difflib", "v1.0.0", false)]
+	got, err := HashZip(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("HashZip = %s, want %s", got, want)
+	}
+
+	// A zip with a changed file does not match anymore
+	var changed bytes.Buffer
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(&changed)
+	for _, file := range archive.File {
+		content, err := w.Create(file.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(file.Name, "/README.md") {
+			content.Write([]byte("changed"))
+			continue
+		}
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.Copy(content, r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := HashZip(bytes.NewReader(changed.Bytes()), int64(changed.Len())); err != nil || got == want {
+		t.Errorf("HashZip of a changed zip = %s, %v, want another hash", got, err)
+	}
+}
+
+func TestHashZipRejectsDuplicateFiles(t *testing.T) {
+	var data bytes.Buffer
+	w := zip.NewWriter(&data)
+	for range 2 {
+		if _, err := w.Create("example.com/m@v1.0.0/go.mod"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := HashZip(bytes.NewReader(data.Bytes()), int64(data.Len())); err == nil {
+		t.Error("HashZip accepted a zip with a duplicate file")
+	}
+}
+
+func TestSumsRequirements(t *testing.T) {
+	requirements := readSums(t).Requirements()
+	if !requirements["github.com/pmezard/go-difflib"]["v1.0.0"] {
+		t.Error("go-difflib v1.0.0 has a zip hash, its zip is needed")
+	}
+	if withZip, ok := requirements["github.com/kr/text"]["v0.2.0"]; !ok || withZip {
+		t.Errorf("kr/text v0.2.0 = %v, %v, want listed with its go.mod only", withZip, ok)
+	}
+}
@@ -0,0 +1,93 @@
+package gradle
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ModuleExtension is the extension of Gradle module metadata files
+const ModuleExtension = ".module"
+
+// Module is the part of a Gradle module metadata file referencing other files
+type Module struct {
+	FormatVersion string    `json:"formatVersion"`
+	Component     Component `json:"component"`
+	Variants      []Variant `json:"variants"`
+}
+
+// Component identifies the module
+type Component struct {
+	Group   string `json:"group"`
+	Module  string `json:"module"`
+	Version string `json:"version"`
+}
+
+// Variant is a variant of the module, with its files or the module it is available at
+type Variant struct {
+	Name        string       `json:"name"`
+	AvailableAt *AvailableAt `json:"available-at"`
+	Files       []File       `json:"files"`
+}
+
+// AvailableAt references the module metadata holding a variant
+type AvailableAt struct {
+	URL     string `json:"url"`
+	Group   string `json:"group"`
+	Module  string `json:"module"`
+	Version string `json:"version"`
+}
+
+// File is a file of a variant. URL is relative to the module metadata file.
+type File struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Size   int64  `json:"size"`
+	SHA1   string `json:"sha1"`
+	SHA256 string `json:"sha256"`
+	SHA512 string `json:"sha512"`
+	MD5    string `json:"md5"`
+}
+
+// IsModule reports whether a file name is a Gradle module metadata file
+func IsModule(name string) bool {
+	return strings.HasSuffix(name, ModuleExtension)
+}
+
+// ParseModule parses a Gradle module metadata document
+func ParseModule(data []byte) (*Module, error) {
+	var module Module
+	if err := json.Unmarshal(data, &module); err != nil {
+		return nil, fmt.Errorf("invalid module metadata: %w", err)
+	}
+	return &module, nil
+}
+
+// FileURLs returns the URLs of the variant files, relative to the module metadata file, without duplicates
+func (m *Module) FileURLs() []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, variant := range m.Variants {
+		for _, file := range variant.Files {
+			if file.URL != "" && !seen[file.URL] {
+				seen[file.URL] = true
+				urls = append(urls, file.URL)
+			}
+		}
+	}
+	return urls
+}
+
+// AvailableAtURLs returns the URLs of the module metadata files holding variants
+// of the module, relative to it, without duplicates
+func (m *Module) AvailableAtURLs() []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, variant := range m.Variants {
+		if variant.AvailableAt != nil && variant.AvailableAt.URL != "" && !seen[variant.AvailableAt.URL] {
+			seen[variant.AvailableAt.URL] = true
+			urls = append(urls, variant.AvailableAt.URL)
+		}
+	}
+	return urls
+}
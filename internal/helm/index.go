@@ -0,0 +1,177 @@
+package helm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/caezarr-oss/refap/internal/npm"
+)
+
+// IndexFile is the name of the index of a chart repository
+const IndexFile = "index.yaml"
+
+// Index is the index.yaml of a chart repository. It keeps the YAML document to
+// write the pruned index without losing the fields it does not know about.
+type Index struct {
+	// Names are the chart names, in the order of the index
+	Names []string
+	// Entries are the versions of each chart, in the order of the index
+	Entries map[string][]*ChartVersion
+
+	root    *yaml.Node
+	entries *yaml.Node
+}
+
+// ChartVersion is an entry of the index for a version of a chart
+type ChartVersion struct {
+	Name    string   `yaml:"name"`
+	Version string   `yaml:"version"`
+	Digest  string   `yaml:"digest"`
+	URLs    []string `yaml:"urls"`
+
+	node *yaml.Node
+}
+
+// ParseIndex parses the index.yaml of a chart repository
+func ParseIndex(data []byte) (*Index, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("error parsing index: %w", err)
+	}
+	if document.Kind != yaml.DocumentNode || len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("error parsing index: not a mapping")
+	}
+
+	index := &Index{Entries: make(map[string][]*ChartVersion), root: document.Content[0]}
+	index.entries = mappingValue(index.root, "entries")
+	if index.entries == nil {
+		return index, nil
+	}
+	if index.entries.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("error parsing index: entries is not a mapping")
+	}
+
+	for i := 0; i+1 < len(index.entries.Content); i += 2 {
+		name := index.entries.Content[i].Value
+		versions := index.entries.Content[i+1]
+		if versions.Kind != yaml.SequenceNode {
+			return nil, fmt.Errorf("error parsing index: versions of %s are not a list", name)
+		}
+		for _, node := range versions.Content {
+			version := &ChartVersion{node: node}
+			if err := node.Decode(version); err != nil {
+				return nil, fmt.Errorf("error parsing index: chart %s: %w", name, err)
+			}
+			if version.Name == "" {
+				version.Name = name
+			}
+			index.Entries[name] = append(index.Entries[name], version)
+		}
+		index.Names = append(index.Names, name)
+	}
+	return index, nil
+}
+
+// Prune returns the index with the chart versions accepted by keep only, charts
+// without version being removed, and its generated date set to now
+func (i *Index) Prune(keep func(*ChartVersion) bool) ([]byte, error) {
+	if i.entries != nil {
+		var content []*yaml.Node
+		for j := 0; j+1 < len(i.entries.Content); j += 2 {
+			versions := i.entries.Content[j+1]
+			var kept []*yaml.Node
+			for _, version := range i.Entries[i.entries.Content[j].Value] {
+				if keep(version) {
+					kept = append(kept, version.node)
+				}
+			}
+			if len(kept) > 0 {
+				versions.Content = kept
+				content = append(content, i.entries.Content[j], versions)
+			}
+		}
+		i.entries.Content = content
+		i.entries.Style = 0
+	}
+	if generated := mappingValue(i.root, "generated"); generated != nil {
+		generated.Value = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(i.root); err != nil {
+		return nil, fmt.Errorf("error writing index: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("error writing index: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// SetURLs replaces the download URLs of the chart version
+func (v *ChartVersion) SetURLs(urls ...string) {
+	v.URLs = urls
+	sequence := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, u := range urls {
+		sequence.Content = append(sequence.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: u})
+	}
+	if node := mappingValue(v.node, "urls"); node != nil {
+		*node = *sequence
+		return
+	}
+	v.node.Content = append(v.node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "urls"}, sequence)
+}
+
+// Sum returns the SHA-256 sum of the chart archive, if the index provides it
+func (v *ChartVersion) Sum() ([]byte, bool) {
+	sum, err := hex.DecodeString(strings.TrimPrefix(v.Digest, "sha256:"))
+	if err != nil || len(sum) != 32 {
+		return nil, false
+	}
+	return sum, true
+}
+
+// ParseRange parses a semver range. Ranges use the npm syntax, commas being read as
+// spaces as in Helm constraints, e.g. ">=1.2.0, <2.0.0", "^1.2" or "1.2.x".
+func ParseRange(s string) (npm.Range, error) {
+	return npm.ParseRange(strings.TrimSpace(strings.ReplaceAll(s, ",", " ")))
+}
+
+// Select returns the versions within the semver range, all of them for an empty range
+func Select(versions []*ChartVersion, versionRange string, includePrerelease bool) ([]*ChartVersion, error) {
+	if strings.TrimSpace(versionRange) == "" {
+		return versions, nil
+	}
+	r, err := ParseRange(versionRange)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []*ChartVersion
+	for _, version := range versions {
+		v, err := npm.ParseVersion(strings.TrimPrefix(version.Version, "v"))
+		if err == nil && r.Contains(v, includePrerelease) {
+			selected = append(selected, version)
+		}
+	}
+	return selected, nil
+}
+
+// mappingValue returns the value of a key of a mapping node
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Options defines the HTTP client settings
+type Options struct {
+	Timeout             int // Seconds
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     int // Seconds
+	HTTP2               bool
+	TLSConfig           *tls.Config
+	ProxyEnabled        bool
+	ProxyHost           string
+	ProxyPort           int
+	ProxyUsername       string
+	ProxyPassword       string
+	MaxRedirects        int // Redirects followed by a request, DefaultMaxRedirects when 0
+}
+
+// DefaultMaxRedirects is the number of redirects followed when Options.MaxRedirects is not set
+const DefaultMaxRedirects = 10
+
+var (
+	// ErrRedirectLoop is returned when a redirect leads back to a URL of the same request
+	ErrRedirectLoop = errors.New("redirect loop")
+	// ErrTooManyRedirects is returned when a request is redirected more than MaxRedirects times
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+// Auth defines the authentication added to each request
+type Auth struct {
+	Type        string // none, basic or token
+	Username    string
+	Password    string
+	AccessToken string
+}
+
+// Apply adds the authentication headers to a request
+func (a Auth) Apply(req *http.Request) {
+	switch a.Type {
+	case "basic":
+		if a.Username != "" && a.Password != "" {
+			req.SetBasicAuth(a.Username, a.Password)
+		}
+	case "token":
+		if a.AccessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+a.AccessToken)
+		}
+	}
+}
+
+// SameOrigin reports whether two URLs have the same scheme, host and port, the
+// default port of the scheme being implied when it is missing
+func SameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(hostPort(a), hostPort(b))
+}
+
+// hostPort returns the host of a URL with its port, or the default port of its scheme
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		switch strings.ToLower(u.Scheme) {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// New creates an HTTP client meant to be shared by every request of a run.
+// Reusing a single client keeps connections alive between downloads, avoids a
+// TLS handshake per file and allows HTTP/2 multiplexing when enabled.
+func New(cfg Options) *http.Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   time.Duration(cfg.Timeout) * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     cfg.HTTP2,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       time.Duration(cfg.IdleConnTimeout) * time.Second,
+		TLSHandshakeTimeout:   time.Duration(cfg.Timeout) * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	if cfg.TLSConfig != nil {
+		transport.TLSClientConfig = cfg.TLSConfig
+	}
+
+	if !cfg.HTTP2 {
+		// A non-nil empty map disables the automatic HTTP/2 upgrade
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	// Configure proxy if enabled
+	if cfg.ProxyEnabled && cfg.ProxyHost != "" && cfg.ProxyPort > 0 {
+		proxyURL := &url.URL{
+			Scheme: "http",
+			Host:   fmt.Sprintf("%s:%d", cfg.ProxyHost, cfg.ProxyPort),
+		}
+
+		if cfg.ProxyUsername != "" && cfg.ProxyPassword != "" {
+			proxyURL.User = url.UserPassword(cfg.ProxyUsername, cfg.ProxyPassword)
+		}
+
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &http.Client{
+		Transport:     transport,
+		Timeout:       time.Duration(cfg.Timeout) * time.Second,
+		CheckRedirect: checkRedirect(cfg.MaxRedirects),
+	}
+}
+
+// checkRedirect stops a request redirected back to one of its previous URLs,
+// or redirected more than maxRedirects times
+func checkRedirect(maxRedirects int) func(req *http.Request, via []*http.Request) error {
+	if maxRedirects <= 0 {
+		maxRedirects = DefaultMaxRedirects
+	}
+	return func(req *http.Request, via []*http.Request) error {
+		for _, previous := range via {
+			if previous.URL.String() == req.URL.String() {
+				return fmt.Errorf("%w at %s", ErrRedirectLoop, req.URL)
+			}
+		}
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("%w: stopped after %d redirects", ErrTooManyRedirects, maxRedirects)
+		}
+		return nil
+	}
+}
+
+// LoadTLSConfig builds the TLS configuration used to connect to a server.
+// caFile adds a PEM bundle of trusted authorities to the system pool, and
+// certFile/keyFile configure a client certificate for mutual TLS.
+func LoadTLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+
+	if caFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA file %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,63 @@
+package httpclient
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// benchmarkFileSize is the size of the file served to the download benchmarks,
+// that of a small POM, so that the connection setup dominates as in a Maven export
+const benchmarkFileSize = 4 * 1024
+
+// newBenchmarkServer starts a TLS server and returns it with the TLS configuration
+// trusting its certificate
+func newBenchmarkServer(b *testing.B) (*httptest.Server, *tls.Config) {
+	b.Helper()
+	content := bytes.Repeat([]byte("x"), benchmarkFileSize)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	b.Cleanup(server.Close)
+	return server, server.Client().Transport.(*http.Transport).TLSClientConfig
+}
+
+func download(b *testing.B, client *http.Client, url string) {
+	resp, err := client.Get(url)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkDownload compares the shared pooled client with a client created for
+// each request, as the crawler did before, which opens a new connection and
+// performs a TLS handshake per file
+func BenchmarkDownload(b *testing.B) {
+	b.Run("shared", func(b *testing.B) {
+		server, tlsConfig := newBenchmarkServer(b)
+		client := New(Options{Timeout: 30, MaxIdleConns: 100, MaxIdleConnsPerHost: 10, IdleConnTimeout: 90, TLSConfig: tlsConfig})
+		b.SetBytes(benchmarkFileSize)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			download(b, client, server.URL)
+		}
+	})
+
+	b.Run("per-request", func(b *testing.B) {
+		server, tlsConfig := newBenchmarkServer(b)
+		b.SetBytes(benchmarkFileSize)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			transport := &http.Transport{TLSClientConfig: tlsConfig}
+			download(b, &http.Client{Transport: transport}, server.URL)
+			transport.CloseIdleConnections()
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package maven
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Coordinates identify a Maven artifact
+type Coordinates struct {
+	GroupID    string
+	ArtifactID string
+	Version    string
+	Type       string // Dependency type, jar when empty
+	Classifier string
+}
+
+// ParseCoordinates parses coordinates in the groupId:artifactId[:type[:classifier]]:version form
+func ParseCoordinates(s string) (Coordinates, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	for _, part := range parts {
+		if part == "" {
+			return Coordinates{}, fmt.Errorf("invalid coordinates %q", s)
+		}
+	}
+
+	switch len(parts) {
+	case 3:
+		return Coordinates{GroupID: parts[0], ArtifactID: parts[1], Version: parts[2]}, nil
+	case 4:
+		return Coordinates{GroupID: parts[0], ArtifactID: parts[1], Type: parts[2], Version: parts[3]}, nil
+	case 5:
+		return Coordinates{GroupID: parts[0], ArtifactID: parts[1], Type: parts[2], Classifier: parts[3], Version: parts[4]}, nil
+	default:
+		return Coordinates{}, fmt.Errorf("invalid coordinates %q, expected groupId:artifactId[:type[:classifier]]:version", s)
+	}
+}
+
+// String returns the coordinates in the groupId:artifactId[:type[:classifier]]:version form
+func (c Coordinates) String() string {
+	parts := []string{c.GroupID, c.ArtifactID}
+	if c.Type != "" || c.Classifier != "" {
+		parts = append(parts, c.typeOrDefault())
+	}
+	if c.Classifier != "" {
+		parts = append(parts, c.Classifier)
+	}
+	return strings.Join(append(parts, c.Version), ":")
+}
+
+// ManagementKey identifies the artifact regardless of its version, as in dependencyManagement
+func (c Coordinates) ManagementKey() string {
+	return c.GroupID + ":" + c.ArtifactID + ":" + c.typeOrDefault() + ":" + c.Classifier
+}
+
+// POM returns the coordinates of the POM of the artifact
+func (c Coordinates) POM() Coordinates {
+	return Coordinates{GroupID: c.GroupID, ArtifactID: c.ArtifactID, Version: c.Version, Type: "pom"}
+}
+
+// Path returns the slash separated path of the artifact in a repository
+func (c Coordinates) Path() string {
+	extension, classifier := c.typeOrDefault(), c.Classifier
+	switch extension {
+	case "test-jar":
+		extension = "jar"
+		if classifier == "" {
+			classifier = "tests"
+		}
+	case "ejb-client":
+		extension = "jar"
+		if classifier == "" {
+			classifier = "client"
+		}
+	case "bundle", "maven-plugin", "ejb", "java-source", "javadoc":
+		extension = "jar"
+	}
+
+	name := c.ArtifactID + "-" + c.Version
+	if classifier != "" {
+		name += "-" + classifier
+	}
+	return strings.ReplaceAll(c.GroupID, ".", "/") + "/" + c.ArtifactID + "/" + c.Version + "/" + name + "." + extension
+}
+
+// MetadataPath returns the path of the artifact metadata listing the versions
+func (c Coordinates) MetadataPath() string {
+	return strings.ReplaceAll(c.GroupID, ".", "/") + "/" + c.ArtifactID + "/" + MetadataName
+}
+
+func (c Coordinates) typeOrDefault() string {
+	if c.Type == "" {
+		return "jar"
+	}
+	return c.Type
+}
@@ -0,0 +1,103 @@
+package maven
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+// MetadataName is the name of the repository metadata file
+const MetadataName = "maven-metadata.xml"
+
+// lastUpdatedLayout is the timestamp format of the metadata
+const lastUpdatedLayout = "20060102150405"
+
+// Metadata is a maven-metadata.xml document, at group, artifact or version level
+type Metadata struct {
+	XMLName    xml.Name    `xml:"metadata"`
+	GroupID    string      `xml:"groupId,omitempty"`
+	ArtifactID string      `xml:"artifactId,omitempty"`
+	Version    string      `xml:"version,omitempty"` // Set in the metadata of a snapshot version
+	Versioning *Versioning `xml:"versioning,omitempty"`
+	Plugins    *Plugins    `xml:"plugins,omitempty"`
+}
+
+// Plugins lists the Maven plugins of a group
+type Plugins struct {
+	Plugin []Plugin `xml:"plugin"`
+}
+
+// Versioning lists the versions of an artifact
+type Versioning struct {
+	Latest      string   `xml:"latest,omitempty"`
+	Release     string   `xml:"release,omitempty"`
+	Versions    []string `xml:"versions>version"`
+	LastUpdated string   `xml:"lastUpdated,omitempty"`
+}
+
+// Plugin describes a Maven plugin in the metadata of its group
+type Plugin struct {
+	Name       string `xml:"name,omitempty"`
+	Prefix     string `xml:"prefix"`
+	ArtifactID string `xml:"artifactId"`
+}
+
+// ParseMetadata parses a maven-metadata.xml document
+func ParseMetadata(data []byte) (*Metadata, error) {
+	var metadata Metadata
+	if err := xml.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("invalid maven metadata: %w", err)
+	}
+	return &metadata, nil
+}
+
+// NewArtifactMetadata builds the metadata of an artifact from its versions.
+// latest is the highest version and release the highest version which is not a snapshot.
+func NewArtifactMetadata(groupID, artifactID string, versions []string, lastUpdated time.Time) *Metadata {
+	sorted := append([]string(nil), versions...)
+	SortVersions(sorted)
+
+	versioning := &Versioning{
+		Versions:    sorted,
+		LastUpdated: lastUpdated.UTC().Format(lastUpdatedLayout),
+	}
+	if len(sorted) > 0 {
+		versioning.Latest = sorted[len(sorted)-1]
+	}
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if !IsSnapshot(sorted[i]) {
+			versioning.Release = sorted[i]
+			break
+		}
+	}
+
+	return &Metadata{
+		GroupID:    groupID,
+		ArtifactID: artifactID,
+		Versioning: versioning,
+	}
+}
+
+// Marshal returns the XML document of the metadata
+func (m *Metadata) Marshal() ([]byte, error) {
+	data, err := xml.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.Write(data)
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// Checksums returns the content of the .sha1 and .md5 files of data
+func Checksums(data []byte) (sha1Sum, md5Sum string) {
+	s := sha1.Sum(data)
+	m := md5.Sum(data)
+	return hex.EncodeToString(s[:]), hex.EncodeToString(m[:])
+}
@@ -0,0 +1,308 @@
+package maven
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxInheritanceDepth bounds the parent and import chains to detect cycles
+const maxInheritanceDepth = 32
+
+// propertyPattern matches ${property} references
+var propertyPattern = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// POM is the part of a project object model used to resolve dependencies
+type POM struct {
+	GroupID              string       `xml:"groupId"`
+	ArtifactID           string       `xml:"artifactId"`
+	Version              string       `xml:"version"`
+	Packaging            string       `xml:"packaging"`
+	Parent               *Parent      `xml:"parent"`
+	Properties           Properties   `xml:"properties"`
+	DependencyManagement []Dependency `xml:"dependencyManagement>dependencies>dependency"`
+	Dependencies         []Dependency `xml:"dependencies>dependency"`
+}
+
+// Parent references the parent POM of a project
+type Parent struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+	Version    string `xml:"version"`
+}
+
+// Dependency is a dependency or a managed dependency of a project
+type Dependency struct {
+	GroupID    string      `xml:"groupId"`
+	ArtifactID string      `xml:"artifactId"`
+	Version    string      `xml:"version"`
+	Type       string      `xml:"type"`
+	Classifier string      `xml:"classifier"`
+	Scope      string      `xml:"scope"`
+	Optional   string      `xml:"optional"`
+	Exclusions []Exclusion `xml:"exclusions>exclusion"`
+}
+
+// Exclusion removes a transitive dependency, * matching any group or artifact
+type Exclusion struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+}
+
+// Properties holds the properties of a project by name
+type Properties map[string]string
+
+// UnmarshalXML reads the free form <properties> element
+func (p *Properties) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	*p = Properties{}
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			var value string
+			if err := d.DecodeElement(&value, &t); err != nil {
+				return err
+			}
+			(*p)[t.Name.Local] = strings.TrimSpace(value)
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// Coordinates returns the coordinates of the dependency
+func (d Dependency) Coordinates() Coordinates {
+	return Coordinates{GroupID: d.GroupID, ArtifactID: d.ArtifactID, Version: d.Version, Type: d.Type, Classifier: d.Classifier}
+}
+
+// IsOptional reports whether the dependency is optional
+func (d Dependency) IsOptional() bool {
+	return strings.TrimSpace(d.Optional) == "true"
+}
+
+// Excludes reports whether the exclusion matches the coordinates
+func (e Exclusion) Excludes(c Coordinates) bool {
+	return (e.GroupID == "*" || e.GroupID == c.GroupID) && (e.ArtifactID == "*" || e.ArtifactID == c.ArtifactID)
+}
+
+// ParsePOM parses a pom.xml document
+func ParsePOM(data []byte) (*POM, error) {
+	var pom POM
+	if err := xml.Unmarshal(data, &pom); err != nil {
+		return nil, fmt.Errorf("invalid pom: %w", err)
+	}
+	return &pom, nil
+}
+
+// POMLoader returns the POM of the given coordinates
+type POMLoader func(coordinates Coordinates) (*POM, error)
+
+// Model is the effective model of a project: inheritance from the parents is
+// applied, properties are interpolated, BOMs are imported and the dependency
+// management is applied to the dependencies
+type Model struct {
+	Coordinates  Coordinates
+	Packaging    string
+	Properties   Properties
+	Managed      map[string]Dependency // By management key
+	Dependencies []Dependency
+}
+
+// BuildModel builds the effective model of a POM, loading its parents and the BOMs it imports
+func BuildModel(pom *POM, load POMLoader) (*Model, error) {
+	return buildModel(pom, load, 0)
+}
+
+// inheritance is a POM merged with its parents, whose values are not interpolated yet
+type inheritance struct {
+	coordinates  Coordinates
+	parent       *Parent
+	properties   Properties
+	managed      []Dependency
+	dependencies []Dependency
+}
+
+// inherit merges a POM with its parents. As with Maven, the values are inherited
+// as written, so that the properties of the project apply to the inherited
+// dependencies and dependency management when the model is interpolated.
+func inherit(pom *POM, load POMLoader, depth int) (*inheritance, error) {
+	if depth > maxInheritanceDepth {
+		return nil, fmt.Errorf("parent or import chain of %s:%s is too deep", pom.GroupID, pom.ArtifactID)
+	}
+
+	merged := &inheritance{
+		coordinates: Coordinates{GroupID: pom.GroupID, ArtifactID: pom.ArtifactID, Version: pom.Version},
+		parent:      pom.Parent,
+		properties:  Properties{},
+	}
+
+	if pom.Parent != nil {
+		parentCoordinates := Coordinates{GroupID: pom.Parent.GroupID, ArtifactID: pom.Parent.ArtifactID, Version: pom.Parent.Version, Type: "pom"}
+		parentPOM, err := load(parentCoordinates)
+		if err != nil {
+			return nil, fmt.Errorf("parent %s: %w", parentCoordinates, err)
+		}
+		parent, err := inherit(parentPOM, load, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		if merged.coordinates.GroupID == "" {
+			merged.coordinates.GroupID = pom.Parent.GroupID
+		}
+		if merged.coordinates.Version == "" {
+			merged.coordinates.Version = pom.Parent.Version
+		}
+		for name, value := range parent.properties {
+			merged.properties[name] = value
+		}
+		merged.managed = parent.managed
+		merged.dependencies = parent.dependencies
+	}
+
+	// The properties, dependency management and dependencies of the project
+	// override the inherited ones
+	for name, value := range pom.Properties {
+		merged.properties[name] = value
+	}
+	merged.managed = overrideDependencies(merged.managed, pom.DependencyManagement)
+	merged.dependencies = overrideDependencies(merged.dependencies, pom.Dependencies)
+	return merged, nil
+}
+
+// overrideDependencies returns the inherited dependencies, replaced by the dependencies
+// of the project with the same management key, followed by the other ones
+func overrideDependencies(inherited, project []Dependency) []Dependency {
+	merged := append([]Dependency(nil), inherited...)
+	for _, dependency := range project {
+		key := dependency.Coordinates().ManagementKey()
+		replaced := false
+		for i := range merged {
+			if merged[i].Coordinates().ManagementKey() == key {
+				merged[i] = dependency
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged = append(merged, dependency)
+		}
+	}
+	return merged
+}
+
+func buildModel(pom *POM, load POMLoader, depth int) (*Model, error) {
+	merged, err := inherit(pom, load, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	model := &Model{
+		Coordinates: merged.coordinates,
+		Packaging:   pom.Packaging,
+		Properties:  merged.properties,
+		Managed:     make(map[string]Dependency),
+	}
+	if model.Packaging == "" {
+		model.Packaging = "jar"
+	}
+
+	// The whole model is interpolated once, against the properties of the project
+	if merged.parent != nil {
+		model.Properties["project.parent.groupId"] = merged.parent.GroupID
+		model.Properties["project.parent.version"] = merged.parent.Version
+	}
+	for _, prefix := range []string{"project.", "pom.", ""} {
+		model.Properties[prefix+"groupId"] = model.Coordinates.GroupID
+		model.Properties[prefix+"artifactId"] = model.Coordinates.ArtifactID
+		model.Properties[prefix+"version"] = model.Coordinates.Version
+	}
+	model.Coordinates.GroupID = model.interpolate(model.Coordinates.GroupID)
+	model.Coordinates.Version = model.interpolate(model.Coordinates.Version)
+
+	var imports []Dependency
+	for _, dependency := range merged.managed {
+		dependency = model.interpolateDependency(dependency)
+		if dependency.Scope == "import" && dependency.Type == "pom" {
+			imports = append(imports, dependency)
+			continue
+		}
+		model.Managed[dependency.Coordinates().ManagementKey()] = dependency
+	}
+
+	// Import the dependency management of the BOMs, without overriding the project
+	for _, bom := range imports {
+		bomPOM, err := load(bom.Coordinates())
+		if err != nil {
+			return nil, fmt.Errorf("imported %s: %w", bom.Coordinates(), err)
+		}
+		bomModel, err := buildModel(bomPOM, load, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		for key, dependency := range bomModel.Managed {
+			if _, ok := model.Managed[key]; !ok {
+				model.Managed[key] = dependency
+			}
+		}
+	}
+
+	for _, dependency := range merged.dependencies {
+		model.Dependencies = append(model.Dependencies, model.interpolateDependency(dependency))
+	}
+
+	// Apply the dependency management
+	for i, dependency := range model.Dependencies {
+		managed, ok := model.Managed[dependency.Coordinates().ManagementKey()]
+		if ok {
+			if dependency.Version == "" {
+				dependency.Version = managed.Version
+			}
+			if dependency.Scope == "" {
+				dependency.Scope = managed.Scope
+			}
+			dependency.Exclusions = append(dependency.Exclusions, managed.Exclusions...)
+		}
+		if dependency.Scope == "" {
+			dependency.Scope = "compile"
+		}
+		model.Dependencies[i] = dependency
+	}
+
+	return model, nil
+}
+
+// interpolateDependency replaces the property references of a dependency
+func (m *Model) interpolateDependency(d Dependency) Dependency {
+	d.GroupID = m.interpolate(d.GroupID)
+	d.ArtifactID = m.interpolate(d.ArtifactID)
+	d.Version = m.interpolate(d.Version)
+	d.Type = m.interpolate(d.Type)
+	d.Classifier = m.interpolate(d.Classifier)
+	d.Scope = m.interpolate(d.Scope)
+	d.Optional = m.interpolate(d.Optional)
+	return d
+}
+
+// interpolate replaces the ${property} references of a value. Unknown
+// properties are left as is.
+func (m *Model) interpolate(value string) string {
+	value = strings.TrimSpace(value)
+	// Properties may reference other properties
+	for i := 0; i < 10 && strings.Contains(value, "${"); i++ {
+		replaced := propertyPattern.ReplaceAllStringFunc(value, func(ref string) string {
+			if resolved, ok := m.Properties[ref[2:len(ref)-1]]; ok {
+				return resolved
+			}
+			return ref
+		})
+		if replaced == value {
+			break
+		}
+		value = replaced
+	}
+	return value
+}
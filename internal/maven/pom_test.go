@@ -0,0 +1,192 @@
+package maven
+
+import (
+	"fmt"
+	"testing"
+)
+
+// testLoader loads POMs from their XML by groupId:artifactId:version
+func testLoader(poms map[string]string) POMLoader {
+	return func(c Coordinates) (*POM, error) {
+		data, ok := poms[c.GroupID+":"+c.ArtifactID+":"+c.Version]
+		if !ok {
+			return nil, fmt.Errorf("%s not found", c)
+		}
+		return ParsePOM([]byte(data))
+	}
+}
+
+func buildTestModel(t *testing.T, child string, poms map[string]string) *Model {
+	t.Helper()
+	pom, err := ParsePOM([]byte(child))
+	if err != nil {
+		t.Fatal(err)
+	}
+	model, err := BuildModel(pom, testLoader(poms))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model
+}
+
+func findDependency(t *testing.T, model *Model, artifactID string) Dependency {
+	t.Helper()
+	for _, dependency := range model.Dependencies {
+		if dependency.ArtifactID == artifactID {
+			return dependency
+		}
+	}
+	t.Fatalf("dependency %s not found in %+v", artifactID, model.Dependencies)
+	return Dependency{}
+}
+
+const parentPOM = `<project>
+  <groupId>org.acme</groupId>
+  <artifactId>parent</artifactId>
+  <version>1.0</version>
+  <packaging>pom</packaging>
+  <properties>
+    <jackson.version>2.15.0</jackson.version>
+  </properties>
+  <dependencyManagement>
+    <dependencies>
+      <dependency>
+        <groupId>com.fasterxml.jackson.core</groupId>
+        <artifactId>jackson-databind</artifactId>
+        <version>${jackson.version}</version>
+      </dependency>
+    </dependencies>
+  </dependencyManagement>
+  <dependencies>
+    <dependency>
+      <groupId>org.acme</groupId>
+      <artifactId>acme-api</artifactId>
+      <version>${project.version}</version>
+    </dependency>
+  </dependencies>
+</project>`
+
+func TestBuildModelInterpolatesInheritedValuesWithChildProperties(t *testing.T) {
+	child := `<project>
+  <parent>
+    <groupId>org.acme</groupId>
+    <artifactId>parent</artifactId>
+    <version>1.0</version>
+  </parent>
+  <artifactId>app</artifactId>
+  <version>2.3</version>
+  <properties>
+    <jackson.version>2.17.1</jackson.version>
+  </properties>
+  <dependencies>
+    <dependency>
+      <groupId>com.fasterxml.jackson.core</groupId>
+      <artifactId>jackson-databind</artifactId>
+    </dependency>
+  </dependencies>
+</project>`
+
+	model := buildTestModel(t, child, map[string]string{"org.acme:parent:1.0": parentPOM})
+
+	if got := findDependency(t, model, "jackson-databind").Version; got != "2.17.1" {
+		t.Errorf("managed jackson-databind version = %s, want the child property 2.17.1", got)
+	}
+	if got := findDependency(t, model, "acme-api").Version; got != "2.3" {
+		t.Errorf("inherited acme-api version = %s, want the child version 2.3", got)
+	}
+	if model.Coordinates.GroupID != "org.acme" || model.Coordinates.Version != "2.3" {
+		t.Errorf("coordinates = %s, want org.acme:app:2.3", model.Coordinates)
+	}
+}
+
+func TestBuildModelKeepsParentValuesWithoutOverride(t *testing.T) {
+	child := `<project>
+  <parent>
+    <groupId>org.acme</groupId>
+    <artifactId>parent</artifactId>
+    <version>1.0</version>
+  </parent>
+  <artifactId>app</artifactId>
+  <dependencies>
+    <dependency>
+      <groupId>com.fasterxml.jackson.core</groupId>
+      <artifactId>jackson-databind</artifactId>
+    </dependency>
+  </dependencies>
+</project>`
+
+	model := buildTestModel(t, child, map[string]string{"org.acme:parent:1.0": parentPOM})
+
+	if got := findDependency(t, model, "jackson-databind").Version; got != "2.15.0" {
+		t.Errorf("managed jackson-databind version = %s, want the parent property 2.15.0", got)
+	}
+	// The version of the child is inherited from the parent
+	if got := findDependency(t, model, "acme-api").Version; got != "1.0" {
+		t.Errorf("inherited acme-api version = %s, want 1.0", got)
+	}
+}
+
+func TestBuildModelImportsInheritedBOM(t *testing.T) {
+	parent := `<project>
+  <groupId>org.acme</groupId>
+  <artifactId>parent</artifactId>
+  <version>1.0</version>
+  <properties>
+    <bom.version>1.0</bom.version>
+  </properties>
+  <dependencyManagement>
+    <dependencies>
+      <dependency>
+        <groupId>org.acme</groupId>
+        <artifactId>bom</artifactId>
+        <version>${bom.version}</version>
+        <type>pom</type>
+        <scope>import</scope>
+      </dependency>
+    </dependencies>
+  </dependencyManagement>
+</project>`
+	bom := func(version string) string {
+		return `<project>
+  <groupId>org.acme</groupId>
+  <artifactId>bom</artifactId>
+  <version>` + version + `</version>
+  <dependencyManagement>
+    <dependencies>
+      <dependency>
+        <groupId>org.acme</groupId>
+        <artifactId>lib</artifactId>
+        <version>` + version + `.5</version>
+      </dependency>
+    </dependencies>
+  </dependencyManagement>
+</project>`
+	}
+	child := `<project>
+  <parent>
+    <groupId>org.acme</groupId>
+    <artifactId>parent</artifactId>
+    <version>1.0</version>
+  </parent>
+  <artifactId>app</artifactId>
+  <properties>
+    <bom.version>2.0</bom.version>
+  </properties>
+  <dependencies>
+    <dependency>
+      <groupId>org.acme</groupId>
+      <artifactId>lib</artifactId>
+    </dependency>
+  </dependencies>
+</project>`
+
+	model := buildTestModel(t, child, map[string]string{
+		"org.acme:parent:1.0": parent,
+		"org.acme:bom:1.0":    bom("1.0"),
+		"org.acme:bom:2.0":    bom("2.0"),
+	})
+
+	if got := findDependency(t, model, "lib").Version; got != "2.0.5" {
+		t.Errorf("lib version = %s, want 2.0.5 from the BOM selected by the child property", got)
+	}
+}
@@ -0,0 +1,151 @@
+package maven
+
+import (
+	"math/big"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// qualifierOrder ranks the well known version qualifiers, a release having an empty qualifier
+var qualifierOrder = map[string]int{
+	"alpha":     0,
+	"a":         0,
+	"beta":      1,
+	"b":         1,
+	"milestone": 2,
+	"m":         2,
+	"rc":        3,
+	"cr":        3,
+	"snapshot":  4,
+	"":          5,
+	"ga":        5,
+	"final":     5,
+	"release":   5,
+	"sp":        6,
+}
+
+// versionItem is a numeric or qualifier part of a version
+type versionItem struct {
+	number    *big.Int // Set for numeric items
+	qualifier string
+}
+
+// IsSnapshot reports whether a version is a snapshot
+func IsSnapshot(version string) bool {
+	return strings.HasSuffix(version, "-SNAPSHOT")
+}
+
+// CompareVersions compares two versions the way Maven orders them, returning
+// -1, 0 or 1. Numeric parts are compared as numbers and qualifiers follow the
+// order alpha < beta < milestone < rc < snapshot < release < sp, other
+// qualifiers sorting after them alphabetically.
+func CompareVersions(a, b string) int {
+	itemsA, itemsB := parseVersion(a), parseVersion(b)
+	for i := 0; i < len(itemsA) || i < len(itemsB); i++ {
+		var itemA, itemB versionItem
+		if i < len(itemsA) {
+			itemA = itemsA[i]
+		} else {
+			itemA = padding(itemsB[i])
+		}
+		if i < len(itemsB) {
+			itemB = itemsB[i]
+		} else {
+			itemB = padding(itemsA[i])
+		}
+		if c := compareItems(itemA, itemB); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// SortVersions sorts versions in ascending Maven order
+func SortVersions(versions []string) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		return CompareVersions(versions[i], versions[j]) < 0
+	})
+}
+
+// parseVersion splits a version into items on dots, dashes and transitions between digits and letters
+func parseVersion(version string) []versionItem {
+	var items []versionItem
+	var current strings.Builder
+	digits := false
+
+	flush := func() {
+		if current.Len() == 0 {
+			return
+		}
+		token := current.String()
+		current.Reset()
+		if digits {
+			number, _ := new(big.Int).SetString(token, 10)
+			items = append(items, versionItem{number: number})
+			return
+		}
+		items = append(items, versionItem{qualifier: strings.ToLower(token)})
+	}
+
+	for _, r := range version {
+		if r == '.' || r == '-' || r == '_' {
+			flush()
+			continue
+		}
+		isDigit := unicode.IsDigit(r)
+		if current.Len() > 0 && isDigit != digits {
+			flush()
+		}
+		digits = isDigit
+		current.WriteRune(r)
+	}
+	flush()
+
+	return items
+}
+
+// padding returns the item compared with item when the other version is shorter
+func padding(item versionItem) versionItem {
+	if item.number != nil {
+		return versionItem{number: new(big.Int)}
+	}
+	return versionItem{}
+}
+
+// compareItems compares two version items, numbers being greater than qualifiers
+func compareItems(a, b versionItem) int {
+	switch {
+	case a.number != nil && b.number != nil:
+		return a.number.Cmp(b.number)
+	case a.number != nil:
+		return 1
+	case b.number != nil:
+		return -1
+	}
+
+	rankA, knownA := qualifierOrder[a.qualifier]
+	rankB, knownB := qualifierOrder[b.qualifier]
+	switch {
+	case knownA && knownB:
+		return compareInts(rankA, rankB)
+	case knownA:
+		return -1
+	case knownB:
+		return 1
+	default:
+		return strings.Compare(a.qualifier, b.qualifier)
+	}
+}
+
+// compareInts returns -1, 0 or 1
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
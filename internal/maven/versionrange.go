@@ -0,0 +1,95 @@
+package maven
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VersionRange is a union of version intervals such as [1.0,2.0) or [1.0,1.2),[1.5,)
+type VersionRange struct {
+	intervals []interval
+}
+
+// interval is a bounded or unbounded version interval, empty bounds being unbounded
+type interval struct {
+	lower, upper                   string
+	lowerInclusive, upperInclusive bool
+}
+
+// IsVersionRange reports whether a dependency version is a range
+func IsVersionRange(version string) bool {
+	return strings.HasPrefix(version, "[") || strings.HasPrefix(version, "(")
+}
+
+// ParseVersionRange parses a version range specification
+func ParseVersionRange(spec string) (VersionRange, error) {
+	var r VersionRange
+	rest := strings.TrimSpace(spec)
+	for rest != "" {
+		if rest[0] != '[' && rest[0] != '(' {
+			return VersionRange{}, fmt.Errorf("invalid version range %q", spec)
+		}
+		end := strings.IndexAny(rest, "])")
+		if end < 0 {
+			return VersionRange{}, fmt.Errorf("invalid version range %q", spec)
+		}
+
+		bounds := rest[1:end]
+		iv := interval{lowerInclusive: rest[0] == '[', upperInclusive: rest[end] == ']'}
+		if lower, upper, ok := strings.Cut(bounds, ","); ok {
+			iv.lower, iv.upper = strings.TrimSpace(lower), strings.TrimSpace(upper)
+		} else {
+			// [1.0] is an exact version
+			if !iv.lowerInclusive || !iv.upperInclusive {
+				return VersionRange{}, fmt.Errorf("invalid version range %q", spec)
+			}
+			iv.lower, iv.upper = strings.TrimSpace(bounds), strings.TrimSpace(bounds)
+		}
+		r.intervals = append(r.intervals, iv)
+
+		rest = strings.TrimPrefix(strings.TrimSpace(rest[end+1:]), ",")
+		rest = strings.TrimSpace(rest)
+	}
+
+	if len(r.intervals) == 0 {
+		return VersionRange{}, fmt.Errorf("invalid version range %q", spec)
+	}
+	return r, nil
+}
+
+// Contains reports whether a version is in the range
+func (r VersionRange) Contains(version string) bool {
+	for _, iv := range r.intervals {
+		if iv.contains(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// Highest returns the highest version of the list in the range
+func (r VersionRange) Highest(versions []string) (string, bool) {
+	best := ""
+	for _, version := range versions {
+		if r.Contains(version) && (best == "" || CompareVersions(version, best) > 0) {
+			best = version
+		}
+	}
+	return best, best != ""
+}
+
+func (iv interval) contains(version string) bool {
+	if iv.lower != "" {
+		c := CompareVersions(version, iv.lower)
+		if c < 0 || (c == 0 && !iv.lowerInclusive) {
+			return false
+		}
+	}
+	if iv.upper != "" {
+		c := CompareVersions(version, iv.upper)
+		if c > 0 || (c == 0 && !iv.upperInclusive) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,210 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds in seconds of the request latency histograms
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Registry holds the metrics of a run and writes them in the Prometheus text format.
+// Metrics may be updated and read concurrently.
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+}
+
+// family is a metric with its samples, one per combination of label values
+type family struct {
+	name    string
+	help    string
+	kind    string // counter, gauge or histogram
+	labels  []string
+	buckets []float64
+	samples map[string]*sample
+}
+
+// sample is the value of a metric for some label values
+type sample struct {
+	labelValues []string
+	value       float64
+	counts      []uint64 // Observations below each bucket of a histogram
+	count       uint64
+}
+
+// Vec is a counter or a gauge with labels
+type Vec struct {
+	r *Registry
+	f *family
+}
+
+// HistogramVec is a histogram with labels
+type HistogramVec struct {
+	r *Registry
+	f *family
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Counter registers a counter, whose values only grow
+func (r *Registry) Counter(name, help string, labels ...string) *Vec {
+	return &Vec{r: r, f: r.register(name, help, "counter", labels, nil)}
+}
+
+// Gauge registers a gauge, whose values may go up and down
+func (r *Registry) Gauge(name, help string, labels ...string) *Vec {
+	return &Vec{r: r, f: r.register(name, help, "gauge", labels, nil)}
+}
+
+// Histogram registers a histogram counting the observations below each bucket bound
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &HistogramVec{r: r, f: r.register(name, help, "histogram", labels, buckets)}
+}
+
+func (r *Registry) register(name, help, kind string, labels []string, buckets []float64) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := &family{name: name, help: help, kind: kind, labels: labels, buckets: buckets, samples: make(map[string]*sample)}
+	if len(labels) == 0 {
+		// A metric without labels has a single sample, exposed from the start
+		f.sample(nil)
+	}
+	r.families = append(r.families, f)
+	return f
+}
+
+// Add adds a value to the sample of the label values
+func (v *Vec) Add(value float64, labelValues ...string) {
+	v.r.mu.Lock()
+	defer v.r.mu.Unlock()
+	v.f.sample(labelValues).value += value
+}
+
+// Set sets the value of the sample of the label values
+func (v *Vec) Set(value float64, labelValues ...string) {
+	v.r.mu.Lock()
+	defer v.r.mu.Unlock()
+	v.f.sample(labelValues).value = value
+}
+
+// Observe records an observation in the sample of the label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.r.mu.Lock()
+	defer h.r.mu.Unlock()
+	s := h.f.sample(labelValues)
+	for i, bound := range h.f.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += value
+}
+
+// sample returns the sample of the label values, created on first use
+func (f *family) sample(labelValues []string) *sample {
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.samples[key]
+	if !ok {
+		s = &sample{labelValues: append([]string(nil), labelValues...), counts: make([]uint64, len(f.buckets))}
+		f.samples[key] = s
+	}
+	return s
+}
+
+// Write writes the metrics in the Prometheus text exposition format
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b strings.Builder
+	for _, f := range r.families {
+		fmt.Fprintf(&b, "# HELP %s %s\n", f.name, f.help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", f.name, f.kind)
+
+		keys := make([]string, 0, len(f.samples))
+		for key := range f.samples {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.samples[key]
+			if f.kind != "histogram" {
+				fmt.Fprintf(&b, "%s%s %s\n", f.name, labelPairs(f.labels, s.labelValues, ""), formatValue(s.value))
+				continue
+			}
+			for i, bound := range f.buckets {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, labelPairs(f.labels, s.labelValues, formatValue(bound)), s.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, labelPairs(f.labels, s.labelValues, "+Inf"), s.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", f.name, labelPairs(f.labels, s.labelValues, ""), formatValue(s.value))
+			fmt.Fprintf(&b, "%s_count%s %d\n", f.name, labelPairs(f.labels, s.labelValues, ""), s.count)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// labelPairs formats the labels of a sample, with the le label of a histogram bucket when set
+func labelPairs(names, values []string, le string) string {
+	var pairs []string
+	for i, name := range names {
+		var value string
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs = append(pairs, name+"="+escapeLabel(value))
+	}
+	if le != "" {
+		pairs = append(pairs, "le="+escapeLabel(le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escapeLabel quotes a label value, escaping backslashes, quotes and newlines
+func escapeLabel(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return `"` + value + `"`
+}
+
+// formatValue formats a sample value as Prometheus does
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Handler returns the HTTP handler serving the metrics
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// Serve listens on addr, e.g. "127.0.0.1:9464", and serves the metrics at /metrics
+// until the returned server is closed
+func Serve(addr string, r *Registry) (*http.Server, net.Addr, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", r.Handler())
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	return server, listener.Addr(), nil
+}
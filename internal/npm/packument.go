@@ -0,0 +1,262 @@
+package npm
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Packument is the metadata document of a package served by a registry.
+// Fields not used by the export are kept as found on the registry.
+type Packument struct {
+	Name     string
+	DistTags map[string]string
+	Versions map[string]Manifest
+
+	raw map[string]json.RawMessage
+}
+
+// Manifest is the part of the metadata of a package version used by the export
+type Manifest struct {
+	Version string `json:"version"`
+	Dist    Dist   `json:"dist"`
+}
+
+// Dist describes the tarball of a package version
+type Dist struct {
+	Tarball   string `json:"tarball"`
+	Shasum    string `json:"shasum"`
+	Integrity string `json:"integrity"`
+}
+
+// Digest is a checksum expected for a tarball
+type Digest struct {
+	Algorithm string // sha1, sha256 or sha512
+	Sum       []byte
+}
+
+// ParsePackument parses a package metadata document
+func ParsePackument(data []byte) (*Packument, error) {
+	p := &Packument{}
+	if err := json.Unmarshal(data, &p.raw); err != nil {
+		return nil, fmt.Errorf("invalid package metadata: %w", err)
+	}
+
+	fields := []struct {
+		name  string
+		value any
+	}{
+		{"name", &p.Name},
+		{"dist-tags", &p.DistTags},
+		{"versions", &p.Versions},
+	}
+	for _, field := range fields {
+		if raw, ok := p.raw[field.name]; ok {
+			if err := json.Unmarshal(raw, field.value); err != nil {
+				return nil, fmt.Errorf("invalid package metadata %s: %w", field.name, err)
+			}
+		}
+	}
+	return p, nil
+}
+
+// Prune returns the metadata document listing only the given versions, with
+// their tarball URLs replaced by tarballURL(version). Dist tags pointing to
+// removed versions are dropped, and latest is moved to the highest release kept.
+func (p *Packument) Prune(versions []string, tarballURL func(version string) string) ([]byte, error) {
+	kept := make(map[string]bool, len(versions))
+	for _, version := range versions {
+		kept[version] = true
+	}
+
+	doc := make(map[string]json.RawMessage, len(p.raw))
+	for name, value := range p.raw {
+		doc[name] = value
+	}
+
+	// Versions, with the tarball URLs of the export
+	var rawVersions map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(p.raw["versions"], &rawVersions); err != nil {
+		return nil, fmt.Errorf("invalid package metadata versions: %w", err)
+	}
+	prunedVersions := make(map[string]map[string]json.RawMessage, len(versions))
+	for version, manifest := range rawVersions {
+		if !kept[version] {
+			continue
+		}
+		var dist map[string]json.RawMessage
+		if err := json.Unmarshal(manifest["dist"], &dist); err != nil {
+			return nil, fmt.Errorf("invalid dist of version %s: %w", version, err)
+		}
+		tarball, _ := json.Marshal(tarballURL(version))
+		dist["tarball"] = tarball
+		manifest["dist"], _ = json.Marshal(dist)
+		prunedVersions[version] = manifest
+	}
+
+	// Dist tags
+	distTags := make(map[string]string)
+	for tag, version := range p.DistTags {
+		if kept[version] {
+			distTags[tag] = version
+		}
+	}
+	if _, ok := distTags["latest"]; !ok {
+		if latest, ok := Highest(versions, false); ok {
+			distTags["latest"] = latest
+		}
+	}
+
+	// Publication times
+	if rawTime, ok := p.raw["time"]; ok {
+		var times map[string]json.RawMessage
+		if err := json.Unmarshal(rawTime, &times); err == nil {
+			for version := range times {
+				if version != "created" && version != "modified" && !kept[version] {
+					delete(times, version)
+				}
+			}
+			doc["time"], _ = json.Marshal(times)
+		}
+	}
+
+	var err error
+	if doc["versions"], err = json.Marshal(prunedVersions); err != nil {
+		return nil, err
+	}
+	if doc["dist-tags"], err = json.Marshal(distTags); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// Select returns the versions of the package matching the range, sorted from
+// the lowest to the highest. With latestOnly, only the highest one is returned,
+// or the latest dist tag when the range is empty.
+func (p *Packument) Select(versionRange string, includePrerelease, latestOnly bool) ([]string, error) {
+	r, err := ParseRange(versionRange)
+	if err != nil {
+		return nil, err
+	}
+
+	if latestOnly && strings.TrimSpace(versionRange) == "" {
+		if latest, ok := p.DistTags["latest"]; ok {
+			if _, ok := p.Versions[latest]; ok {
+				return []string{latest}, nil
+			}
+		}
+	}
+
+	var selected []string
+	for version := range p.Versions {
+		v, err := ParseVersion(version)
+		if err != nil {
+			continue
+		}
+		if r.Contains(v, includePrerelease) {
+			selected = append(selected, version)
+		}
+	}
+	sortVersions(selected)
+
+	if latestOnly && len(selected) > 0 {
+		return selected[len(selected)-1:], nil
+	}
+	return selected, nil
+}
+
+// Highest returns the highest version of the list, prereleases being ignored unless includePrerelease is set
+func Highest(versions []string, includePrerelease bool) (string, bool) {
+	var best string
+	var bestVersion Version
+	for _, version := range versions {
+		v, err := ParseVersion(version)
+		if err != nil || (v.IsPrerelease() && !includePrerelease) {
+			continue
+		}
+		if best == "" || v.Compare(bestVersion) > 0 {
+			best, bestVersion = version, v
+		}
+	}
+	return best, best != ""
+}
+
+// sortVersions sorts valid versions in ascending order
+func sortVersions(versions []string) {
+	sort.Slice(versions, func(i, j int) bool {
+		a, _ := ParseVersion(versions[i])
+		b, _ := ParseVersion(versions[j])
+		return a.Compare(b) < 0
+	})
+}
+
+// Digest returns the strongest digest of the tarball, from the integrity
+// field or the legacy sha1 shasum
+func (d Dist) Digest() (Digest, bool) {
+	var best Digest
+	rank := map[string]int{"sha1": 1, "sha256": 2, "sha512": 3}
+
+	// Integrity is a list of Subresource Integrity hashes such as sha512-<base64>
+	for _, value := range strings.Fields(d.Integrity) {
+		algorithm, encoded, ok := strings.Cut(value, "-")
+		if !ok || rank[algorithm] == 0 || rank[algorithm] <= rank[best.Algorithm] {
+			continue
+		}
+		encoded, _, _ = strings.Cut(encoded, "?")
+		sum, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+		best = Digest{Algorithm: algorithm, Sum: sum}
+	}
+
+	if best.Algorithm == "" && d.Shasum != "" {
+		if sum, err := hex.DecodeString(d.Shasum); err == nil {
+			best = Digest{Algorithm: "sha1", Sum: sum}
+		}
+	}
+	return best, best.Algorithm != ""
+}
+
+// NewHash returns the hash computing the digest
+func (d Digest) NewHash() hash.Hash {
+	switch d.Algorithm {
+	case "sha512":
+		return sha512.New()
+	case "sha256":
+		return sha256.New()
+	default:
+		return sha1.New()
+	}
+}
+
+// String returns the digest in the Subresource Integrity form
+func (d Digest) String() string {
+	return d.Algorithm + "-" + base64.StdEncoding.EncodeToString(d.Sum)
+}
+
+// ParseSpec splits a package specification such as @scope/name@^1.0.0 into its name and version range
+func ParseSpec(spec string) (name, versionRange string) {
+	spec = strings.TrimSpace(spec)
+	// The @ of a scope is not a version separator
+	if i := strings.LastIndex(spec, "@"); i > 0 {
+		return spec[:i], spec[i+1:]
+	}
+	return spec, ""
+}
+
+// EscapeName escapes a package name for a registry URL, @scope/name becoming @scope%2fname
+func EscapeName(name string) string {
+	if scope, pkg, ok := strings.Cut(name, "/"); ok && strings.HasPrefix(scope, "@") {
+		return scope + "%2f" + url.PathEscape(pkg)
+	}
+	return url.PathEscape(name)
+}
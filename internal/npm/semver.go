@@ -0,0 +1,353 @@
+package npm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version as used by npm
+type Version struct {
+	Major, Minor, Patch int64
+	Prerelease          []string
+}
+
+// ParseVersion parses a version such as 1.2.3, 1.2.3-beta.1 or v1.2.3+build
+func ParseVersion(s string) (Version, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	s, _, _ = strings.Cut(s, "+")
+
+	var v Version
+	core, prerelease, hasPrerelease := strings.Cut(s, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return Version{}, fmt.Errorf("invalid version %q", s)
+	}
+	for i, target := range []*int64{&v.Major, &v.Minor, &v.Patch} {
+		n, err := strconv.ParseInt(parts[i], 10, 64)
+		if err != nil || n < 0 {
+			return Version{}, fmt.Errorf("invalid version %q", s)
+		}
+		*target = n
+	}
+	if hasPrerelease {
+		if prerelease == "" {
+			return Version{}, fmt.Errorf("invalid version %q", s)
+		}
+		v.Prerelease = strings.Split(prerelease, ".")
+	}
+	return v, nil
+}
+
+// IsPrerelease reports whether the version is a prerelease
+func (v Version) IsPrerelease() bool {
+	return len(v.Prerelease) > 0
+}
+
+// Compare returns -1, 0 or 1 when v is lower than, equal to or greater than other
+func (v Version) Compare(other Version) int {
+	for _, c := range [][2]int64{{v.Major, other.Major}, {v.Minor, other.Minor}, {v.Patch, other.Patch}} {
+		if c[0] != c[1] {
+			if c[0] < c[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	// A prerelease is lower than the release
+	switch {
+	case len(v.Prerelease) == 0 && len(other.Prerelease) == 0:
+		return 0
+	case len(v.Prerelease) == 0:
+		return 1
+	case len(other.Prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.Prerelease) && i < len(other.Prerelease); i++ {
+		if c := compareIdentifiers(v.Prerelease[i], other.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(v.Prerelease) < len(other.Prerelease):
+		return -1
+	case len(v.Prerelease) > len(other.Prerelease):
+		return 1
+	}
+	return 0
+}
+
+// compareIdentifiers compares prerelease identifiers, numeric ones being lower than alphanumeric ones
+func compareIdentifiers(a, b string) int {
+	na, errA := strconv.ParseInt(a, 10, 64)
+	nb, errB := strconv.ParseInt(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil:
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+		return 0
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// Range is a version range such as ^1.2.0, ~1.2, >=1.0.0 <2.0.0, 1.x or 1.0.0 - 1.4.0 || 2.x
+type Range struct {
+	sets [][]comparator // Any set matches when all its comparators match
+}
+
+// comparator compares a version with op, one of <, <=, >, >= and =
+type comparator struct {
+	op      string
+	version Version
+}
+
+// partial is a possibly incomplete version of a range, -1 standing for a missing or wildcard part
+type partial struct {
+	major, minor, patch int64
+	prerelease          []string
+}
+
+// ParseRange parses an npm version range. An empty range matches any version.
+func ParseRange(s string) (Range, error) {
+	var r Range
+	for _, set := range strings.Split(s, "||") {
+		comparators, err := parseSet(strings.TrimSpace(set))
+		if err != nil {
+			return Range{}, fmt.Errorf("invalid version range %q: %w", s, err)
+		}
+		r.sets = append(r.sets, comparators)
+	}
+	return r, nil
+}
+
+// parseSet parses the comparators of a set, all of them having to match
+func parseSet(set string) ([]comparator, error) {
+	// Hyphen range
+	if lower, upper, ok := strings.Cut(set, " - "); ok {
+		from, err := parsePartial(strings.TrimSpace(lower))
+		if err != nil {
+			return nil, err
+		}
+		to, err := parsePartial(strings.TrimSpace(upper))
+		if err != nil {
+			return nil, err
+		}
+		var comparators []comparator
+		if from.major >= 0 {
+			comparators = append(comparators, comparator{">=", from.floor()})
+		}
+		if to.major >= 0 {
+			if to.patch >= 0 {
+				comparators = append(comparators, comparator{"<=", to.floor()})
+			} else {
+				comparators = append(comparators, comparator{"<", to.next()})
+			}
+		}
+		return comparators, nil
+	}
+
+	var comparators []comparator
+	// Operators may be separated from their version by spaces
+	fields := strings.Fields(set)
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		op := strings.TrimRight(field[:len(field)-len(strings.TrimLeft(field, "<>=~^"))], " ")
+		spec := field[len(op):]
+		if spec == "" && op != "" && i+1 < len(fields) {
+			i++
+			spec = fields[i]
+		}
+		expanded, err := expand(op, spec)
+		if err != nil {
+			return nil, err
+		}
+		comparators = append(comparators, expanded...)
+	}
+	return comparators, nil
+}
+
+// expand converts an operator and a partial version into comparators
+func expand(op, spec string) ([]comparator, error) {
+	p, err := parsePartial(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "", "=":
+		if p.major < 0 {
+			return nil, nil
+		}
+		if p.patch >= 0 {
+			return []comparator{{"=", p.floor()}}, nil
+		}
+		return []comparator{{">=", p.floor()}, {"<", p.next()}}, nil
+
+	case "~", "~>":
+		if p.major < 0 {
+			return nil, nil
+		}
+		upper := partial{major: p.major, minor: p.minor, patch: -1}
+		return []comparator{{">=", p.floor()}, {"<", upper.next()}}, nil
+
+	case "^":
+		if p.major < 0 {
+			return nil, nil
+		}
+		// The first non-zero part may not change
+		upper := partial{major: p.major, minor: -1, patch: -1}
+		if p.major == 0 && p.minor >= 0 {
+			upper.minor = p.minor
+			if p.minor == 0 && p.patch >= 0 {
+				upper.patch = p.patch
+			}
+		}
+		return []comparator{{">=", p.floor()}, {"<", upper.next()}}, nil
+
+	case ">":
+		if p.major < 0 {
+			// Nothing is greater than any version
+			return []comparator{{"<", Version{Prerelease: []string{"0"}}}}, nil
+		}
+		if p.patch >= 0 {
+			return []comparator{{">", p.floor()}}, nil
+		}
+		return []comparator{{">=", p.next()}}, nil
+
+	case ">=":
+		if p.major < 0 {
+			return nil, nil
+		}
+		return []comparator{{">=", p.floor()}}, nil
+
+	case "<":
+		if p.major < 0 {
+			return []comparator{{"<", Version{Prerelease: []string{"0"}}}}, nil
+		}
+		if p.patch >= 0 {
+			return []comparator{{"<", p.floor()}}, nil
+		}
+		return []comparator{{"<", p.floorPrerelease()}}, nil
+
+	case "<=":
+		if p.major < 0 {
+			return nil, nil
+		}
+		if p.patch >= 0 {
+			return []comparator{{"<=", p.floor()}}, nil
+		}
+		return []comparator{{"<", p.next()}}, nil
+	}
+	return nil, fmt.Errorf("unknown operator %q", op)
+}
+
+// parsePartial parses a version whose parts may be missing or wildcards
+func parsePartial(s string) (partial, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "v"), "=")
+	s, _, _ = strings.Cut(s, "+")
+	p := partial{major: -1, minor: -1, patch: -1}
+	if s == "" || s == "*" || s == "x" || s == "X" {
+		return p, nil
+	}
+
+	core, prerelease, hasPrerelease := strings.Cut(s, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) > 3 {
+		return partial{}, fmt.Errorf("invalid version %q", s)
+	}
+	targets := []*int64{&p.major, &p.minor, &p.patch}
+	for i, part := range parts {
+		if part == "*" || part == "x" || part == "X" {
+			break
+		}
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || n < 0 {
+			return partial{}, fmt.Errorf("invalid version %q", s)
+		}
+		*targets[i] = n
+	}
+	if hasPrerelease && p.patch >= 0 {
+		p.prerelease = strings.Split(prerelease, ".")
+	}
+	return p, nil
+}
+
+// floor returns the lowest version of the partial version, missing parts being 0
+func (p partial) floor() Version {
+	return Version{Major: max(p.major, 0), Minor: max(p.minor, 0), Patch: max(p.patch, 0), Prerelease: p.prerelease}
+}
+
+// floorPrerelease returns the lowest version, prereleases included, of the partial version
+func (p partial) floorPrerelease() Version {
+	v := p.floor()
+	v.Prerelease = []string{"0"}
+	return v
+}
+
+// next returns the lowest version, prereleases included, above the versions
+// matching the partial version, incrementing its last given part
+func (p partial) next() Version {
+	switch {
+	case p.minor < 0:
+		return Version{Major: p.major + 1, Prerelease: []string{"0"}}
+	case p.patch < 0:
+		return Version{Major: p.major, Minor: p.minor + 1, Prerelease: []string{"0"}}
+	default:
+		return Version{Major: p.major, Minor: p.minor, Patch: p.patch + 1, Prerelease: []string{"0"}}
+	}
+}
+
+// Contains reports whether a version is in the range. Prereleases only match
+// a set with a comparator on the same release, unless includePrerelease is set.
+func (r Range) Contains(v Version, includePrerelease bool) bool {
+	for _, set := range r.sets {
+		if setContains(set, v, includePrerelease) {
+			return true
+		}
+	}
+	return false
+}
+
+func setContains(set []comparator, v Version, includePrerelease bool) bool {
+	for _, c := range set {
+		if !c.matches(v) {
+			return false
+		}
+	}
+	if !v.IsPrerelease() || includePrerelease {
+		return true
+	}
+	for _, c := range set {
+		cv := c.version
+		if cv.IsPrerelease() && cv.Major == v.Major && cv.Minor == v.Minor && cv.Patch == v.Patch && !(len(cv.Prerelease) == 1 && cv.Prerelease[0] == "0") {
+			return true
+		}
+	}
+	return false
+}
+
+func (c comparator) matches(v Version) bool {
+	cmp := v.Compare(c.version)
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	default:
+		return cmp == 0
+	}
+}
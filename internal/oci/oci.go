@@ -0,0 +1,185 @@
+package oci
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// Media types of manifests and indexes
+const (
+	MediaTypeImageIndex    = "application/vnd.oci.image.index.v1+json"
+	MediaTypeImageManifest = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeManifestList  = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeManifest      = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// ManifestAccept lists the manifest media types accepted from a registry
+var ManifestAccept = []string{MediaTypeImageIndex, MediaTypeImageManifest, MediaTypeManifestList, MediaTypeManifest}
+
+// Annotations of the descriptors of an image layout index
+const (
+	AnnotationRefName       = "org.opencontainers.image.ref.name"
+	AnnotationContainerName = "io.containerd.image.name"
+)
+
+// LayoutFile is the content of the oci-layout file of an image layout
+const LayoutFile = `{"imageLayoutVersion":"1.0.0"}`
+
+// Descriptor references a content by its media type, digest and size
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	URLs        []string          `json:"urls,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *Platform         `json:"platform,omitempty"`
+}
+
+// Platform is the platform of a manifest of an index
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// String returns the platform as os/architecture[/variant]
+func (p *Platform) String() string {
+	if p == nil {
+		return "unknown"
+	}
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// Manifest is an image manifest, OCI or Docker
+type Manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        Descriptor   `json:"config"`
+	Layers        []Descriptor `json:"layers"`
+}
+
+// Index is an image index or a Docker manifest list
+type Index struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Manifests     []Descriptor `json:"manifests"`
+}
+
+// IsIndex reports whether a media type is an image index or a manifest list
+func IsIndex(mediaType string) bool {
+	return mediaType == MediaTypeImageIndex || mediaType == MediaTypeManifestList
+}
+
+// IsManifest reports whether a media type is an image manifest
+func IsManifest(mediaType string) bool {
+	return mediaType == MediaTypeImageManifest || mediaType == MediaTypeManifest
+}
+
+// MediaType returns the media type of a manifest document, read from its
+// mediaType field, or from its content for OCI documents without it
+func MediaType(data []byte) string {
+	var doc struct {
+		MediaType string            `json:"mediaType"`
+		Manifests []json.RawMessage `json:"manifests"`
+		Layers    []json.RawMessage `json:"layers"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return ""
+	}
+	switch {
+	case doc.MediaType != "":
+		return doc.MediaType
+	case doc.Manifests != nil:
+		return MediaTypeImageIndex
+	case doc.Layers != nil:
+		return MediaTypeImageManifest
+	}
+	return ""
+}
+
+// ParseDigest splits a digest such as sha256:<hex> into its algorithm and sum
+func ParseDigest(digest string) (string, []byte, error) {
+	algorithm, encoded, ok := strings.Cut(digest, ":")
+	if !ok || NewHash(algorithm) == nil {
+		return "", nil, fmt.Errorf("unsupported digest %q", digest)
+	}
+	sum, err := hex.DecodeString(encoded)
+	if err != nil || len(sum) != NewHash(algorithm)().Size() {
+		return "", nil, fmt.Errorf("invalid digest %q", digest)
+	}
+	return algorithm, sum, nil
+}
+
+// NewHash returns the hash function of a digest algorithm, or nil when it is not supported
+func NewHash(algorithm string) func() hash.Hash {
+	switch algorithm {
+	case "sha256":
+		return sha256.New
+	case "sha512":
+		return sha512.New
+	}
+	return nil
+}
+
+// Digest returns the sha256 digest of a content
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Verify checks that a content matches a digest
+func Verify(data []byte, digest string) error {
+	algorithm, sum, err := ParseDigest(digest)
+	if err != nil {
+		return err
+	}
+	h := NewHash(algorithm)()
+	h.Write(data)
+	if actual := h.Sum(nil); !bytes.Equal(actual, sum) {
+		return fmt.Errorf("digest mismatch: expected %s, got %s:%x", digest, algorithm, actual)
+	}
+	return nil
+}
+
+// BlobPath returns the path of a blob in an image layout, blobs/<algorithm>/<hex>
+func BlobPath(digest string) (string, error) {
+	algorithm, sum, err := ParseDigest(digest)
+	if err != nil {
+		return "", err
+	}
+	return "blobs/" + algorithm + "/" + hex.EncodeToString(sum), nil
+}
+
+// MergeIndex adds descriptors to the index of an image layout. Descriptors with
+// the same reference name replace the existing ones.
+func MergeIndex(existing []byte, descriptors []Descriptor) ([]byte, error) {
+	index := Index{SchemaVersion: 2, MediaType: MediaTypeImageIndex}
+	if len(existing) > 0 {
+		if err := json.Unmarshal(existing, &index); err != nil {
+			return nil, fmt.Errorf("invalid image layout index: %w", err)
+		}
+	}
+
+	replaced := make(map[string]bool)
+	for _, descriptor := range descriptors {
+		replaced[descriptor.Annotations[AnnotationRefName]] = true
+	}
+	manifests := []Descriptor{}
+	for _, descriptor := range index.Manifests {
+		if !replaced[descriptor.Annotations[AnnotationRefName]] {
+			manifests = append(manifests, descriptor)
+		}
+	}
+	index.Manifests = append(manifests, descriptors...)
+	return json.MarshalIndent(index, "", "  ")
+}
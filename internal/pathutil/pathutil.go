@@ -2,6 +2,8 @@ package pathutil
 
 import (
 	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -114,6 +116,102 @@ func SafeJoin(elements ...string) string {
 	return SanitizePath(result)
 }
 
+// ErrOutsideRoot is returned for a path leading outside of the directory it must stay in
+var ErrOutsideRoot = errors.New("path is outside of the root directory")
+
+// JoinWithin joins relative path elements to a root directory, sanitizing each of
+// their segments like SafeJoin. Unlike SafeJoin, it returns an error instead of a
+// path outside of root: absolute elements, ".." segments and symbolic links
+// leading out of root are refused.
+func JoinWithin(root string, elements ...string) (string, error) {
+	var segments []string
+	for _, elem := range elements {
+		if filepath.IsAbs(elem) || filepath.VolumeName(elem) != "" || strings.HasPrefix(filepath.ToSlash(elem), "/") {
+			return "", fmt.Errorf("%w: %s is an absolute path", ErrOutsideRoot, elem)
+		}
+		for _, segment := range strings.FieldsFunc(elem, isSeparator) {
+			segment = SanitizeFilename(segment)
+			if segment == ".." {
+				return "", fmt.Errorf("%w: %s", ErrOutsideRoot, elem)
+			}
+			if segment != "" && segment != "." {
+				segments = append(segments, segment)
+			}
+		}
+	}
+
+	target := SanitizePath(filepath.Join(append([]string{root}, segments...)...))
+	if err := Within(root, target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// Within returns an error when target is not inside root. The symbolic links of
+// the part of target which already exists are resolved, so that a file written
+// at target cannot land outside of root through a link.
+func Within(root, target string) error {
+	absRoot, err := filepath.Abs(strings.TrimPrefix(root, LongPathPrefix))
+	if err != nil {
+		return err
+	}
+	absTarget, err := filepath.Abs(strings.TrimPrefix(target, LongPathPrefix))
+	if err != nil {
+		return err
+	}
+	if !isInside(absRoot, absTarget) {
+		return fmt.Errorf("%w: %s", ErrOutsideRoot, target)
+	}
+
+	resolvedRoot, err := filepath.EvalSymlinks(absRoot)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Nothing exists below root yet
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// Resolve the deepest part of target which exists
+	existing := absTarget
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			if !isInside(resolvedRoot, resolved) {
+				return fmt.Errorf("%w: %s resolves to %s", ErrOutsideRoot, target, resolved)
+			}
+			return nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		// A dangling symbolic link would be followed when creating the file
+		if _, statErr := os.Lstat(existing); statErr == nil {
+			return fmt.Errorf("%w: %s is a dangling symbolic link", ErrOutsideRoot, existing)
+		}
+
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return nil
+		}
+		existing = parent
+	}
+}
+
+// isInside reports whether the absolute path p is root or one of its descendants
+func isInside(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// isSeparator reports whether r separates the segments of a path, slashes
+// being accepted on every OS
+func isSeparator(r rune) bool {
+	return r == '/' || r == filepath.Separator
+}
+
 // EnsureDirectoryExists ensures a directory exists, creating it if necessary
 func EnsureDirectoryExists(path string) error {
 	// Sanitize the path
@@ -0,0 +1,91 @@
+package pathutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJoinWithinRefusesPathsOutsideRoot(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{
+		"../../etc/cron.d/x",
+		"libs/../../x",
+		"..",
+		"/etc/cron.d/x",
+		"/",
+	} {
+		if target, err := JoinWithin(root, name); !errors.Is(err, ErrOutsideRoot) {
+			t.Errorf("JoinWithin(%q) = %q, %v, want ErrOutsideRoot", name, target, err)
+		}
+	}
+}
+
+func TestJoinWithinAcceptsPathsInsideRoot(t *testing.T) {
+	root := t.TempDir()
+	for name, want := range map[string]string{
+		"org/acme/lib-1.0.jar":       filepath.Join(root, "org", "acme", "lib-1.0.jar"),
+		"foo..bar-1.0.jar":           filepath.Join(root, "foo..bar-1.0.jar"),
+		"./org//acme/./lib-1.0.jar":  filepath.Join(root, "org", "acme", "lib-1.0.jar"),
+		"org/..hidden/lib-1.0.jar":   filepath.Join(root, "org", "..hidden", "lib-1.0.jar"),
+		"org/acme/lib-1.0.jar.sha1.": filepath.Join(root, "org", "acme", "lib-1.0.jar.sha1."),
+	} {
+		target, err := JoinWithin(root, name)
+		if err != nil || target != want {
+			t.Errorf("JoinWithin(%q) = %q, %v, want %q", name, target, err, want)
+		}
+	}
+}
+
+// Windows drive and UNC names are absolute on Windows only, elsewhere their
+// backslashes are part of a file name which stays inside root
+func TestJoinWithinWindowsNames(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{
+		`C:\Windows\System32\x`,
+		`C:x`,
+		`\\server\share\x`,
+		`..\..\x`,
+	} {
+		target, err := JoinWithin(root, name)
+		if IsWindowsOS() {
+			if !errors.Is(err, ErrOutsideRoot) {
+				t.Errorf("JoinWithin(%q) = %q, %v, want ErrOutsideRoot", name, target, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("JoinWithin(%q): %v", name, err)
+		} else if filepath.Dir(target) != root {
+			t.Errorf("JoinWithin(%q) = %q, want a file of %s", name, target, root)
+		}
+	}
+}
+
+func TestJoinWithinRefusesSymlinksOutsideRoot(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "libs")); err != nil {
+		t.Skipf("symbolic links not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "missing"), filepath.Join(root, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "inside"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "inside"), filepath.Join(root, "alias")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"libs/cron.d/x", "libs", "dangling"} {
+		if target, err := JoinWithin(root, name); !errors.Is(err, ErrOutsideRoot) {
+			t.Errorf("JoinWithin(%q) = %q, %v, want ErrOutsideRoot", name, target, err)
+		}
+	}
+	// A link to a directory of root is followed
+	if _, err := JoinWithin(root, "alias/lib-1.0.jar"); err != nil {
+		t.Errorf("JoinWithin(alias/lib-1.0.jar): %v", err)
+	}
+}
@@ -0,0 +1,387 @@
+package push
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/caezarr-oss/refap/internal/crawler"
+	"github.com/caezarr-oss/refap/internal/httpclient"
+)
+
+// MigrateConfig defines the streaming migration of repositories to a target Artifactory
+type MigrateConfig struct {
+	URL           string            // Base URL of the target Artifactory
+	RepositoryMap map[string]string // Target repository of renamed source repositories
+	StateFile     string            // Records the migrated files so that an interrupted migration resumes
+	Concurrency   int
+	RetryAttempts int
+	Delay         int // Seconds between retries
+	Auth          httpclient.Auth
+	Client        *http.Client
+	Metrics       *crawler.Metrics // Receives the files migrated and the active workers, when set
+}
+
+// Migrator copies files from a source Artifactory to a target Artifactory.
+// Each file is streamed from the source response into the upload request and
+// never written to local disk.
+type Migrator struct {
+	config MigrateConfig
+	target *Pusher // Performs the requests on the target
+	state  *migrationState
+}
+
+// NewMigrator creates a Migrator and loads the state of a previous run
+func NewMigrator(config MigrateConfig) (*Migrator, error) {
+	state, err := openMigrationState(config.StateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		config: config,
+		target: New(Config{
+			URL:           config.URL,
+			Concurrency:   config.Concurrency,
+			RetryAttempts: config.RetryAttempts,
+			Delay:         config.Delay,
+			Auth:          config.Auth,
+			Client:        config.Client,
+		}),
+		state: state,
+	}, nil
+}
+
+// Summary returns the statistics of the files migrated so far
+func (m *Migrator) Summary() Summary {
+	m.target.mu.Lock()
+	defer m.target.mu.Unlock()
+	return m.target.summary
+}
+
+// Close closes the state file
+func (m *Migrator) Close() error {
+	return m.state.close()
+}
+
+// Migrate crawls the repositories of a source and copies every file accepted
+// by the filters to the target. Failed files are counted in the summary and
+// do not stop the other files.
+//
+// newSource creates a crawler of the source. As a crawler is not safe for
+// concurrent use, the repositories are walked with one crawler and each worker
+// downloads its files with a crawler of its own. name labels the source in the metrics.
+func (m *Migrator) Migrate(name string, newSource func() *crawler.Crawler, repos []string) error {
+	jobs := make(chan crawler.Entry)
+	var wg sync.WaitGroup
+	for i := 0; i < m.target.config.Concurrency; i++ {
+		wg.Add(1)
+		go func(source *crawler.Crawler) {
+			defer wg.Done()
+			for entry := range jobs {
+				m.addActiveWorkers(1)
+				result, size, err := m.migrate(source, entry)
+				if err != nil {
+					fmt.Printf("Failed to migrate %s%s: %v\n", entry.Repo, entry.Path, err)
+					m.target.record(func(s *Summary) { s.Failed++ })
+					result = "failed"
+				}
+				m.addActiveWorkers(-1)
+				if m.config.Metrics != nil {
+					m.config.Metrics.AddFile(name, strings.Trim(entry.Repo, "/"), result, size)
+				}
+			}
+		}(newSource())
+	}
+
+	source := newSource()
+
+	failedRepos := 0
+	for _, repo := range repos {
+		repo = strings.TrimSpace(repo)
+		if repo == "" {
+			continue
+		}
+
+		fmt.Printf("Migrating repo %s to %s\n", repo, m.targetRepository(repo))
+		err := source.Walk(repo, func(entry crawler.Entry) error {
+			jobs <- entry
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("Failed to crawl repo %s: %v\n", repo, err)
+			failedRepos++
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if failedRepos > 0 {
+		return fmt.Errorf("%d repositories could not be crawled", failedRepos)
+	}
+	return nil
+}
+
+// addActiveWorkers adds n to the active workers of the metrics, when set
+func (m *Migrator) addActiveWorkers(n int) {
+	if m.config.Metrics != nil {
+		m.config.Metrics.AddActiveWorkers(n)
+	}
+}
+
+// migrate copies a single file unless the target already holds it. It returns
+// how the file was migrated, skipped, deployed or uploaded, with the bytes uploaded.
+func (m *Migrator) migrate(source *crawler.Crawler, entry crawler.Entry) (string, int64, error) {
+	target := m.targetURL(entry)
+	if m.state.done(target) {
+		m.target.record(func(s *Summary) { s.Skipped++ })
+		return "skipped", 0, nil
+	}
+
+	remote, err := m.target.remoteChecksums(target)
+	if err != nil {
+		return "", 0, err
+	}
+
+	resp, err := source.Open(entry.URL)
+	if err != nil {
+		return "", 0, err
+	}
+	expected := responseChecksums(resp)
+
+	// Skip files already present with the same content
+	if expected.sha1 != "" && remote.sha1 == expected.sha1 {
+		resp.Body.Close()
+		m.target.record(func(s *Summary) { s.Skipped++ })
+		return "skipped", 0, m.state.markDone(target)
+	}
+
+	// Try a checksum deploy first when the source reports the checksums
+	if expected.sha1 != "" {
+		deployed, err := m.target.checksumDeploy(target, expected)
+		if err != nil {
+			resp.Body.Close()
+			return "", 0, err
+		}
+		if deployed {
+			resp.Body.Close()
+			if err := m.verify(target, expected); err != nil {
+				return "", 0, err
+			}
+			fmt.Printf("Deployed %s%s by checksum\n", entry.Repo, entry.Path)
+			m.target.record(func(s *Summary) { s.Deployed++ })
+			return "deployed", 0, m.state.markDone(target)
+		}
+	}
+
+	sent, err := m.stream(source, entry, target, resp, expected)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := m.verify(target, sent); err != nil {
+		return "", 0, err
+	}
+
+	fmt.Printf("Migrated %s%s\n", entry.Repo, entry.Path)
+	m.target.record(func(s *Summary) {
+		s.Uploaded++
+		s.BytesUploaded += sent.size
+	})
+	return "uploaded", sent.size, m.state.markDone(target)
+}
+
+// stream uploads the body of the source response to the target and returns
+// the checksums of the bytes sent. Retries download the file from the source again.
+func (m *Migrator) stream(source *crawler.Crawler, entry crawler.Entry, target string, resp *http.Response, expected checksums) (checksums, error) {
+	var body *hashingReader
+	first := true
+	uploadResp, err := m.target.do(func() (*http.Request, error) {
+		if body != nil {
+			body.Close()
+		}
+		if !first {
+			var err error
+			resp, err = source.Open(entry.URL)
+			if err != nil {
+				return nil, err
+			}
+		}
+		first = false
+
+		body = newHashingReader(resp.Body)
+		req, err := http.NewRequest(http.MethodPut, target, body)
+		if err != nil {
+			body.Close()
+			return nil, err
+		}
+		req.ContentLength = resp.ContentLength
+		// The target rejects the upload when the content does not match the source checksums
+		setChecksumHeaders(req, expected)
+		return req, nil
+	})
+	if body != nil {
+		body.Close()
+	}
+	if err != nil {
+		return checksums{}, err
+	}
+	io.Copy(io.Discard, uploadResp.Body)
+	uploadResp.Body.Close()
+
+	if uploadResp.StatusCode != http.StatusOK && uploadResp.StatusCode != http.StatusCreated {
+		return checksums{}, fmt.Errorf("upload failed with status %d", uploadResp.StatusCode)
+	}
+
+	sent := body.checksums()
+	if (expected.sha1 != "" && sent.sha1 != expected.sha1) || (expected.sha256 != "" && sent.sha256 != expected.sha256) {
+		return checksums{}, errors.New("content read from the source does not match the source checksums")
+	}
+	return sent, nil
+}
+
+// verify checks that the target reports the expected checksums for a file
+func (m *Migrator) verify(target string, expected checksums) error {
+	remote, err := m.target.remoteChecksums(target)
+	if err != nil {
+		return err
+	}
+	if remote.sha1 == "" && remote.sha256 == "" {
+		return errors.New("target does not report the checksums of the uploaded file")
+	}
+	if (remote.sha1 != "" && remote.sha1 != expected.sha1) || (remote.sha256 != "" && expected.sha256 != "" && remote.sha256 != expected.sha256) {
+		return errors.New("checksum mismatch on the target after upload")
+	}
+	return nil
+}
+
+// targetRepository returns the name of a source repository on the target
+func (m *Migrator) targetRepository(repo string) string {
+	repo = strings.Trim(repo, "/")
+	if target, ok := m.config.RepositoryMap[repo]; ok {
+		return target
+	}
+	return repo
+}
+
+// targetURL returns the URL of a source file on the target
+func (m *Migrator) targetURL(entry crawler.Entry) string {
+	return strings.TrimSuffix(m.config.URL, "/") + "/" + m.targetRepository(entry.Repo) + "/" + escapePath(entry.Path)
+}
+
+// responseChecksums returns the checksums reported by Artifactory in the headers of a download
+func responseChecksums(resp *http.Response) checksums {
+	return checksums{
+		size:   resp.ContentLength,
+		sha1:   resp.Header.Get("X-Checksum-Sha1"),
+		md5:    resp.Header.Get("X-Checksum-Md5"),
+		sha256: resp.Header.Get("X-Checksum-Sha256"),
+	}
+}
+
+// hashingReader computes the checksums of the content read through it
+type hashingReader struct {
+	rc                io.ReadCloser
+	sha1, md5, sha256 hash.Hash
+	size              int64
+}
+
+// newHashingReader wraps rc to compute the checksums of its content
+func newHashingReader(rc io.ReadCloser) *hashingReader {
+	return &hashingReader{rc: rc, sha1: sha1.New(), md5: md5.New(), sha256: sha256.New()}
+}
+
+func (r *hashingReader) Read(b []byte) (int, error) {
+	n, err := r.rc.Read(b)
+	if n > 0 {
+		r.sha1.Write(b[:n])
+		r.md5.Write(b[:n])
+		r.sha256.Write(b[:n])
+		r.size += int64(n)
+	}
+	return n, err
+}
+
+func (r *hashingReader) Close() error {
+	return r.rc.Close()
+}
+
+// checksums returns the checksums of the content read so far
+func (r *hashingReader) checksums() checksums {
+	return checksums{
+		size:   r.size,
+		sha1:   hex.EncodeToString(r.sha1.Sum(nil)),
+		md5:    hex.EncodeToString(r.md5.Sum(nil)),
+		sha256: hex.EncodeToString(r.sha256.Sum(nil)),
+	}
+}
+
+// migrationState records the target URL of each migrated file, one per line
+type migrationState struct {
+	mu       sync.Mutex
+	migrated map[string]bool
+	file     *os.File
+}
+
+// openMigrationState loads the files migrated by previous runs and opens the state file for appending
+func openMigrationState(path string) (*migrationState, error) {
+	state := &migrationState{migrated: make(map[string]bool)}
+
+	if existing, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(existing)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				state.migrated[line] = true
+			}
+		}
+		err = scanner.Err()
+		existing.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read state file: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state file: %w", err)
+	}
+	state.file = file
+
+	if len(state.migrated) > 0 {
+		fmt.Printf("Resuming migration, %d files already migrated\n", len(state.migrated))
+	}
+	return state, nil
+}
+
+// done reports whether a file was migrated by a previous run
+func (s *migrationState) done(target string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.migrated[target]
+}
+
+// markDone records a migrated file
+func (s *migrationState) markDone(target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.migrated[target] = true
+	if _, err := fmt.Fprintln(s.file, target); err != nil {
+		return fmt.Errorf("failed to update state file: %w", err)
+	}
+	return nil
+}
+
+func (s *migrationState) close() error {
+	return s.file.Close()
+}
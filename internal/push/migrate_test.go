@@ -0,0 +1,104 @@
+package push
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/caezarr-oss/refap/config"
+	"github.com/caezarr-oss/refap/internal/crawler"
+	"github.com/caezarr-oss/refap/internal/metrics"
+)
+
+// newSourceStub serves an Artifactory listing of files with their checksum headers
+func newSourceStub(t *testing.T, files map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/list/libs/")
+		if name == "" {
+			var listing strings.Builder
+			listing.WriteString("<html><body><pre>\n")
+			for file := range files {
+				fmt.Fprintf(&listing, "<a href=\"%s\">%s</a>  01-Jan-2024 00:00  1 KB\n", file, file)
+			}
+			listing.WriteString("</pre></body></html>\n")
+			w.Write([]byte(listing.String()))
+			return
+		}
+		content, ok := files[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("X-Checksum-Sha1", sha1Hex([]byte(content)))
+		w.Write([]byte(content))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestMigrateWithConcurrentWorkers(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("lib%d-1.0.jar", i)] = fmt.Sprintf("content %d", i)
+	}
+	source := newSourceStub(t, files)
+	stub, target := newArtifactoryStub(t)
+	registry := metrics.NewRegistry()
+	migrateMetrics := crawler.NewMetrics(registry)
+
+	migrator, err := NewMigrator(MigrateConfig{
+		URL:           target.URL + "/artifactory/",
+		RepositoryMap: map[string]string{"libs": "libs-local"},
+		StateFile:     filepath.Join(t.TempDir(), "migrate.state"),
+		Concurrency:   4,
+		Client:        target.Client(),
+		Metrics:       migrateMetrics,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer migrator.Close()
+
+	newSource := func() *crawler.Crawler {
+		return crawler.New(crawler.Config{
+			ArtiURL:       source.URL + "/list/",
+			BaseDir:       t.TempDir(),
+			FileTypes:     []string{".jar"},
+			RetryAttempts: 1,
+			Timeout:       10,
+			FilterMode:    config.FilterModeNone,
+			Metrics:       migrateMetrics,
+			MetricsSource: "prod",
+		})
+	}
+	if err := migrator.Migrate("prod", newSource, []string{"libs/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	summary := migrator.Summary()
+	if summary.Uploaded != len(files) || summary.Failed != 0 {
+		t.Errorf("summary = %+v, want %d files uploaded", summary, len(files))
+	}
+	for name, content := range files {
+		if got := string(stub.files["/artifactory/libs-local/"+name]); got != content {
+			t.Errorf("%s on the target = %q, want %q", name, got, content)
+		}
+	}
+
+	// Every worker is idle again once the files are counted
+	var b strings.Builder
+	if err := registry.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		fmt.Sprintf(`refap_files_total{source="prod",repository="libs",result="uploaded"} %d`, len(files)),
+		"refap_active_workers 0",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics do not contain %s:\n%s", want, b.String())
+		}
+	}
+}
@@ -0,0 +1,428 @@
+package push
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caezarr-oss/refap/internal/archive"
+	"github.com/caezarr-oss/refap/internal/httpclient"
+)
+
+// Config defines the push of a local tree to a target Artifactory repository
+type Config struct {
+	URL             string // Base URL of the target Artifactory, e.g. https://host/artifactory/
+	Repository      string
+	SourceDir       string
+	ManifestPath    string // Optional export index or bundle manifest listing the files to push
+	StripComponents int    // Leading path components removed from each file path
+	Concurrency     int
+	RetryAttempts   int
+	Delay           int // Seconds between retries
+	Auth            httpclient.Auth
+	Client          *http.Client
+}
+
+// Summary holds the statistics of a push
+type Summary struct {
+	Uploaded      int
+	Deployed      int // Deployed by checksum, without sending the content
+	Skipped       int // Already present with the same sha1
+	Failed        int
+	BytesUploaded int64
+}
+
+// Print writes a human readable summary
+func (s *Summary) Print(w io.Writer) {
+	fmt.Fprintf(w, "Files uploaded: %d (%d bytes)\n", s.Uploaded, s.BytesUploaded)
+	fmt.Fprintf(w, "Files deployed by checksum: %d\n", s.Deployed)
+	fmt.Fprintf(w, "Files already present: %d\n", s.Skipped)
+	fmt.Fprintf(w, "Files failed: %d\n", s.Failed)
+}
+
+// Pusher uploads the files of a local tree to a target repository
+type Pusher struct {
+	config Config
+
+	mu      sync.Mutex
+	summary Summary
+}
+
+// file is a local file to push
+type file struct {
+	localPath string
+	relPath   string // Slash separated path in the target repository
+	sha256    string // Expected sha256 when read from a manifest
+}
+
+// checksums holds the checksums of a local file
+type checksums struct {
+	size   int64
+	sha1   string
+	md5    string
+	sha256 string
+}
+
+// New creates a Pusher with the provided configuration
+func New(config Config) *Pusher {
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1
+	}
+	if config.RetryAttempts <= 0 {
+		config.RetryAttempts = 1
+	}
+	return &Pusher{config: config}
+}
+
+// Run pushes every file and returns the statistics.
+// Failed files are counted in the summary and do not stop the other uploads.
+func (p *Pusher) Run() (Summary, error) {
+	files, err := p.collectFiles()
+	if err != nil {
+		return Summary{}, err
+	}
+
+	jobs := make(chan file)
+	var wg sync.WaitGroup
+	for i := 0; i < p.config.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				if err := p.push(f); err != nil {
+					fmt.Printf("Failed to push %s: %v\n", f.relPath, err)
+					p.record(func(s *Summary) { s.Failed++ })
+				}
+			}
+		}()
+	}
+
+	for _, f := range files {
+		jobs <- f
+	}
+	close(jobs)
+	wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.summary, nil
+}
+
+// collectFiles lists the files to push, from the manifest when set or by walking the source tree
+func (p *Pusher) collectFiles() ([]file, error) {
+	if p.config.ManifestPath != "" {
+		return p.collectFromManifest()
+	}
+
+	var files []file
+	err := filepath.WalkDir(p.config.SourceDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Skip hidden entries such as work and staging directories
+		if path != p.config.SourceDir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Skip listing files left by the crawler
+		if !d.Type().IsRegular() || strings.HasSuffix(d.Name(), "-index.html") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(p.config.SourceDir, path)
+		if err != nil {
+			return err
+		}
+		relPath, ok := stripComponents(filepath.ToSlash(rel), p.config.StripComponents)
+		if !ok {
+			return nil
+		}
+		files = append(files, file{localPath: path, relPath: relPath})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", p.config.SourceDir, err)
+	}
+	return files, nil
+}
+
+// collectFromManifest lists the files of an export index or a bundle manifest.
+// Both list the files in an "entries" array with their path and sha256.
+func (p *Pusher) collectFromManifest() ([]file, error) {
+	data, err := os.ReadFile(p.config.ManifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var manifest struct {
+		Entries []archive.Entry `json:"entries"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	files := make([]file, 0, len(manifest.Entries))
+	for _, entry := range manifest.Entries {
+		if unsafeManifestPath(entry.Path) {
+			return nil, fmt.Errorf("unsafe path in manifest: %s", entry.Path)
+		}
+		relPath, ok := stripComponents(entry.Path, p.config.StripComponents)
+		if !ok {
+			continue
+		}
+		files = append(files, file{
+			localPath: filepath.Join(p.config.SourceDir, filepath.FromSlash(entry.Path)),
+			relPath:   relPath,
+			sha256:    entry.SHA256,
+		})
+	}
+	return files, nil
+}
+
+// unsafeManifestPath reports whether a manifest path could lead out of the source
+// directory: absolute, with backslashes or with ".." segments. Names containing two
+// dots, such as lib-1.0..jar, are accepted.
+func unsafeManifestPath(name string) bool {
+	if strings.HasPrefix(name, "/") || strings.Contains(name, "\\") {
+		return true
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// push uploads a single file unless the target already holds it
+func (p *Pusher) push(f file) error {
+	sums, err := computeChecksums(f.localPath)
+	if err != nil {
+		return err
+	}
+	if f.sha256 != "" && f.sha256 != sums.sha256 {
+		return errors.New("local file does not match the manifest sha256")
+	}
+
+	target := p.targetURL(f.relPath)
+
+	// Skip files already present with the same content
+	remote, err := p.remoteChecksums(target)
+	if err != nil {
+		return err
+	}
+	if remote.sha1 == sums.sha1 {
+		p.record(func(s *Summary) { s.Skipped++ })
+		return nil
+	}
+
+	// Try a checksum deploy first, the content is only sent when the
+	// target does not hold a binary with the same checksum
+	deployed, err := p.checksumDeploy(target, sums)
+	if err != nil {
+		return err
+	}
+	if deployed {
+		fmt.Printf("Deployed %s by checksum\n", f.relPath)
+		p.record(func(s *Summary) { s.Deployed++ })
+		return nil
+	}
+
+	if err := p.upload(target, f.localPath, sums); err != nil {
+		return err
+	}
+	fmt.Printf("Uploaded %s\n", f.relPath)
+	p.record(func(s *Summary) {
+		s.Uploaded++
+		s.BytesUploaded += sums.size
+	})
+	return nil
+}
+
+// remoteChecksums returns the checksums reported by the target for a file.
+// The checksums are empty when the file does not exist.
+func (p *Pusher) remoteChecksums(target string) (checksums, error) {
+	resp, err := p.do(func() (*http.Request, error) {
+		return http.NewRequest(http.MethodHead, target, nil)
+	})
+	if err != nil {
+		return checksums{}, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return checksums{
+			size:   resp.ContentLength,
+			sha1:   resp.Header.Get("X-Checksum-Sha1"),
+			sha256: resp.Header.Get("X-Checksum-Sha256"),
+		}, nil
+	case http.StatusNotFound:
+		return checksums{}, nil
+	default:
+		return checksums{}, fmt.Errorf("unexpected status %d when checking %s", resp.StatusCode, target)
+	}
+}
+
+// checksumDeploy asks the target to deploy the file from a binary it already stores
+func (p *Pusher) checksumDeploy(target string, sums checksums) (bool, error) {
+	resp, err := p.do(func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPut, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Checksum-Deploy", "true")
+		setChecksumHeaders(req, sums)
+		return req, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	// Not found means the target has no binary with this checksum. Any other
+	// refusal also falls back to a regular upload.
+	return resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated, nil
+}
+
+// upload sends the file content to the target
+func (p *Pusher) upload(target, localPath string, sums checksums) error {
+	resp, err := p.do(func() (*http.Request, error) {
+		content, err := os.Open(localPath)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest(http.MethodPut, target, content)
+		if err != nil {
+			content.Close()
+			return nil, err
+		}
+		req.ContentLength = sums.size
+		setChecksumHeaders(req, sums)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("upload failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// do performs a request with authentication, retrying on network and server errors.
+// newRequest is called for each attempt so that request bodies can be sent again.
+func (p *Pusher) do(newRequest func() (*http.Request, error)) (*http.Response, error) {
+	var lastErr error
+	for attempt := 0; attempt < p.config.RetryAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(p.config.Delay) * time.Second)
+		}
+
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		p.config.Auth.Apply(req)
+
+		resp, err := p.config.Client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			lastErr = fmt.Errorf("%s %s: status code %d", req.Method, req.URL, resp.StatusCode)
+			continue
+		}
+		return resp, nil
+	}
+	return nil, lastErr
+}
+
+// targetURL returns the URL of a file in the target repository
+func (p *Pusher) targetURL(relPath string) string {
+	return strings.TrimSuffix(p.config.URL, "/") + "/" + strings.Trim(p.config.Repository, "/") + "/" + escapePath(relPath)
+}
+
+// record updates the summary
+func (p *Pusher) record(update func(s *Summary)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	update(&p.summary)
+}
+
+// setChecksumHeaders adds the X-Checksum-* headers verified by Artifactory.
+// Unknown checksums are left out.
+func setChecksumHeaders(req *http.Request, sums checksums) {
+	if sums.sha1 != "" {
+		req.Header.Set("X-Checksum-Sha1", sums.sha1)
+	}
+	if sums.sha256 != "" {
+		req.Header.Set("X-Checksum-Sha256", sums.sha256)
+	}
+	// Artifactory expects the MD5 checksum in the plain X-Checksum header
+	if sums.md5 != "" {
+		req.Header.Set("X-Checksum", sums.md5)
+	}
+}
+
+// computeChecksums reads a file once and computes its checksums
+func computeChecksums(path string) (checksums, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return checksums{}, err
+	}
+	defer file.Close()
+
+	sha1Hash, md5Hash, sha256Hash := sha1.New(), md5.New(), sha256.New()
+	size, err := io.Copy(io.MultiWriter(sha1Hash, md5Hash, sha256Hash), file)
+	if err != nil {
+		return checksums{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return checksums{
+		size:   size,
+		sha1:   hex.EncodeToString(sha1Hash.Sum(nil)),
+		md5:    hex.EncodeToString(md5Hash.Sum(nil)),
+		sha256: hex.EncodeToString(sha256Hash.Sum(nil)),
+	}, nil
+}
+
+// stripComponents removes leading components from a slash separated path
+func stripComponents(relPath string, n int) (string, bool) {
+	parts := strings.Split(relPath, "/")
+	if n >= len(parts) {
+		return "", false
+	}
+	return strings.Join(parts[n:], "/"), true
+}
+
+// escapePath escapes each segment of a slash separated path for use in a URL
+func escapePath(relPath string) string {
+	parts := strings.Split(relPath, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,265 @@
+package push
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// artifactoryStub is a target repository storing the uploaded files in memory.
+// It deploys by checksum the binaries it already holds, rejects the uploads whose
+// checksum headers do not match their content, and refuses the paths containing
+// "forbidden".
+type artifactoryStub struct {
+	mu        sync.Mutex
+	files     map[string][]byte      // Content by path
+	headers   map[string]http.Header // Headers of the last upload by path
+	binaries  map[string]bool        // sha1 of the stored binaries
+	uploads   int
+	deploys   int
+	badHeader []string
+}
+
+func newArtifactoryStub(t *testing.T) (*artifactoryStub, *httptest.Server) {
+	stub := &artifactoryStub{files: make(map[string][]byte), headers: make(map[string]http.Header), binaries: make(map[string]bool)}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	return stub, server
+}
+
+// store adds a file to the target as if it had been uploaded before
+func (s *artifactoryStub) store(path string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[path] = content
+	s.binaries[sha1Hex(content)] = true
+}
+
+func (s *artifactoryStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if strings.Contains(r.URL.Path, "forbidden") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		content, ok := s.files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("X-Checksum-Sha1", sha1Hex(content))
+		w.WriteHeader(http.StatusOK)
+
+	case http.MethodPut:
+		if r.Header.Get("X-Checksum-Deploy") == "true" {
+			sum := r.Header.Get("X-Checksum-Sha1")
+			if !s.binaries[sum] {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			s.deploys++
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		md5Sum := md5.Sum(content)
+		sha256Sum := sha256.Sum256(content)
+		expected := map[string]string{
+			"X-Checksum-Sha1":   sha1Hex(content),
+			"X-Checksum-Sha256": hex.EncodeToString(sha256Sum[:]),
+			"X-Checksum":        hex.EncodeToString(md5Sum[:]),
+		}
+		for header, sum := range expected {
+			if value := r.Header.Get(header); value != "" && value != sum {
+				s.badHeader = append(s.badHeader, r.URL.Path)
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+		}
+		s.files[r.URL.Path] = content
+		s.headers[r.URL.Path] = r.Header.Clone()
+		s.binaries[sha1Hex(content)] = true
+		s.uploads++
+		w.WriteHeader(http.StatusCreated)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func sha1Hex(content []byte) string {
+	sum := sha1.Sum(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func writeFile(t *testing.T, dir, relPath, content string) {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestPusher(server *httptest.Server, sourceDir string, concurrency int) *Pusher {
+	return New(Config{
+		URL:         server.URL + "/artifactory/",
+		Repository:  "libs-release-local",
+		SourceDir:   sourceDir,
+		Concurrency: concurrency,
+		Client:      server.Client(),
+	})
+}
+
+func TestPushSkipsDeploysAndUploads(t *testing.T) {
+	stub, server := newArtifactoryStub(t)
+	dir := t.TempDir()
+
+	writeFile(t, dir, "org/acme/present/1.0/present-1.0.jar", "present")
+	writeFile(t, dir, "org/acme/copy/1.0/copy-1.0.jar", "shared binary")
+	writeFile(t, dir, "org/acme/new/1.0/new-1.0.jar", "new content")
+
+	// The same path with the same content is skipped, and a binary stored
+	// under another path is deployed by checksum
+	stub.store("/artifactory/libs-release-local/org/acme/present/1.0/present-1.0.jar", []byte("present"))
+	stub.store("/artifactory/libs-release-local/org/acme/other/1.0/other-1.0.jar", []byte("shared binary"))
+
+	summary, err := newTestPusher(server, dir, 1).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Summary{Uploaded: 1, Deployed: 1, Skipped: 1, BytesUploaded: int64(len("new content"))}
+	if summary != want {
+		t.Errorf("summary = %+v, want %+v", summary, want)
+	}
+	if stub.deploys != 1 || stub.uploads != 1 {
+		t.Errorf("target received %d checksum deploys and %d uploads, want 1 and 1", stub.deploys, stub.uploads)
+	}
+	if got := string(stub.files["/artifactory/libs-release-local/org/acme/new/1.0/new-1.0.jar"]); got != "new content" {
+		t.Errorf("uploaded content = %q", got)
+	}
+}
+
+func TestPushReplacesChangedFile(t *testing.T) {
+	stub, server := newArtifactoryStub(t)
+	dir := t.TempDir()
+
+	writeFile(t, dir, "org/acme/lib/1.0/lib-1.0.jar", "rebuilt")
+	stub.store("/artifactory/libs-release-local/org/acme/lib/1.0/lib-1.0.jar", []byte("original"))
+
+	summary, err := newTestPusher(server, dir, 1).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Uploaded != 1 || summary.Skipped != 0 {
+		t.Errorf("summary = %+v, want the changed file uploaded", summary)
+	}
+}
+
+func TestPushSendsChecksumHeaders(t *testing.T) {
+	stub, server := newArtifactoryStub(t)
+	dir := t.TempDir()
+	writeFile(t, dir, "a/b/c.pom", "<project/>")
+
+	if _, err := newTestPusher(server, dir, 1).Run(); err != nil {
+		t.Fatal(err)
+	}
+	// The stub refuses an upload whose X-Checksum-* headers do not match its content
+	if len(stub.badHeader) > 0 || stub.uploads != 1 {
+		t.Fatalf("uploads with wrong checksum headers: %v, %d uploads", stub.badHeader, stub.uploads)
+	}
+	headers := stub.headers["/artifactory/libs-release-local/a/b/c.pom"]
+	for _, header := range []string{"X-Checksum-Sha1", "X-Checksum-Sha256", "X-Checksum"} {
+		if headers.Get(header) == "" {
+			t.Errorf("upload without %s header", header)
+		}
+	}
+}
+
+func TestPushCountsFailuresConcurrently(t *testing.T) {
+	stub, server := newArtifactoryStub(t)
+	dir := t.TempDir()
+
+	const files = 40
+	for i := 0; i < files; i++ {
+		relPath := fmt.Sprintf("org/acme/lib%d/1.0/lib%d-1.0.jar", i, i)
+		if i%4 == 0 {
+			relPath = fmt.Sprintf("org/acme/forbidden%d/1.0/forbidden%d-1.0.jar", i, i)
+		}
+		writeFile(t, dir, relPath, fmt.Sprintf("content %d", i))
+	}
+
+	summary, err := newTestPusher(server, dir, 8).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Failed != files/4 || summary.Uploaded != files-files/4 {
+		t.Errorf("summary = %+v, want %d failed and %d uploaded", summary, files/4, files-files/4)
+	}
+	if stub.uploads != summary.Uploaded {
+		t.Errorf("target received %d uploads, summary counts %d", stub.uploads, summary.Uploaded)
+	}
+}
+
+func TestPushFromManifestAcceptsNamesWithTwoDots(t *testing.T) {
+	stub, server := newArtifactoryStub(t)
+	dir := t.TempDir()
+	writeFile(t, dir, "libs/org/acme/lib/1.0/lib-1.0..jar", "two dots")
+	writeFile(t, dir, "libs/org/acme/lib/1.0/unlisted.jar", "not in the manifest")
+
+	manifestPath := filepath.Join(t.TempDir(), "export.index.json")
+	manifest := `{"entries": [{"path": "libs/org/acme/lib/1.0/lib-1.0..jar"}]}`
+	if err := os.WriteFile(manifestPath, []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pusher := newTestPusher(server, dir, 1)
+	pusher.config.ManifestPath = manifestPath
+	pusher.config.StripComponents = 1
+	summary, err := pusher.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Uploaded != 1 || stub.files["/artifactory/libs-release-local/org/acme/lib/1.0/lib-1.0..jar"] == nil {
+		t.Errorf("summary = %+v, files = %v, want the file of the manifest uploaded", summary, stub.files)
+	}
+}
+
+func TestPushFromManifestRejectsUnsafePaths(t *testing.T) {
+	_, server := newArtifactoryStub(t)
+	for _, entryPath := range []string{"../secret.jar", "libs/../../secret.jar", "/etc/passwd", "libs\\..\\secret.jar"} {
+		manifestPath := filepath.Join(t.TempDir(), "export.index.json")
+		manifest := fmt.Sprintf(`{"entries": [{"path": %q}]}`, entryPath)
+		if err := os.WriteFile(manifestPath, []byte(manifest), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		pusher := newTestPusher(server, t.TempDir(), 1)
+		pusher.config.ManifestPath = manifestPath
+		if _, err := pusher.Run(); err == nil || !strings.Contains(err.Error(), "unsafe path") {
+			t.Errorf("%s: err = %v, want an unsafe path", entryPath, err)
+		}
+	}
+}
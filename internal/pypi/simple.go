@@ -0,0 +1,180 @@
+package pypi
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// anchorPattern matches the anchors of a simple repository page
+	anchorPattern = regexp.MustCompile(`(?is)<a\s([^>]*)>(.*?)</a>`)
+	// attributePattern matches the attributes of an anchor, quoted or not
+	attributePattern = regexp.MustCompile(`([a-zA-Z_:][-a-zA-Z0-9_:.]*)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+)))?`)
+	// normalizePattern matches the separators replaced by the normalization of project names
+	normalizePattern = regexp.MustCompile(`[-_.]+`)
+)
+
+// hashes are the hash functions of the #<name>=<hex> fragments of the links
+var hashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha224": sha256.New224,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// Link is an anchor of a simple repository page
+type Link struct {
+	Href       string            // Value of the href attribute, with its fragment
+	Text       string            // Text of the anchor
+	Attributes map[string]string // Other attributes, such as data-requires-python
+}
+
+// ParsePage extracts the anchors of a PEP 503 simple repository page
+func ParsePage(page []byte) []Link {
+	var links []Link
+	for _, match := range anchorPattern.FindAllSubmatch(page, -1) {
+		link := Link{
+			Text:       strings.TrimSpace(html.UnescapeString(string(match[2]))),
+			Attributes: make(map[string]string),
+		}
+		for _, attribute := range attributePattern.FindAllSubmatch(match[1], -1) {
+			name := strings.ToLower(string(attribute[1]))
+			value := html.UnescapeString(string(attribute[2]) + string(attribute[3]) + string(attribute[4]))
+			if name == "href" {
+				link.Href = value
+			} else {
+				link.Attributes[name] = value
+			}
+		}
+		if link.Href != "" {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// Hash returns the name and the expected sum of the #<name>=<hex> fragment of the link
+func (l Link) Hash() (string, []byte, bool) {
+	_, fragment, ok := strings.Cut(l.Href, "#")
+	if !ok {
+		return "", nil, false
+	}
+	name, value, ok := strings.Cut(fragment, "=")
+	if !ok || hashes[name] == nil {
+		return "", nil, false
+	}
+	sum, err := hex.DecodeString(value)
+	if err != nil {
+		return "", nil, false
+	}
+	return name, sum, true
+}
+
+// NewHash returns the hash function of a fragment hash name
+func NewHash(name string) func() hash.Hash {
+	return hashes[name]
+}
+
+// Normalize returns the normalized name of a project as defined by PEP 503
+func Normalize(name string) string {
+	return strings.ToLower(normalizePattern.ReplaceAllString(name, "-"))
+}
+
+// Package types of a distribution file
+const (
+	Wheel = "wheel"
+	Sdist = "sdist"
+)
+
+// sdistExtensions are the extensions of source distributions
+var sdistExtensions = []string{".tar.gz", ".tar.bz2", ".tar.xz", ".tgz", ".zip"}
+
+// Distribution describes a distribution file from its name
+type Distribution struct {
+	Type         string   // Wheel or Sdist
+	PythonTags   []string // Python tags of a wheel, such as py3 or cp311
+	ABITags      []string
+	PlatformTags []string // Platform tags of a wheel, such as any or manylinux_2_17_x86_64
+}
+
+// ParseFilename classifies a distribution file. Wheel names follow
+// {name}-{version}(-{build})?-{python}-{abi}-{platform}.whl, where each tag
+// may hold several values separated by dots.
+func ParseFilename(filename string) (Distribution, error) {
+	if stem, ok := strings.CutSuffix(filename, ".whl"); ok {
+		parts := strings.Split(stem, "-")
+		if len(parts) != 5 && len(parts) != 6 {
+			return Distribution{}, fmt.Errorf("invalid wheel name %q", filename)
+		}
+		n := len(parts)
+		return Distribution{
+			Type:         Wheel,
+			PythonTags:   strings.Split(parts[n-3], "."),
+			ABITags:      strings.Split(parts[n-2], "."),
+			PlatformTags: strings.Split(parts[n-1], "."),
+		}, nil
+	}
+
+	for _, extension := range sdistExtensions {
+		if strings.HasSuffix(strings.ToLower(filename), extension) {
+			return Distribution{Type: Sdist}, nil
+		}
+	}
+	return Distribution{}, fmt.Errorf("unsupported distribution %q", filename)
+}
+
+// ProjectFile is a file listed in the page of a project of the exported index
+type ProjectFile struct {
+	Href       string // Relative URL of the file, with its hash fragment
+	Filename   string
+	Attributes map[string]string // Attributes kept from the original page
+}
+
+// RootPage renders the page listing the projects of a simple repository
+func RootPage(projects []string) []byte {
+	sorted := append([]string(nil), projects...)
+	sort.Strings(sorted)
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n  <head>\n    <meta name=\"pypi:repository-version\" content=\"1.0\">\n    <title>Simple index</title>\n  </head>\n  <body>\n")
+	for _, project := range sorted {
+		fmt.Fprintf(&b, "    <a href=\"%s/\">%s</a>\n", html.EscapeString(project), html.EscapeString(project))
+	}
+	b.WriteString("  </body>\n</html>\n")
+	return []byte(b.String())
+}
+
+// ProjectPage renders the page listing the files of a project
+func ProjectPage(project string, files []ProjectFile) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n  <head>\n    <meta name=\"pypi:repository-version\" content=\"1.0\">\n    <title>Links for %s</title>\n  </head>\n  <body>\n    <h1>Links for %s</h1>\n", html.EscapeString(project), html.EscapeString(project))
+	for _, file := range files {
+		fmt.Fprintf(&b, "    <a href=\"%s\"", html.EscapeString(file.Href))
+		for _, name := range sortedNames(file.Attributes) {
+			fmt.Fprintf(&b, " %s=\"%s\"", name, html.EscapeString(file.Attributes[name]))
+		}
+		fmt.Fprintf(&b, ">%s</a><br/>\n", html.EscapeString(file.Filename))
+	}
+	b.WriteString("  </body>\n</html>\n")
+	return []byte(b.String())
+}
+
+func sortedNames(attributes map[string]string) []string {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}